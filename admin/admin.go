@@ -0,0 +1,45 @@
+// Package admin guards the operator endpoints. Callers prove they are the
+// operator with the ADMIN_KEY in the X-Admin-Key header.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"go-backend/usage"
+)
+
+// KeyHeader carries the admin key
+const KeyHeader = "X-Admin-Key"
+
+// KeyFromEnv returns ADMIN_KEY; without it nobody is an admin
+func KeyFromEnv() string {
+	return os.Getenv("ADMIN_KEY")
+}
+
+// Authorized reports whether r carries key. An empty key authorizes nobody.
+func Authorized(r *http.Request, key string) bool {
+	given := r.Header.Get(KeyHeader)
+	return key != "" && subtle.ConstantTimeCompare([]byte(given), []byte(key)) == 1
+}
+
+// Only serves next only to requests carrying key
+func Only(key string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Authorized(r, key) {
+			http.Error(w, "Admin key required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UsageHandler serves the process-wide LLM usage since start-up, broken down
+// by model, service and client
+func UsageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(usage.Totals())
+}
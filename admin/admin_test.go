@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOnly(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		given string
+		want  int
+	}{
+		{"right key", "s3cret", "s3cret", http.StatusOK},
+		{"wrong key", "s3cret", "guess", http.StatusForbidden},
+		{"no key sent", "s3cret", "", http.StatusForbidden},
+		{"no key configured", "", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Only(tt.key, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			r := httptest.NewRequest("GET", "/admin/usage", nil)
+			if tt.given != "" {
+				r.Header.Set(KeyHeader, tt.given)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Package alerts re-runs saved Ticketmaster searches on a schedule and tells
+// their owners about events that were not in the previous results.
+package alerts
+
+import (
+	"context"
+	"fmt"
+
+	"go-backend/factories"
+	"go-backend/storage"
+)
+
+// Event is the part of a Ticketmaster event an alert reports
+type Event struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	URL   string `json:"url,omitempty"`
+	Date  string `json:"date,omitempty"`
+	Time  string `json:"time,omitempty"`
+	Venue string `json:"venue,omitempty"`
+	City  string `json:"city,omitempty"`
+}
+
+// Searcher runs a resolved search and returns the events it finds
+type Searcher func(ctx context.Context, action storage.Action) ([]Event, error)
+
+// TicketmasterSearcher calls the Discovery API directly with the saved
+// action; no LLM is involved in re-running a search
+func TicketmasterSearcher(factory factories.AbstractFactory) Searcher {
+	return func(ctx context.Context, action storage.Action) ([]Event, error) {
+		data := map[string]string{"action": action.Action}
+		for k, v := range action.Parameters {
+			data[k] = v
+		}
+		raw, err := factory.CreateProduct().PerformAction(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+		return eventsFromResponse(raw)
+	}
+}
+
+// eventsFromResponse picks the events out of a Discovery API response. A
+// response without _embedded simply has no results.
+func eventsFromResponse(raw map[string]interface{}) ([]Event, error) {
+	embedded, ok := raw["_embedded"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	list, ok := embedded["events"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response: _embedded has no events list")
+	}
+
+	events := make([]Event, 0, len(list))
+	for _, item := range list {
+		e, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		event := Event{ID: str(e, "id"), Name: str(e, "name"), URL: str(e, "url")}
+		if event.ID == "" {
+			continue
+		}
+		if start := obj(obj(e, "dates"), "start"); start != nil {
+			event.Date = str(start, "localDate")
+			event.Time = str(start, "localTime")
+		}
+		if venues, ok := obj(e, "_embedded")["venues"].([]interface{}); ok && len(venues) > 0 {
+			if venue, ok := venues[0].(map[string]interface{}); ok {
+				event.Venue = str(venue, "name")
+				event.City = str(obj(venue, "city"), "name")
+			}
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func obj(m map[string]interface{}, key string) map[string]interface{} {
+	v, _ := m[key].(map[string]interface{})
+	return v
+}
+
+func str(m map[string]interface{}, key string) string {
+	v, _ := m[key].(string)
+	return v
+}
+
+// newEvents returns the events whose ids are not in seen, and the ids to
+// remember for the next run: this run's ids first, then the older ones, up to
+// storage.MaxSeenIDs
+func newEvents(events []Event, seen []string) (fresh []Event, remember []string) {
+	known := make(map[string]bool, len(seen))
+	for _, id := range seen {
+		known[id] = true
+	}
+
+	current := make(map[string]bool, len(events))
+	for _, e := range events {
+		if current[e.ID] {
+			continue
+		}
+		current[e.ID] = true
+		remember = append(remember, e.ID)
+		if !known[e.ID] {
+			fresh = append(fresh, e)
+		}
+	}
+	for _, id := range seen {
+		if len(remember) >= storage.MaxSeenIDs {
+			break
+		}
+		if !current[id] {
+			remember = append(remember, id)
+		}
+	}
+	if len(remember) > storage.MaxSeenIDs {
+		remember = remember[:storage.MaxSeenIDs]
+	}
+	return fresh, remember
+}
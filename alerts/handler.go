@@ -0,0 +1,236 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"go-backend/dates"
+	"go-backend/factories"
+	"go-backend/logging"
+	"go-backend/ratelimit"
+	"go-backend/storage"
+	"go-backend/webhook"
+)
+
+// SearchAction is the only Discovery API action a search can be saved for;
+// alerts are worked out from event ids
+const SearchAction = "events"
+
+// CreateRequest is the body accepted by POST /searches. Either Prompt, which
+// is resolved to an action the way /promptOpenAI would, or Action is required.
+type CreateRequest struct {
+	Name   string          `json:"name,omitempty"`
+	Prompt string          `json:"prompt,omitempty"`
+	Action *storage.Action `json:"action,omitempty"`
+	// Interval is how often to re-run the search, e.g. "6h"
+	Interval  string `json:"interval,omitempty"`
+	NotifyURL string `json:"notify_url,omitempty"`
+	// Timezone is as in factories.PromptRequest: the prompt's dates are
+	// worked out in it, on every run. It takes precedence over X-Timezone.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// SearchView is a saved search as shown to its owner
+type SearchView struct {
+	storage.SavedSearch
+	Interval   string `json:"interval"`
+	SeenEvents int    `json:"seen_events"`
+}
+
+func view(search storage.SavedSearch) SearchView {
+	return SearchView{SavedSearch: search, Interval: search.Interval.String(), SeenEvents: len(search.SeenIDs)}
+}
+
+// Handler serves the saved search endpoints. Searches are only visible to the
+// client that saved them.
+type Handler struct {
+	Repo      storage.Repository
+	Director  *factories.ServiceDirector
+	Callbacks *webhook.Sender
+	Config    Config
+}
+
+// Create serves POST /searches
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	var req CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if (req.Prompt == "") == (req.Action == nil) {
+		http.Error(w, "Exactly one of prompt or action is required", http.StatusBadRequest)
+		return
+	}
+
+	interval := h.Config.DefaultInterval
+	if req.Interval != "" {
+		d, err := time.ParseDuration(req.Interval)
+		if err != nil {
+			http.Error(w, "Invalid interval", http.StatusBadRequest)
+			return
+		}
+		if d < h.Config.MinInterval {
+			http.Error(w, fmt.Sprintf("Interval must be at least %s", h.Config.MinInterval), http.StatusBadRequest)
+			return
+		}
+		interval = d
+	}
+
+	if req.NotifyURL != "" {
+		if err := h.Callbacks.ValidateURL(req.NotifyURL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	if req.Timezone != "" {
+		tz, err := dates.LoadTimezone(req.Timezone)
+		if err != nil {
+			http.Error(w, "Invalid timezone", http.StatusBadRequest)
+			return
+		}
+		ctx = dates.WithTimezone(ctx, tz)
+	}
+	client := ratelimit.ClientID(r)
+	existing, err := h.Repo.ListSearches(ctx, client)
+	if err != nil {
+		h.internalError(ctx, w, "Error listing saved searches", err)
+		return
+	}
+	if len(existing) >= h.Config.MaxPerClient {
+		http.Error(w, fmt.Sprintf("Saved search limit reached (%d)", h.Config.MaxPerClient), http.StatusForbidden)
+		return
+	}
+
+	action := req.Action
+	if req.Prompt != "" {
+		if action, err = h.resolve(ctx, req.Prompt); err != nil {
+			status, msg := factories.RunErrorStatus(err)
+			if status == http.StatusTooManyRequests {
+				ratelimit.TooManyRequests(w, ratelimit.RetryAfter(ctx), msg)
+				return
+			}
+			if status == http.StatusInternalServerError {
+				logging.FromContext(ctx).ErrorContext(ctx, "Error resolving saved search", "error", err)
+			}
+			http.Error(w, msg, status)
+			return
+		}
+	}
+	if action.Action != SearchAction {
+		http.Error(w, fmt.Sprintf("Only %q searches can be saved, not %q", SearchAction, action.Action), http.StatusBadRequest)
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = req.Prompt
+	}
+	if name == "" {
+		name = action.Parameters["keyword"]
+	}
+
+	now := time.Now().UTC()
+	search := storage.SavedSearch{
+		ID:        storage.NewID(),
+		Client:    client,
+		Name:      name,
+		Prompt:    req.Prompt,
+		Action:    *action,
+		Interval:  interval,
+		NotifyURL: req.NotifyURL,
+		CreatedAt: now,
+		// Run soon to record what is already listed
+		NextRunAt: now,
+	}
+	if req.Prompt != "" {
+		search.Timezone = dates.TimezoneFromContext(ctx).String()
+	}
+	if err := h.Repo.SaveSearch(ctx, search); err != nil {
+		h.internalError(ctx, w, "Error saving search", err)
+		return
+	}
+
+	w.Header().Set("Location", "/searches/"+search.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(view(search))
+}
+
+// resolve turns a prompt into a Discovery API action the way /promptOpenAI
+// would, location, dates and locale included
+func (h *Handler) resolve(ctx context.Context, prompt string) (*storage.Action, error) {
+	tma, err := h.Director.ResolveSearch(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	if tma == nil {
+		return nil, errors.New("no action resolved")
+	}
+	return &storage.Action{Action: tma.Action, Parameters: tma.Parameters}, nil
+}
+
+// List serves GET /searches
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	searches, err := h.Repo.ListSearches(r.Context(), ratelimit.ClientID(r))
+	if err != nil {
+		h.internalError(r.Context(), w, "Error listing saved searches", err)
+		return
+	}
+	views := make([]SearchView, len(searches))
+	for i, s := range searches {
+		views[i] = view(s)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// Get serves GET /searches/{id}
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	search, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view(search))
+}
+
+// Delete serves DELETE /searches/{id}
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	search, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Repo.DeleteSearch(r.Context(), search.ID); err != nil {
+		h.internalError(r.Context(), w, "Error deleting saved search", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// load fetches the search named in the path, answering 404 if it does not
+// exist or belongs to another client
+func (h *Handler) load(w http.ResponseWriter, r *http.Request) (storage.SavedSearch, bool) {
+	search, ok, err := h.Repo.GetSearch(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.internalError(r.Context(), w, "Error loading saved search", err)
+		return search, false
+	}
+	if !ok || search.Client != ratelimit.ClientID(r) {
+		http.Error(w, "Saved search not found", http.StatusNotFound)
+		return search, false
+	}
+	return search, true
+}
+
+func (h *Handler) internalError(ctx context.Context, w http.ResponseWriter, msg string, err error) {
+	logging.FromContext(ctx).ErrorContext(ctx, msg, "error", err)
+	http.Error(w, "Failed to process saved searches", http.StatusInternalServerError)
+}
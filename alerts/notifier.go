@@ -0,0 +1,143 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go-backend/webhook"
+)
+
+// Alert reports the new events found by one run of a saved search
+type Alert struct {
+	SearchID   string    `json:"search_id"`
+	SearchName string    `json:"search_name"`
+	Events     []Event   `json:"events"`
+	DetectedAt time.Time `json:"detected_at"`
+	// Client and NotifyURL route the alert; they are not part of the payload
+	Client    string `json:"-"`
+	NotifyURL string `json:"-"`
+}
+
+// Notifier delivers alerts. Implementations must be safe for concurrent use.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// LogNotifier writes alerts to the log
+type LogNotifier struct {
+	Logger *slog.Logger
+}
+
+func (n LogNotifier) Notify(ctx context.Context, alert Alert) error {
+	names := make([]string, len(alert.Events))
+	for i, e := range alert.Events {
+		names[i] = e.Name
+	}
+	n.Logger.InfoContext(ctx, "New events for saved search", "search_id", alert.SearchID, "search", alert.SearchName, "client", alert.Client, "count", len(alert.Events), "events", names)
+	return nil
+}
+
+// FileNotifier appends each alert to a JSON Lines file, for local use
+type FileNotifier struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (n *FileNotifier) Notify(ctx context.Context, alert Alert) error {
+	line, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if dir := filepath.Dir(n.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WebhookNotifier POSTs alerts, signed, to the saved search's notify URL.
+// Searches without one are skipped.
+type WebhookNotifier struct {
+	Sender *webhook.Sender
+}
+
+func (n WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	if alert.NotifyURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	_, err = n.Sender.Send(ctx, alert.NotifyURL, map[string]string{"X-Search-ID": alert.SearchID}, body)
+	return err
+}
+
+// Multi sends every alert to each of its notifiers, returning their errors joined
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, alert Alert) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, alert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DefaultAlertsFile is where the file notifier writes unless ALERTS_FILE says otherwise
+const DefaultAlertsFile = "data/alerts.jsonl"
+
+// NotifierFromEnv builds the notifiers listed in ALERT_NOTIFIERS, a comma
+// separated list of "log" (the default), "file" (to ALERTS_FILE) and
+// "webhook" (signed with the callback settings in sender)
+func NotifierFromEnv(logger *slog.Logger, sender *webhook.Sender) (Notifier, error) {
+	names := os.Getenv("ALERT_NOTIFIERS")
+	if names == "" {
+		names = "log"
+	}
+
+	var notifiers Multi
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "log":
+			notifiers = append(notifiers, LogNotifier{Logger: logger})
+		case "file":
+			path := os.Getenv("ALERTS_FILE")
+			if path == "" {
+				path = DefaultAlertsFile
+			}
+			notifiers = append(notifiers, &FileNotifier{Path: path})
+		case "webhook":
+			if sender == nil {
+				return nil, fmt.Errorf("webhook notifier: %w", webhook.ErrDisabled)
+			}
+			notifiers = append(notifiers, WebhookNotifier{Sender: sender})
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown notifier %q", name)
+		}
+	}
+	return notifiers, nil
+}
@@ -0,0 +1,206 @@
+package alerts
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-backend/dates"
+	"go-backend/factories"
+	"go-backend/logging"
+	"go-backend/metrics"
+	"go-backend/storage"
+)
+
+// Config holds the saved search settings
+type Config struct {
+	// Poll is how often the scheduler looks for searches that are due
+	Poll time.Duration
+	// DefaultInterval is how often a search runs if its owner does not say
+	DefaultInterval time.Duration
+	// MinInterval is the shortest interval a search may ask for
+	MinInterval time.Duration
+	// MaxPerClient bounds the searches one client may save
+	MaxPerClient int
+}
+
+// ConfigFromEnv reads the SAVED_SEARCH_* settings, falling back to defaults
+// for anything unset or invalid
+func ConfigFromEnv() Config {
+	cfg := Config{Poll: time.Minute, DefaultInterval: time.Hour, MinInterval: 15 * time.Minute, MaxPerClient: 20}
+	if d, err := time.ParseDuration(os.Getenv("SAVED_SEARCH_POLL")); err == nil && d > 0 {
+		cfg.Poll = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("SAVED_SEARCH_INTERVAL")); err == nil && d > 0 {
+		cfg.DefaultInterval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("SAVED_SEARCH_MIN_INTERVAL")); err == nil && d > 0 {
+		cfg.MinInterval = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("SAVED_SEARCH_MAX_PER_CLIENT")); err == nil && n > 0 {
+		cfg.MaxPerClient = n
+	}
+	if cfg.DefaultInterval < cfg.MinInterval {
+		cfg.DefaultInterval = cfg.MinInterval
+	}
+	return cfg
+}
+
+// Scheduler re-runs saved searches when they are due and sends an alert for
+// any events not seen on earlier runs. The first run of a search only records
+// what is already listed.
+type Scheduler struct {
+	cfg      Config
+	repo     storage.Repository
+	search   Searcher
+	notifier Notifier
+	logger   *slog.Logger
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler; call Start to begin polling
+func NewScheduler(cfg Config, repo storage.Repository, search Searcher, notifier Notifier, logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		cfg:      cfg,
+		repo:     repo,
+		search:   search,
+		notifier: notifier,
+		logger:   logger,
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start polls for due searches until Shutdown is called
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.cfg.Poll)
+		defer ticker.Stop()
+		for {
+			s.runDue()
+			select {
+			case <-s.quit:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Shutdown stops polling and waits for the run in progress, if any, to
+// finish or ctx to expire
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	close(s.quit)
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runDue runs every search that is due, one at a time
+func (s *Scheduler) runDue() {
+	ctx := logging.NewContext(context.Background(), s.logger)
+	due, err := s.repo.DueSearches(ctx, time.Now())
+	if err != nil {
+		s.logger.Error("Error loading due saved searches", "error", err)
+		return
+	}
+	for _, search := range due {
+		select {
+		case <-s.quit:
+			return
+		default:
+		}
+		s.run(ctx, search)
+	}
+}
+
+// runAction is the action to run search with at now. Dates its prompt gave
+// relative to when it was made, like "this weekend", are worked out again
+// so the search follows them rather than staying on the dates it was saved
+// with. Other actions are run as saved.
+func runAction(search storage.SavedSearch, now time.Time) storage.Action {
+	if search.Prompt == "" || search.Action.Action != SearchAction {
+		return search.Action
+	}
+	tz, err := dates.LoadTimezone(search.Timezone)
+	if err != nil {
+		tz = dates.DefaultTimezone()
+	}
+	r, ok := dates.Parse(search.Prompt, now, tz)
+	if !ok {
+		return search.Action
+	}
+
+	action := storage.Action{Action: search.Action.Action, Parameters: make(map[string]string, len(search.Action.Parameters)+2)}
+	for k, v := range search.Action.Parameters {
+		action.Parameters[k] = v
+	}
+	action.Parameters["startDateTime"], action.Parameters["endDateTime"] = factories.TicketmasterRange(r)
+	return action
+}
+
+// run re-runs one search, records the events it found and reports new ones
+func (s *Scheduler) run(ctx context.Context, search storage.SavedSearch) {
+	logger := s.logger.With("search_id", search.ID)
+	ctx = logging.NewContext(ctx, logger)
+
+	firstRun := search.LastRunAt == nil
+	events, err := s.search(ctx, runAction(search, dates.Now()))
+	metrics.ObserveSearchRun(err)
+
+	now := time.Now().UTC()
+	search.NextRunAt = now.Add(search.Interval)
+
+	// A failed run leaves LastRunAt alone, so a failed first run does not
+	// turn the next one into an alert for everything already listed
+	var fresh []Event
+	if err != nil {
+		logger.WarnContext(ctx, "Saved search failed", "error", err)
+		search.LastError = err.Error()
+	} else {
+		fresh, search.SeenIDs = newEvents(events, search.SeenIDs)
+		search.LastRunAt = &now
+		search.LastError = ""
+	}
+
+	// The owner may have deleted the search while it ran
+	if _, ok, err := s.repo.GetSearch(ctx, search.ID); err != nil || !ok {
+		return
+	}
+	if err := s.repo.SaveSearch(ctx, search); err != nil {
+		logger.ErrorContext(ctx, "Error saving search state", "error", err)
+		return
+	}
+
+	logger.InfoContext(ctx, "Saved search ran", "events", len(events), "new", len(fresh), "first_run", firstRun)
+	if firstRun || len(fresh) == 0 {
+		return
+	}
+
+	err = s.notifier.Notify(ctx, Alert{
+		SearchID:   search.ID,
+		SearchName: search.Name,
+		Events:     fresh,
+		DetectedAt: now,
+		Client:     search.Client,
+		NotifyURL:  search.NotifyURL,
+	})
+	metrics.ObserveAlert(err)
+	if err != nil {
+		logger.WarnContext(ctx, "Error sending alert", "error", err)
+	}
+}
@@ -0,0 +1,85 @@
+package alerts
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go-backend/storage"
+)
+
+func TestRunAction(t *testing.T) {
+	saved := map[string]string{
+		"keyword":       "jazz",
+		"startDateTime": "2026-10-16T22:00:00Z",
+		"endDateTime":   "2026-10-19T04:59:59Z",
+	}
+	// Two weeks after the search was saved, on a Wednesday
+	now := time.Date(2026, time.October, 28, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		search storage.SavedSearch
+		want   map[string]string
+	}{
+		{
+			name: "relative dates follow the run",
+			search: storage.SavedSearch{
+				Prompt:   "jazz this weekend",
+				Timezone: "America/Chicago",
+				Action:   storage.Action{Action: SearchAction, Parameters: saved},
+			},
+			want: map[string]string{
+				"keyword":       "jazz",
+				"startDateTime": "2026-10-30T22:00:00Z",
+				"endDateTime":   "2026-11-02T05:59:59Z",
+			},
+		},
+		{
+			name: "unknown timezone uses the default",
+			search: storage.SavedSearch{
+				Prompt:   "jazz tomorrow",
+				Timezone: "Mars/Olympus",
+				Action:   storage.Action{Action: SearchAction, Parameters: map[string]string{"keyword": "jazz"}},
+			},
+			want: map[string]string{
+				"keyword":       "jazz",
+				"startDateTime": "2026-10-29T00:00:00Z",
+				"endDateTime":   "2026-10-29T23:59:59Z",
+			},
+		},
+		{
+			name: "prompt without dates",
+			search: storage.SavedSearch{
+				Prompt: "jazz in Chicago",
+				Action: storage.Action{Action: SearchAction, Parameters: map[string]string{"keyword": "jazz", "city": "Chicago"}},
+			},
+			want: map[string]string{"keyword": "jazz", "city": "Chicago"},
+		},
+		{
+			name:   "saved action",
+			search: storage.SavedSearch{Action: storage.Action{Action: SearchAction, Parameters: saved}},
+			want:   saved,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DEFAULT_TIMEZONE", "")
+			before := make(map[string]string)
+			for k, v := range tt.search.Action.Parameters {
+				before[k] = v
+			}
+
+			got := runAction(tt.search, now)
+			if got.Action != SearchAction {
+				t.Errorf("action = %q, want %q", got.Action, SearchAction)
+			}
+			if !reflect.DeepEqual(got.Parameters, tt.want) {
+				t.Errorf("parameters = %v, want %v", got.Parameters, tt.want)
+			}
+			if !reflect.DeepEqual(tt.search.Action.Parameters, before) {
+				t.Errorf("saved parameters changed to %v", tt.search.Action.Parameters)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Package batch runs many prompts through the ServiceDirector pipeline with
+// bounded concurrency. Identical upstream calls made for different prompts in
+// a batch are only sent once (see package dedup).
+package batch
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"go-backend/dedup"
+	"go-backend/factories"
+	"go-backend/usage"
+)
+
+// Item is one prompt in a batch
+type Item struct {
+	// ID is the caller's reference for the prompt, echoed in its result
+	ID     string `json:"id,omitempty"`
+	Prompt string `json:"prompt"`
+}
+
+// Result is the outcome of one prompt in a batch
+type Result struct {
+	// Index is the prompt's position in the batch
+	Index     int                         `json:"index"`
+	ID        string                      `json:"id,omitempty"`
+	Status    int                         `json:"status"`
+	Responses []factories.ServiceResponse `json:"responses,omitempty"`
+	Error     string                      `json:"error,omitempty"`
+	// Cancelled is set for prompts the batch was cancelled before starting
+	Cancelled bool          `json:"cancelled,omitempty"`
+	Usage     usage.Summary `json:"usage"`
+}
+
+// Stats summarizes a finished batch
+type Stats struct {
+	Prompts int `json:"prompts"`
+	// Failed counts the prompts with an error, cancelled ones included
+	Failed    int           `json:"failed"`
+	Cancelled int           `json:"cancelled"`
+	Usage     usage.Summary `json:"usage"`
+	Upstream  dedup.Stats   `json:"upstream"`
+}
+
+// Config holds the batch settings
+type Config struct {
+	// Concurrency is how many prompts of a batch run at once
+	Concurrency int
+	// MaxItems is the most prompts accepted in one batch over HTTP
+	MaxItems int
+	// MaxSyncItems is the most prompts answered in the response itself;
+	// larger batches must be sent as async jobs so they outlast the
+	// server's write timeout
+	MaxSyncItems int
+}
+
+// ConfigFromEnv reads BATCH_CONCURRENCY, BATCH_MAX_ITEMS and
+// BATCH_MAX_SYNC_ITEMS, falling back to defaults for anything unset or invalid
+func ConfigFromEnv() Config {
+	cfg := Config{Concurrency: 4, MaxItems: 500, MaxSyncItems: 10}
+	if n, err := strconv.Atoi(os.Getenv("BATCH_CONCURRENCY")); err == nil && n > 0 {
+		cfg.Concurrency = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("BATCH_MAX_ITEMS")); err == nil && n > 0 {
+		cfg.MaxItems = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("BATCH_MAX_SYNC_ITEMS")); err == nil && n > 0 {
+		cfg.MaxSyncItems = n
+	}
+	return cfg
+}
+
+// Runner processes batches through a ServiceDirector
+type Runner struct {
+	Director    *factories.ServiceDirector
+	Concurrency int
+}
+
+// Run processes every item, at most r.Concurrency at a time, and calls emit
+// with each result as it completes. Calls to emit are never concurrent. Once
+// ctx is done no more items are started; they are emitted as cancelled.
+func (r *Runner) Run(ctx context.Context, items []Item, emit func(Result)) Stats {
+	ctx, group := dedup.NewContext(ctx)
+
+	concurrency := r.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		stats = Stats{Prompts: len(items)}
+		sem   = make(chan struct{}, concurrency)
+	)
+	for i, item := range items {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			mu.Lock()
+			for j := i; j < len(items); j++ {
+				stats.Failed++
+				stats.Cancelled++
+				emit(cancelled(j, items[j]))
+			}
+			mu.Unlock()
+			break
+		}
+		wg.Add(1)
+		go func(i int, item Item) {
+			defer func() { <-sem; wg.Done() }()
+
+			result := r.runOne(ctx, i, item)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if result.Error != "" {
+				stats.Failed++
+			}
+			addSummary(&stats.Usage, result.Usage)
+			emit(result)
+		}(i, item)
+	}
+	wg.Wait()
+
+	stats.Upstream = group.Stats()
+	return stats
+}
+
+// cancelled is the result of an item the batch never started
+func cancelled(index int, item Item) Result {
+	return Result{
+		Index:     index,
+		ID:        item.ID,
+		Status:    http.StatusServiceUnavailable,
+		Error:     "Batch cancelled before the prompt started",
+		Cancelled: true,
+	}
+}
+
+func (r *Runner) runOne(ctx context.Context, index int, item Item) Result {
+	ctx, ledger := usage.NewContext(ctx)
+
+	result := Result{Index: index, ID: item.ID, Status: http.StatusOK}
+	responses, err := r.Director.Run(ctx, item.Prompt)
+	result.Usage = ledger.Summary()
+	if err != nil {
+		result.Status, result.Error = factories.RunErrorStatus(err)
+		return result
+	}
+	result.Responses = responses
+	return result
+}
+
+func addSummary(total *usage.Summary, s usage.Summary) {
+	total.Calls += s.Calls
+	total.SharedCalls += s.SharedCalls
+	total.PromptTokens += s.PromptTokens
+	total.CompletionTokens += s.CompletionTokens
+	total.TotalTokens += s.TotalTokens
+	total.CostUSD += s.CostUSD
+}
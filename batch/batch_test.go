@@ -0,0 +1,63 @@
+package batch
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"go-backend/factories"
+)
+
+func TestRunCancelled(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test")
+	// Empty prompts are rejected before any upstream call is made
+	items := []Item{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	tests := []struct {
+		name string
+		// cancelAfter cancels the batch once this many results are in; 0
+		// cancels it before it starts
+		cancelAfter   int
+		wantCancelled []bool
+	}{
+		{"cancelled before starting", 0, []bool{true, true, true}},
+		{"cancelled after the first prompt", 1, []bool{false, true, true}},
+		{"never cancelled", 4, []bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelAfter == 0 {
+				cancel()
+			}
+
+			r := &Runner{Director: factories.NewServiceDirector(slog.New(slog.NewTextHandler(io.Discard, nil))), Concurrency: 1}
+			got := make([]bool, len(items))
+			emitted := 0
+			stats := r.Run(ctx, items, func(res Result) {
+				got[res.Index] = res.Cancelled
+				emitted++
+				if emitted == tt.cancelAfter {
+					cancel()
+				}
+			})
+
+			if emitted != len(items) {
+				t.Fatalf("emitted %d results, want %d", emitted, len(items))
+			}
+			wantCount := 0
+			for i, want := range tt.wantCancelled {
+				if got[i] != want {
+					t.Errorf("item %d cancelled = %v, want %v", i, got[i], want)
+				}
+				if want {
+					wantCount++
+				}
+			}
+			if stats.Cancelled != wantCount {
+				t.Errorf("stats.Cancelled = %d, want %d", stats.Cancelled, wantCount)
+			}
+		})
+	}
+}
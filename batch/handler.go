@@ -0,0 +1,115 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"go-backend/jobs"
+	"go-backend/logging"
+)
+
+// JobKind tags batch jobs in the job manager
+const JobKind = "batch"
+
+// Request is the body accepted by the batch endpoint
+type Request struct {
+	Prompts []Item `json:"prompts"`
+	// Async queues the batch as a job and answers 202 with its id at once
+	Async bool `json:"async"`
+	// CallbackURL, for async batches, receives the Response when the job finishes
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// Response is the body returned for a synchronous batch, and the result of
+// an async one. Results are in the order the prompts were sent.
+type Response struct {
+	Results []Result `json:"results"`
+	Stats   Stats    `json:"stats"`
+}
+
+// Handler serves POST /batch
+type Handler struct {
+	Runner       *Runner
+	Jobs         *jobs.Manager
+	MaxItems     int
+	MaxSyncItems int
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Prompts) == 0 {
+		http.Error(w, "At least one prompt is required", http.StatusBadRequest)
+		return
+	}
+	if h.MaxItems > 0 && len(req.Prompts) > h.MaxItems {
+		http.Error(w, fmt.Sprintf("Too many prompts (%d, limit %d)", len(req.Prompts), h.MaxItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if !req.Async && h.MaxSyncItems > 0 && len(req.Prompts) > h.MaxSyncItems {
+		http.Error(w, fmt.Sprintf("Too many prompts to answer at once (%d, limit %d); send async=true", len(req.Prompts), h.MaxSyncItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if req.CallbackURL != "" && !req.Async {
+		http.Error(w, "callback_url requires async", http.StatusBadRequest)
+		return
+	}
+
+	if !req.Async {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.run(r.Context(), req.Prompts, nil))
+		return
+	}
+
+	if req.CallbackURL != "" {
+		if err := h.Jobs.Callbacks().ValidateURL(req.CallbackURL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	job, err := h.Jobs.Submit(r.Context(), JobKind, req.Prompts, len(req.Prompts), req.CallbackURL)
+	if errors.Is(err, jobs.ErrQueueFull) || errors.Is(err, jobs.ErrShuttingDown) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Job queue is full, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).ErrorContext(r.Context(), "Error submitting batch job", "error", err)
+		http.Error(w, "Failed to submit the batch", http.StatusInternalServerError)
+		return
+	}
+	jobs.WriteAccepted(w, job)
+}
+
+// RunJob is the jobs.Handler for async batches
+func (h *Handler) RunJob(ctx context.Context, job jobs.Job, progress func(int)) (interface{}, error) {
+	var items []Item
+	if err := json.Unmarshal(job.Input, &items); err != nil {
+		return nil, fmt.Errorf("error decoding batch: %v", err)
+	}
+	return h.run(ctx, items, progress), nil
+}
+
+// run processes a batch, reporting progress if asked, and returns the
+// results in prompt order
+func (h *Handler) run(ctx context.Context, items []Item, progress func(int)) Response {
+	results := make([]Result, 0, len(items))
+	stats := h.Runner.Run(ctx, items, func(r Result) {
+		results = append(results, r)
+		if progress != nil {
+			progress(len(results))
+		}
+	})
+	sort.Slice(results, func(i, j int) bool { return results[i].Index < results[j].Index })
+	return Response{Results: results, Stats: stats}
+}
@@ -0,0 +1,155 @@
+// Package breaker stops calling an upstream API that keeps failing. After
+// Failures consecutive failures a Breaker opens and turns calls away with
+// ErrOpen; once Cooldown has passed it lets one probe call through, closing
+// again if the probe succeeds and reopening if it fails.
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-backend/metrics"
+)
+
+// State is where a breaker is in its cycle
+type State int
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half_open"
+	default:
+		return "open"
+	}
+}
+
+// ErrOpen is returned by Allow while calls to the upstream are turned away
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Config holds the breaker settings
+type Config struct {
+	// Failures is how many consecutive failures open the breaker
+	Failures int
+	// Cooldown is how long the breaker stays open before a probe call
+	Cooldown time.Duration
+}
+
+// DefaultConfig is used until the environment has been read
+var DefaultConfig = Config{Failures: 5, Cooldown: 30 * time.Second}
+
+// ConfigFromEnv reads BREAKER_FAILURES and BREAKER_COOLDOWN, falling back to
+// DefaultConfig for anything unset or invalid
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig
+	if n, err := strconv.Atoi(os.Getenv("BREAKER_FAILURES")); err == nil && n > 0 {
+		cfg.Failures = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("BREAKER_COOLDOWN")); err == nil && d > 0 {
+		cfg.Cooldown = d
+	}
+	return cfg
+}
+
+// Breaker guards the calls to one upstream. It is safe for concurrent use.
+type Breaker struct {
+	name string
+	cfg  Config
+	now  func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	// probing is set while the half-open probe call is in flight
+	probing bool
+}
+
+// New returns a closed breaker for the upstream called name
+func New(name string, cfg Config) *Breaker {
+	b := &Breaker{name: name, cfg: cfg, now: time.Now}
+	metrics.ObserveBreaker(name, int(Closed))
+	return b
+}
+
+// Allow reports whether a call may go ahead. Every allowed call must be
+// followed by Record or Release.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.cfg.Cooldown {
+		b.setState(HalfOpen)
+	}
+	switch {
+	case b.state == Closed:
+		return nil
+	case b.state == HalfOpen && !b.probing:
+		b.probing = true
+		return nil
+	default:
+		return fmt.Errorf("%s: %w", b.name, ErrOpen)
+	}
+}
+
+// Record reports how an allowed call went
+func (b *Breaker) Record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		b.setState(Closed)
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.cfg.Failures {
+		b.openedAt = b.now()
+		b.setState(Open)
+	}
+}
+
+// Release ends an allowed call that says nothing about the upstream, such as
+// one the client cancelled
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// State returns the breaker's current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.cfg.Cooldown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Err returns ErrOpen while the breaker is turning calls away, for readiness checks
+func (b *Breaker) Err() error {
+	if b.State() == Open {
+		return fmt.Errorf("%s: %w", b.name, ErrOpen)
+	}
+	return nil
+}
+
+func (b *Breaker) setState(s State) {
+	if b.state != s {
+		b.state = s
+		metrics.ObserveBreaker(b.name, int(s))
+	}
+}
@@ -0,0 +1,136 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	cfg := Config{Failures: 2, Cooldown: time.Minute}
+	// Each step is a call made after waiting; failed is only used when the
+	// call was allowed
+	type step struct {
+		wait      time.Duration
+		failed    bool
+		wantAllow bool
+		wantState State
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "successes keep it closed",
+			steps: []step{
+				{wantAllow: true, wantState: Closed},
+				{wantAllow: true, wantState: Closed},
+			},
+		},
+		{
+			name: "consecutive failures open it",
+			steps: []step{
+				{failed: true, wantAllow: true, wantState: Closed},
+				{failed: true, wantAllow: true, wantState: Open},
+				{wait: 30 * time.Second, wantAllow: false, wantState: Open},
+			},
+		},
+		{
+			name: "a success resets the failure count",
+			steps: []step{
+				{failed: true, wantAllow: true, wantState: Closed},
+				{wantAllow: true, wantState: Closed},
+				{failed: true, wantAllow: true, wantState: Closed},
+			},
+		},
+		{
+			name: "a successful probe closes it",
+			steps: []step{
+				{failed: true, wantAllow: true},
+				{failed: true, wantAllow: true, wantState: Open},
+				{wait: time.Minute, wantAllow: true, wantState: Closed},
+			},
+		},
+		{
+			name: "a failed probe reopens it",
+			steps: []step{
+				{failed: true, wantAllow: true},
+				{failed: true, wantAllow: true, wantState: Open},
+				{wait: time.Minute, failed: true, wantAllow: true, wantState: Open},
+				{wait: 30 * time.Second, wantAllow: false, wantState: Open},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC)
+			b := New("test", cfg)
+			b.now = func() time.Time { return now }
+
+			for i, s := range tt.steps {
+				now = now.Add(s.wait)
+				err := b.Allow()
+				if allowed := err == nil; allowed != s.wantAllow {
+					t.Fatalf("step %d: allowed = %v (%v), want %v", i, allowed, err, s.wantAllow)
+				}
+				if err != nil && !errors.Is(err, ErrOpen) {
+					t.Fatalf("step %d: err = %v, want ErrOpen", i, err)
+				}
+				if err == nil {
+					b.Record(s.failed)
+				}
+				if got := b.State(); got != s.wantState {
+					t.Errorf("step %d: state = %v, want %v", i, got, s.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	now := time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC)
+	b := New("test", Config{Failures: 1, Cooldown: time.Minute})
+	b.now = func() time.Time { return now }
+
+	b.Allow()
+	b.Record(true)
+	if err := b.Err(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Err() = %v right after opening, want ErrOpen", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.Err(); err != nil {
+		t.Errorf("Err() = %v once the cooldown has passed, want nil", err)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe not allowed: %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("second call during the probe = %v, want ErrOpen", err)
+	}
+
+	// A cancelled probe lets the next call probe instead
+	b.Release()
+	if err := b.Allow(); err != nil {
+		t.Errorf("call after a released probe = %v, want it allowed", err)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		failures, cooldown string
+		want               Config
+	}{
+		{want: DefaultConfig},
+		{failures: "3", cooldown: "10s", want: Config{Failures: 3, Cooldown: 10 * time.Second}},
+		{failures: "0", cooldown: "-1s", want: DefaultConfig},
+		{failures: "many", cooldown: "soon", want: DefaultConfig},
+	}
+	for _, tt := range tests {
+		t.Setenv("BREAKER_FAILURES", tt.failures)
+		t.Setenv("BREAKER_COOLDOWN", tt.cooldown)
+		if got := ConfigFromEnv(); got != tt.want {
+			t.Errorf("ConfigFromEnv() with %q, %q = %+v, want %+v", tt.failures, tt.cooldown, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Package budget handles prompts with a spending limit, such as "a night out
+// under $200". It finds the limit in the prompt, estimates what each
+// service's activities cost, and combines activities from different services
+// into bundles that fit.
+package budget
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// DefaultCurrency is assumed when a budget does not name its currency
+const DefaultCurrency = "USD"
+
+// ErrInvalidBudget is returned for a budget that is not a positive amount
+// in a three-letter currency
+var ErrInvalidBudget = errors.New("invalid budget")
+
+// Budget is how much the user wants to spend in total
+type Budget struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	// Expr is the part of the prompt the budget was read from, if any
+	Expr string `json:"expr,omitempty"`
+}
+
+// UnmarshalJSON accepts either a bare amount in DefaultCurrency or an
+// object with an amount and currency
+func (b *Budget) UnmarshalJSON(data []byte) error {
+	if len(bytes.TrimSpace(data)) > 0 && bytes.TrimSpace(data)[0] != '{' {
+		var amount float64
+		if err := json.Unmarshal(data, &amount); err != nil {
+			return err
+		}
+		*b = Budget{Amount: amount, Currency: DefaultCurrency}
+		return nil
+	}
+	type plain Budget
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*b = Budget(p)
+	b.Currency = strings.ToUpper(b.Currency)
+	if b.Currency == "" {
+		b.Currency = DefaultCurrency
+	}
+	return nil
+}
+
+// Validate checks the budget can be planned against
+func (b Budget) Validate() error {
+	if b.Amount <= 0 || len(b.Currency) != 3 {
+		return ErrInvalidBudget
+	}
+	return nil
+}
+
+type budgetKey struct{}
+
+// NewContext returns a context carrying the request's budget
+func NewContext(ctx context.Context, b *Budget) context.Context {
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+// FromContext returns the request's budget, or nil if it has none
+func FromContext(ctx context.Context) *Budget {
+	b, _ := ctx.Value(budgetKey{}).(*Budget)
+	return b
+}
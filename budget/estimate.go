@@ -0,0 +1,145 @@
+package budget
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// CostField is the activity field estimates are written to
+const CostField = "estimated_cost"
+
+// Cost is what one activity is estimated to cost one person
+type Cost struct {
+	Low      float64 `json:"low"`
+	High     float64 `json:"high"`
+	Currency string  `json:"currency"`
+}
+
+// Estimator works out an activity's cost from the fields the formatter gave it
+type Estimator func(activity map[string]interface{}) (Cost, bool)
+
+// Estimators are the per-service estimators; services not listed here try
+// each of them in turn
+var Estimators = map[string]Estimator{
+	"Ticketing":      TicketCost,
+	"Restaurants":    MealCost,
+	"Accommodations": StayCost,
+}
+
+// PriceLevels are the typical spend per person at each restaurant price
+// level, from $ to $$$$
+var PriceLevels = map[int]Cost{
+	1: {Low: 10, High: 25},
+	2: {Low: 25, High: 50},
+	3: {Low: 50, High: 100},
+	4: {Low: 100, High: 200},
+}
+
+// Estimate returns the estimated cost of an activity of service
+func Estimate(service string, activity map[string]interface{}) (Cost, bool) {
+	if e, ok := Estimators[service]; ok {
+		return e(activity)
+	}
+	for _, e := range []Estimator{TicketCost, MealCost, StayCost} {
+		if c, ok := e(activity); ok {
+			return c, true
+		}
+	}
+	return Cost{}, false
+}
+
+// TicketCost is the activity's ticket price range
+func TicketCost(activity map[string]interface{}) (Cost, bool) {
+	lo, loOK := number(activity["price_min"])
+	hi, hiOK := number(activity["price_max"])
+	switch {
+	case !loOK && !hiOK:
+		return Cost{}, false
+	case !loOK:
+		lo = hi
+	case !hiOK:
+		hi = lo
+	}
+	return Cost{Low: lo, High: hi, Currency: currency(activity)}, true
+}
+
+// MealCost is the typical spend per person at the activity's price level,
+// given as "$$" or 2
+func MealCost(activity map[string]interface{}) (Cost, bool) {
+	var level int
+	switch v := activity["price_level"].(type) {
+	case float64:
+		level = int(v)
+	case string:
+		if strings.Trim(v, "$") == "" {
+			level = len(v)
+		} else {
+			level, _ = strconv.Atoi(v)
+		}
+	}
+	c, ok := PriceLevels[level]
+	if !ok {
+		return Cost{}, false
+	}
+	c.Currency = currency(activity)
+	return c, true
+}
+
+// StayCost is the activity's nightly rate times its number of nights,
+// one if it does not say
+func StayCost(activity map[string]interface{}) (Cost, bool) {
+	rate, ok := number(activity["nightly_rate"])
+	if !ok {
+		return Cost{}, false
+	}
+	nights, ok := number(activity["nights"])
+	if !ok || nights < 1 {
+		nights = 1
+	}
+	return Cost{Low: rate * nights, High: rate * nights, Currency: currency(activity)}, true
+}
+
+// Annotate adds each activity's estimated cost when the request has a
+// budget, and drops those that cost more than the whole budget on their
+// own. Activities whose cost is unknown or in another currency are kept.
+func Annotate(ctx context.Context, service string, activities []interface{}) []interface{} {
+	b := FromContext(ctx)
+	if b == nil {
+		return activities
+	}
+	out := make([]interface{}, 0, len(activities))
+	for _, a := range activities {
+		if activity, ok := a.(map[string]interface{}); ok {
+			if c, ok := Estimate(service, activity); ok {
+				if c.Currency == b.Currency && c.Low > b.Amount {
+					continue
+				}
+				activity[CostField] = c
+			}
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// currency is the activity's currency, or DefaultCurrency
+func currency(activity map[string]interface{}) string {
+	if c, ok := activity["currency"].(string); ok && len(c) == 3 {
+		return strings.ToUpper(c)
+	}
+	return DefaultCurrency
+}
+
+// number reads a value the formatter may have written as a number or a
+// string, ignoring currency symbols and thousands separators
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(strings.NewReplacer("$", "", "€", "", "£", "", ",", "").Replace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
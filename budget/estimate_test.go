@@ -0,0 +1,165 @@
+package budget
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		name     string
+		service  string
+		activity map[string]interface{}
+		want     Cost
+		ok       bool
+	}{
+		{"ticket range", "Ticketing", map[string]interface{}{"price_min": 45.0, "price_max": 120.0}, Cost{45, 120, "USD"}, true},
+		{"ticket minimum only", "Ticketing", map[string]interface{}{"price_min": "$45"}, Cost{45, 45, "USD"}, true},
+		{"ticket maximum only", "Ticketing", map[string]interface{}{"price_max": "1,250.50", "currency": "eur"}, Cost{1250.5, 1250.5, "EUR"}, true},
+		{"ticket without prices", "Ticketing", map[string]interface{}{"price_min": "free"}, Cost{}, false},
+		{"meal as dollar signs", "Restaurants", map[string]interface{}{"price_level": "$$"}, Cost{25, 50, "USD"}, true},
+		{"meal as a number", "Restaurants", map[string]interface{}{"price_level": 4.0}, Cost{100, 200, "USD"}, true},
+		{"meal as a numeric string", "Restaurants", map[string]interface{}{"price_level": "1", "currency": "GBP"}, Cost{10, 25, "GBP"}, true},
+		{"meal off the scale", "Restaurants", map[string]interface{}{"price_level": "$$$$$"}, Cost{}, false},
+		{"stay for several nights", "Accommodations", map[string]interface{}{"nightly_rate": 150.0, "nights": 3.0}, Cost{450, 450, "USD"}, true},
+		{"stay without nights", "Accommodations", map[string]interface{}{"nightly_rate": "$99"}, Cost{99, 99, "USD"}, true},
+		{"stay with zero nights", "Accommodations", map[string]interface{}{"nightly_rate": 99.0, "nights": 0.0}, Cost{99, 99, "USD"}, true},
+		// A service's own estimator is the only one tried
+		{"service ignores other fields", "Ticketing", map[string]interface{}{"price_level": "$$"}, Cost{}, false},
+		// Other services try each estimator in turn
+		{"unknown service", "Tours", map[string]interface{}{"nightly_rate": 80.0}, Cost{80, 80, "USD"}, true},
+		{"unknown service without costs", "Tours", map[string]interface{}{"name": "x"}, Cost{}, false},
+		{"currency that is not a code", "Ticketing", map[string]interface{}{"price_min": 10.0, "currency": "dollars"}, Cost{10, 10, "USD"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Estimate(tt.service, tt.activity)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Estimate = %+v, %v; want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	activities := func() []interface{} {
+		return []interface{}{
+			map[string]interface{}{"name": "cheap", "price_min": 20.0, "price_max": 40.0},
+			map[string]interface{}{"name": "too dear", "price_min": 250.0},
+			map[string]interface{}{"name": "unknown"},
+			map[string]interface{}{"name": "other currency", "price_min": 900.0, "currency": "EUR"},
+			"not an activity",
+		}
+	}
+	tests := []struct {
+		name      string
+		budget    *Budget
+		wantNames []string
+		wantCosts int
+	}{
+		{"no budget", nil, []string{"cheap", "too dear", "unknown", "other currency", ""}, 0},
+		{"drops what costs more than the budget", &Budget{Amount: 200, Currency: "USD"}, []string{"cheap", "unknown", "other currency", ""}, 2},
+		{"keeps what the budget covers", &Budget{Amount: 250, Currency: "USD"}, []string{"cheap", "too dear", "unknown", "other currency", ""}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.budget != nil {
+				ctx = NewContext(ctx, tt.budget)
+			}
+			out := Annotate(ctx, "Ticketing", activities())
+			if len(out) != len(tt.wantNames) {
+				t.Fatalf("got %d activities, want %d: %v", len(out), len(tt.wantNames), out)
+			}
+			costs := 0
+			for i, a := range out {
+				activity, _ := a.(map[string]interface{})
+				if name, _ := activity["name"].(string); name != tt.wantNames[i] {
+					t.Errorf("activity %d = %q, want %q", i, name, tt.wantNames[i])
+				}
+				if _, ok := activity[CostField]; ok {
+					costs++
+				}
+			}
+			if costs != tt.wantCosts {
+				t.Errorf("%d activities have a cost, want %d", costs, tt.wantCosts)
+			}
+		})
+	}
+}
+
+func TestCombine(t *testing.T) {
+	priced := func(name string, low, high float64) map[string]interface{} {
+		return map[string]interface{}{"name": name, CostField: Cost{Low: low, High: high, Currency: "USD"}}
+	}
+	services := []Candidates{
+		{Service: "Ticketing", Activities: []interface{}{priced("show", 80, 120), priced("gig", 30, 30)}},
+		{Service: "Restaurants", Activities: []interface{}{priced("bistro", 50, 100), map[string]interface{}{"name": "unpriced"}}},
+	}
+	tests := []struct {
+		name   string
+		budget Budget
+		// want lists each bundle's activity names. Bundles with more items
+		// come first, then better ranked, then cheaper ones.
+		want [][]string
+	}{
+		{"everything fits", Budget{Amount: 200, Currency: "USD"}, [][]string{
+			{"show", "bistro"}, {"gig", "bistro"}, {"bistro"}, {"show"}, {"gig"},
+		}},
+		{"only some pairs fit", Budget{Amount: 100, Currency: "USD"}, [][]string{
+			{"gig", "bistro"}, {"bistro"}, {"show"}, {"gig"},
+		}},
+		{"nothing fits", Budget{Amount: 10, Currency: "USD"}, [][]string{}},
+		{"other currency", Budget{Amount: 500, Currency: "EUR"}, [][]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := Combine(tt.budget, services)
+			if plan.Budget != tt.budget {
+				t.Errorf("plan budget = %+v, want %+v", plan.Budget, tt.budget)
+			}
+			if len(plan.Bundles) != len(tt.want) {
+				t.Fatalf("got %d bundles, want %d", len(plan.Bundles), len(tt.want))
+			}
+			for i, bundle := range plan.Bundles {
+				var names []string
+				for _, item := range bundle.Items {
+					names = append(names, item.Activity.(map[string]interface{})["name"].(string))
+				}
+				if len(names) != len(tt.want[i]) {
+					t.Errorf("bundle %d = %v, want %v", i, names, tt.want[i])
+					continue
+				}
+				for j := range names {
+					if names[j] != tt.want[i][j] {
+						t.Errorf("bundle %d = %v, want %v", i, names, tt.want[i])
+						break
+					}
+				}
+				if bundle.Total.Low > tt.budget.Amount || bundle.Remaining != tt.budget.Amount-bundle.Total.Low {
+					t.Errorf("bundle %d total %+v, remaining %v over a budget of %v", i, bundle.Total, bundle.Remaining, tt.budget.Amount)
+				}
+			}
+		})
+	}
+}
+
+func TestBudgetUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    Budget
+		wantErr bool
+	}{
+		{json: `150`, want: Budget{Amount: 150, Currency: "USD"}},
+		{json: `{"amount": 80, "currency": "gbp"}`, want: Budget{Amount: 80, Currency: "GBP"}},
+		{json: `{"amount": 80}`, want: Budget{Amount: 80, Currency: "USD"}},
+		{json: `"150"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var got Budget
+		err := got.UnmarshalJSON([]byte(tt.json))
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("UnmarshalJSON(%s) = %+v, %v; want %+v, error %v", tt.json, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package budget
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// amount matches "$200", "€ 50", "1,500", "1.5k", optionally followed by a
+// currency word or code
+const amount = `([$€£])?\s?(\d[\d,]*(?:\.\d+)?)(k)?(?:\s?(dollars|bucks|usd|euros?|eur|pounds|quid|gbp|cad|aud))?`
+
+var (
+	// "under $200", "no more than 150 euros", "a budget of $80"
+	limitBefore = regexp.MustCompile(`\b(?:under|below|less than|no more than|not more than|at most|up to|max(?:imum)?(?: of)?|within|budget(?: of| is)?|cap of)\s+` + amount)
+	// "$200 budget", "100 dollars or less", "$50 max"
+	limitAfter = regexp.MustCompile(amount + `\s+(?:budget|or less|or under|max(?:imum)?|tops|total)\b`)
+)
+
+var currencies = map[string]string{
+	"$": "USD", "€": "EUR", "£": "GBP",
+	"dollars": "USD", "bucks": "USD", "usd": "USD",
+	"euro": "EUR", "euros": "EUR", "eur": "EUR",
+	"pounds": "GBP", "quid": "GBP", "gbp": "GBP",
+	"cad": "CAD", "aud": "AUD",
+}
+
+// countNouns follow numbers that count something other than money, as in
+// "budget 4 star hotel" or "a budget of 3 nights"
+var countNouns = regexp.MustCompile(`^[\s-]*(stars?|nights?|days?|weeks?|people|persons?|guests?|adults?|kids|children|tickets?|seats?|rooms?|beds?|hours?|hrs?|minutes?|mins?|miles?|mi|km|blocks?|pm|am|o'clock)\b`)
+
+// explicitBudget is the only phrasing a number without a currency counts
+// as money after
+var explicitBudget = regexp.MustCompile(`^budget (of|is)\s`)
+
+// Parse finds a spending limit in text. An amount on its own is not a
+// budget: it needs a word like "under" or "budget" next to it, and a
+// currency symbol or word, unless it directly follows "budget of" or
+// "budget is" and does not count something else ("budget of 3 nights").
+func Parse(text string) (Budget, bool) {
+	lower := strings.ToLower(text)
+	for _, re := range []*regexp.Regexp{limitBefore, limitAfter} {
+		for _, m := range re.FindAllStringSubmatchIndex(lower, -1) {
+			b, ok := budgetFrom(lower, m)
+			if ok {
+				return b, true
+			}
+		}
+	}
+	return Budget{}, false
+}
+
+func budgetFrom(text string, m []int) (Budget, bool) {
+	group := func(i int) string {
+		if m[2*i] < 0 {
+			return ""
+		}
+		return text[m[2*i]:m[2*i+1]]
+	}
+	expr := strings.TrimSpace(group(0))
+	symbol, digits, thousands, word := group(1), group(2), group(3), group(4)
+
+	currency := currencies[symbol]
+	if c, ok := currencies[word]; ok {
+		currency = c
+	}
+	// "under 21" is an age, "within 5 miles" a distance and "budget 4 star
+	// hotel" a rating, but "a budget of 300" is money
+	if currency == "" {
+		if !explicitBudget.MatchString(expr) || countNouns.MatchString(text[m[1]:]) {
+			return Budget{}, false
+		}
+		currency = DefaultCurrency
+	}
+
+	n, err := strconv.ParseFloat(strings.ReplaceAll(digits, ",", ""), 64)
+	if err != nil || n <= 0 {
+		return Budget{}, false
+	}
+	if thousands != "" {
+		n *= 1000
+	}
+	return Budget{Amount: n, Currency: currency, Expr: expr}, true
+}
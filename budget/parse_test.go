@@ -0,0 +1,42 @@
+package budget
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		want Budget
+		ok   bool
+	}{
+		{"concerts under $200", Budget{Amount: 200, Currency: "USD", Expr: "under $200"}, true},
+		{"no more than 150 euros for dinner", Budget{Amount: 150, Currency: "EUR", Expr: "no more than 150 euros"}, true},
+		{"a weekend in London, £80 max", Budget{Amount: 80, Currency: "GBP", Expr: "£80 max"}, true},
+		{"up to 1.5k usd", Budget{Amount: 1500, Currency: "USD", Expr: "up to 1.5k usd"}, true},
+		{"hotels within 1,200 dollars", Budget{Amount: 1200, Currency: "USD", Expr: "within 1,200 dollars"}, true},
+		{"$300 budget for the weekend", Budget{Amount: 300, Currency: "USD", Expr: "$300 budget"}, true},
+		{"a budget of 300 for a concert", Budget{Amount: 300, Currency: "USD", Expr: "budget of 300"}, true},
+		{"my budget is 250", Budget{Amount: 250, Currency: "USD", Expr: "budget is 250"}, true},
+		{"budget of 40 cad", Budget{Amount: 40, Currency: "CAD", Expr: "budget of 40 cad"}, true},
+
+		// Numbers that are not money
+		{"budget 4 star hotel", Budget{}, false},
+		{"cheap budget 3 nights in vegas", Budget{}, false},
+		{"a budget of 3 nights in vegas", Budget{}, false},
+		{"budget of 4-star hotels", Budget{}, false},
+		{"my budget is 20 people", Budget{}, false},
+		{"300 budget", Budget{}, false},
+		{"clubs for under 21", Budget{}, false},
+		{"restaurants within 5 miles", Budget{}, false},
+		{"up to 4 tickets", Budget{}, false},
+		{"concerts this weekend", Budget{}, false},
+		{"under $0", Budget{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, ok := Parse(tt.text)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Parse(%q) = %+v, %v; want %+v, %v", tt.text, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package budget
+
+import "sort"
+
+// ServiceName is what the plan is listed as among the service responses
+const ServiceName = "Budget"
+
+const (
+	// MaxBundles is how many bundles a plan offers
+	MaxBundles = 10
+	// MaxPerService is how many of each service's activities, in ranked
+	// order, are combined
+	MaxPerService = 5
+)
+
+// Candidates are the activities one service returned, best first
+type Candidates struct {
+	Service    string
+	Activities []interface{}
+}
+
+// Item is one activity in a bundle. Its cost is the activity's CostField.
+type Item struct {
+	Service  string      `json:"service"`
+	Activity interface{} `json:"activity"`
+}
+
+// Bundle is a set of activities, at most one per service, that fits the
+// budget. Total.Low is within the budget; Total.High may not be.
+type Bundle struct {
+	Items     []Item  `json:"items"`
+	Total     Cost    `json:"total"`
+	Remaining float64 `json:"remaining"`
+}
+
+// Plan is the budget and the bundles that fit it
+type Plan struct {
+	Budget  Budget   `json:"budget"`
+	Bundles []Bundle `json:"bundles"`
+}
+
+// Combine builds the bundles of activities that fit b. Only activities with
+// an estimated cost in the budget's currency take part. Bundles covering
+// more services come first, then those made of better ranked activities.
+func Combine(b Budget, services []Candidates) Plan {
+	type option struct {
+		item Item
+		cost Cost
+		rank int
+	}
+	var choices [][]option
+	for _, s := range services {
+		var opts []option
+		for rank, a := range s.Activities {
+			activity, ok := a.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			c, ok := activity[CostField].(Cost)
+			if !ok || c.Currency != b.Currency || c.Low > b.Amount {
+				continue
+			}
+			opts = append(opts, option{item: Item{Service: s.Service, Activity: activity}, cost: c, rank: rank})
+			if len(opts) == MaxPerService {
+				break
+			}
+		}
+		if len(opts) > 0 {
+			choices = append(choices, opts)
+		}
+	}
+
+	type candidate struct {
+		bundle  Bundle
+		rankSum int
+	}
+	var found []candidate
+
+	// Each service contributes one of its options or none
+	var walk func(i int, items []Item, low, high float64, rankSum int)
+	walk = func(i int, items []Item, low, high float64, rankSum int) {
+		if i == len(choices) {
+			if len(items) > 0 {
+				found = append(found, candidate{
+					bundle: Bundle{
+						Items:     append([]Item(nil), items...),
+						Total:     Cost{Low: low, High: high, Currency: b.Currency},
+						Remaining: b.Amount - low,
+					},
+					rankSum: rankSum,
+				})
+			}
+			return
+		}
+		walk(i+1, items, low, high, rankSum)
+		for _, o := range choices[i] {
+			if low+o.cost.Low > b.Amount {
+				continue
+			}
+			walk(i+1, append(items, o.item), low+o.cost.Low, high+o.cost.High, rankSum+o.rank)
+		}
+	}
+	walk(0, nil, 0, 0, 0)
+
+	sort.SliceStable(found, func(i, j int) bool {
+		a, c := found[i], found[j]
+		if len(a.bundle.Items) != len(c.bundle.Items) {
+			return len(a.bundle.Items) > len(c.bundle.Items)
+		}
+		if a.rankSum != c.rankSum {
+			return a.rankSum < c.rankSum
+		}
+		return a.bundle.Total.Low < c.bundle.Total.Low
+	})
+
+	plan := Plan{Budget: b, Bundles: []Bundle{}}
+	for i := 0; i < len(found) && i < MaxBundles; i++ {
+		plan.Bundles = append(plan.Bundles, found[i].bundle)
+	}
+	return plan
+}
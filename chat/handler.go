@@ -0,0 +1,465 @@
+// Package chat serves the ServiceDirector over a WebSocket for chat-style
+// clients. Each connection is a session: the client sends prompts as JSON
+// messages and gets the classifier's rankings, each service's progress and
+// results, and clarifying questions back as typed messages (see
+// messages.go). Options and what earlier prompts resolved to carry over
+// from one prompt to the next.
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-backend/factories"
+	"go-backend/locale"
+	"go-backend/logging"
+	"go-backend/ratelimit"
+	"go-backend/storage"
+	"go-backend/usage"
+
+	"github.com/gorilla/websocket"
+)
+
+// Config holds the WebSocket settings
+type Config struct {
+	// AllowedOrigins are the browser origins that may connect, or "*" for
+	// any. With none, only pages served from the API's own host may.
+	AllowedOrigins []string
+	// PingInterval is how often the server pings an idle client; a client
+	// that has not answered by the next ping is disconnected
+	PingInterval time.Duration
+	// MaxMessageBytes is the largest message a client may send
+	MaxMessageBytes int64
+}
+
+// ConfigFromEnv reads the settings from CHAT_ALLOWED_ORIGINS (comma
+// separated), CHAT_PING_INTERVAL and CHAT_MAX_MESSAGE_BYTES, falling back
+// to defaults for anything unset or invalid
+func ConfigFromEnv() Config {
+	cfg := Config{
+		PingInterval:    30 * time.Second,
+		MaxMessageBytes: 64 << 10,
+	}
+	for _, origin := range strings.Split(os.Getenv("CHAT_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.AllowedOrigins = append(cfg.AllowedOrigins, origin)
+		}
+	}
+	if d, err := time.ParseDuration(os.Getenv("CHAT_PING_INTERVAL")); err == nil && d > 0 {
+		cfg.PingInterval = d
+	}
+	if n, err := strconv.ParseInt(os.Getenv("CHAT_MAX_MESSAGE_BYTES"), 10, 64); err == nil && n > 0 {
+		cfg.MaxMessageBytes = n
+	}
+	return cfg
+}
+
+// errConnClosed stops a run whose client has gone
+var errConnClosed = errors.New("connection closed")
+
+// writeTimeout bounds each write to a client
+const writeTimeout = 10 * time.Second
+
+// outboxSize is how many messages may wait for a slow client before the
+// run producing them waits too
+const outboxSize = 32
+
+// Handler upgrades requests to WebSocket sessions. The upgrade request
+// goes through the API middleware like any other; every prompt after it is
+// rate limited and charged to the same client.
+type Handler struct {
+	director *factories.ServiceDirector
+	limiter  *ratelimit.Limiter
+	quotas   *ratelimit.Quotas
+	logger   *slog.Logger
+	cfg      Config
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	conns    map[*conn]struct{}
+	closing  bool
+	sessions sync.WaitGroup
+}
+
+// NewHandler creates a handler running prompts with sd
+func NewHandler(cfg Config, sd *factories.ServiceDirector, limiter *ratelimit.Limiter, quotas *ratelimit.Quotas, logger *slog.Logger) *Handler {
+	h := &Handler{
+		director: sd,
+		limiter:  limiter,
+		quotas:   quotas,
+		logger:   logger,
+		cfg:      cfg,
+		conns:    make(map[*conn]struct{}),
+	}
+	h.upgrader.CheckOrigin = h.checkOrigin
+	return h
+}
+
+// checkOrigin allows clients that are not browsers, which send no Origin,
+// and the configured origins, or with none, pages from the API's own host
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(h.cfg.AllowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, allowed := range h.cfg.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	if h.closing {
+		h.mu.Unlock()
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	h.sessions.Add(1)
+	h.mu.Unlock()
+	defer h.sessions.Done()
+
+	// The upgrader answers failed handshakes itself
+	ws, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	c := &conn{
+		handler:  h,
+		ws:       ws,
+		session:  &Session{ID: storage.NewID()},
+		clientID: ratelimit.ClientID(r),
+		accepted: locale.ParseAcceptLanguage(r.Header.Get("Accept-Language")),
+		ctx:      ctx,
+		cancel:   cancel,
+		outbox:   make(chan ServerMessage, outboxSize),
+		closed:   make(chan struct{}),
+	}
+	h.mu.Lock()
+	h.conns[c] = struct{}{}
+	h.mu.Unlock()
+
+	h.logger.InfoContext(ctx, "Chat session opened", "session", c.session.ID)
+	c.serve()
+	h.logger.InfoContext(ctx, "Chat session closed", "session", c.session.ID)
+
+	h.mu.Lock()
+	delete(h.conns, c)
+	h.mu.Unlock()
+}
+
+// Shutdown stops accepting sessions, tells every client the server is
+// going away and waits for their sessions to end. Sessions still open when
+// ctx is done are dropped.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.closing = true
+	conns := make([]*conn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range conns {
+		c.goAway()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.sessions.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, c := range conns {
+			c.ws.Close()
+		}
+		return ctx.Err()
+	}
+}
+
+// conn is one client's session. Messages are read on the handler's
+// goroutine, prompts run one at a time on their own, and everything sent
+// goes through the outbox to a single writer.
+type conn struct {
+	handler  *Handler
+	ws       *websocket.Conn
+	session  *Session
+	clientID string
+	accepted []locale.Locale
+
+	// ctx is cancelled when the connection closes
+	ctx    context.Context
+	cancel context.CancelFunc
+	outbox chan ServerMessage
+	// closed is closed once the writer has stopped
+	closed chan struct{}
+
+	mu sync.Mutex
+	// cancelRun stops the running prompt; it is nil when none is running
+	cancelRun context.CancelFunc
+	runs      sync.WaitGroup
+}
+
+// serve runs the session until the client hangs up or stops answering pings
+func (c *conn) serve() {
+	defer c.ws.Close()
+	go c.write()
+
+	c.ws.SetReadLimit(c.handler.cfg.MaxMessageBytes)
+	deadline := 2 * c.handler.cfg.PingInterval
+	c.ws.SetReadDeadline(time.Now().Add(deadline))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(deadline))
+	})
+
+	c.send(ServerMessage{Type: TypeSession, SessionID: c.session.ID})
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			break
+		}
+		c.ws.SetReadDeadline(time.Now().Add(deadline))
+
+		// A message that is not JSON is answered rather than ending the session
+		var msg ClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.send(ServerMessage{Type: TypeError, Error: "Invalid message", Code: http.StatusBadRequest})
+			continue
+		}
+		c.handle(msg)
+	}
+
+	c.stopRun()
+	c.runs.Wait()
+	c.cancel()
+	<-c.closed
+}
+
+// handle acts on one message from the client
+func (c *conn) handle(msg ClientMessage) {
+	switch msg.Type {
+	case TypePrompt:
+		c.startRun(msg)
+	case TypeCancel:
+		if !c.stopRun() {
+			c.send(ServerMessage{Type: TypeError, ID: msg.ID, Error: "No prompt is running", Code: http.StatusConflict})
+		}
+	case TypeReset:
+		c.stopRun()
+		c.session.reset()
+		c.send(ServerMessage{Type: TypeSession, ID: msg.ID, SessionID: c.session.ID})
+	default:
+		c.send(ServerMessage{Type: TypeError, ID: msg.ID, Error: "Unknown message type", Code: http.StatusBadRequest})
+	}
+}
+
+// startRun validates a prompt message and runs it in the background, unless
+// another prompt is still running
+func (c *conn) startRun(msg ClientMessage) {
+	fail := func(code int, text string) {
+		c.send(ServerMessage{Type: TypeError, ID: msg.ID, Error: text, Code: code})
+	}
+	switch {
+	case strings.TrimSpace(msg.Prompt) == "":
+		fail(http.StatusBadRequest, "Prompt is required")
+		return
+	case msg.Async || msg.CallbackURL != "":
+		fail(http.StatusBadRequest, "Async prompts are not supported over WebSocket")
+		return
+	}
+	// Options are checked before they stick to the session
+	if _, err := msg.PromptRequest.WithOptions(c.ctx); err != nil {
+		var invalid *factories.InvalidOptionError
+		if errors.As(err, &invalid) {
+			fail(http.StatusBadRequest, "Invalid "+invalid.Option)
+			return
+		}
+		fail(http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	c.mu.Lock()
+	if c.cancelRun != nil {
+		c.mu.Unlock()
+		fail(http.StatusConflict, "A prompt is already running")
+		return
+	}
+
+	// Every prompt counts as a request, as it would over REST
+	ctx, wait, err := ratelimit.Admit(c.ctx, c.handler.limiter, c.handler.quotas, c.clientID)
+	if err != nil {
+		c.mu.Unlock()
+		text := "Rate limit exceeded"
+		if errors.Is(err, ratelimit.ErrQuotaExceeded) {
+			text = "Daily quota exceeded"
+		}
+		c.send(ServerMessage{Type: TypeError, ID: msg.ID, Error: text, Code: http.StatusTooManyRequests, RetryAfter: retrySeconds(wait)})
+		return
+	}
+	ctx = logging.WithRequestID(ctx, logging.EnsureRequestID(""))
+	ctx, cancel := context.WithCancel(ctx)
+	c.cancelRun = cancel
+	c.runs.Add(1)
+	c.mu.Unlock()
+
+	req, prompt := c.session.merge(msg)
+	go func() {
+		defer c.runs.Done()
+		c.run(ctx, msg.ID, req, prompt)
+
+		c.mu.Lock()
+		c.cancelRun = nil
+		c.mu.Unlock()
+		cancel()
+	}()
+}
+
+// stopRun cancels the running prompt and reports whether there was one
+func (c *conn) stopRun() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancelRun == nil {
+		return false
+	}
+	c.cancelRun()
+	return true
+}
+
+// run sends a prompt through the pipeline, streaming its progress and
+// results, then asks a clarifying question if one is needed
+func (c *conn) run(ctx context.Context, id string, req factories.PromptRequest, prompt string) {
+	ctx, err := req.WithOptions(ctx)
+	if err != nil {
+		// Checked in startRun; the merged options only hold valid ones
+		c.send(ServerMessage{Type: TypeError, ID: id, Error: "Invalid request", Code: http.StatusBadRequest})
+		return
+	}
+	ctx = c.session.withContext(ctx, prompt, c.accepted)
+	ctx, ledger := usage.NewContext(ctx)
+
+	var resolved *factories.ProgressEvent
+	var rankings []factories.AnalysisResult
+	ctx = factories.WithProgress(ctx, func(ev factories.ProgressEvent) {
+		switch ev.Stage {
+		case factories.ProgressResolved:
+			resolved = &ev
+			c.sendRun(ctx, resolvedMessage(id, ev))
+		case factories.ProgressRanked:
+			rankings = ev.Rankings
+			c.sendRun(ctx, rankingsMessage(id, ev.Rankings))
+		default:
+			c.sendRun(ctx, ServerMessage{Type: TypeProgress, ID: id, Service: ev.Service, Stage: ev.Stage})
+		}
+	})
+
+	var responses []factories.ServiceResponse
+	err = c.handler.director.Stream(ctx, prompt, func(response factories.ServiceResponse) error {
+		responses = append(responses, response)
+		return c.sendRun(ctx, ServerMessage{Type: TypeResult, ID: id, Result: &response})
+	})
+
+	switch {
+	case ctx.Err() != nil:
+		// Cancelled by the client, or the connection closed
+		c.send(ServerMessage{Type: TypeDone, ID: id, Cancelled: true})
+		return
+	case err != nil:
+		code, text := factories.RunErrorStatus(err)
+		msg := ServerMessage{Type: TypeError, ID: id, Error: text, Code: code}
+		if code == http.StatusTooManyRequests {
+			msg.RetryAfter = retrySeconds(ratelimit.RetryAfter(ctx))
+		}
+		c.send(msg)
+		return
+	}
+
+	question := clarify(resolved, rankings, responses)
+	c.session.finish(prompt, resolved, question)
+	if question != nil {
+		c.send(ServerMessage{Type: TypeQuestion, ID: id, Question: question})
+	}
+	summary := ledger.Summary()
+	c.send(ServerMessage{Type: TypeDone, ID: id, Usage: &summary})
+}
+
+// send queues msg for the client. It is dropped if the connection has closed.
+func (c *conn) send(msg ServerMessage) {
+	select {
+	case c.outbox <- msg:
+	case <-c.ctx.Done():
+	case <-c.closed:
+	}
+}
+
+// sendRun queues a message of a running prompt, giving up if the prompt is
+// cancelled first
+func (c *conn) sendRun(ctx context.Context, msg ServerMessage) error {
+	select {
+	case c.outbox <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return errConnClosed
+	}
+}
+
+// write sends queued messages and pings until the connection's context is
+// done, then closes the socket
+func (c *conn) write() {
+	defer close(c.closed)
+	ticker := time.NewTicker(c.handler.cfg.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-c.outbox:
+			c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.ws.WriteJSON(msg); err != nil {
+				c.handler.logger.WarnContext(c.ctx, "Error writing chat message", "session", c.session.ID, "error", err)
+				c.ws.Close()
+				return
+			}
+		case <-ticker.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				c.ws.Close()
+				return
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// goAway tells the client the server is shutting down. The client closing
+// its end ends the session.
+func (c *conn) goAway() {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "Server is shutting down")
+	c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeTimeout))
+}
+
+// retrySeconds rounds wait up to whole seconds, as Retry-After is
+func retrySeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
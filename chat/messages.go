@@ -0,0 +1,144 @@
+package chat
+
+import (
+	"strconv"
+
+	"go-backend/budget"
+	"go-backend/dates"
+	"go-backend/factories"
+	"go-backend/geo"
+	"go-backend/locale"
+	"go-backend/usage"
+)
+
+// Types of the messages a client sends
+const (
+	// TypePrompt runs a prompt, or answers the pending question
+	TypePrompt = "prompt"
+	// TypeCancel stops the prompt that is running
+	TypeCancel = "cancel"
+	// TypeReset forgets the session's options, context and pending question
+	TypeReset = "reset"
+)
+
+// Types of the messages the server sends. Every prompt is answered by a
+// resolved, a rankings, progress and result messages, possibly a question,
+// and ends with exactly one done or error message.
+const (
+	// TypeSession is sent when the connection opens and after a reset
+	TypeSession = "session"
+	// TypeResolved says what the prompt resolved to: its locale, location,
+	// dates and budget
+	TypeResolved = "resolved"
+	// TypeRankings carries the classifier's score for every service
+	TypeRankings = "rankings"
+	// TypeProgress says a service has moved on to another stage
+	TypeProgress = "progress"
+	// TypeResult carries one service's response, or the budget plan as the
+	// budget.ServiceName service
+	TypeResult = "result"
+	// TypeQuestion asks the user to clarify the prompt
+	TypeQuestion = "question"
+	// TypeDone ends a prompt's messages
+	TypeDone = "done"
+	// TypeError reports a message that could not be handled, and ends a
+	// prompt's messages when it was about one
+	TypeError = "error"
+)
+
+// ClientMessage is a message from the client. A prompt carries the same
+// options as the /promptOpenAI body; they stick to the session until a
+// later prompt replaces them or the session is reset. Jobs and callbacks
+// are not available over the socket.
+type ClientMessage struct {
+	Type string `json:"type"`
+	// ID is chosen by the client and echoed on every message about the prompt
+	ID string `json:"id,omitempty"`
+	factories.PromptRequest
+	// OnSaleNow replaces the PromptRequest field so a later prompt can turn
+	// it off with false; left out, the session's setting stands
+	OnSaleNow *bool `json:"on_sale_now,omitempty"`
+}
+
+// ServerMessage is a message to the client. Only the fields of its type are set.
+type ServerMessage struct {
+	Type string `json:"type"`
+	// ID is the ID of the prompt the message is about, if any
+	ID string `json:"id,omitempty"`
+
+	// SessionID identifies the session, for session messages
+	SessionID string `json:"session_id,omitempty"`
+
+	// Resolved is set for resolved messages
+	Resolved *Resolved `json:"resolved,omitempty"`
+	// Rankings are set for rankings messages
+	Rankings []Ranking `json:"rankings,omitempty"`
+	// Service and Stage are set for progress messages: the stage is one of
+	// the factories.Progress stages
+	Service string `json:"service,omitempty"`
+	Stage   string `json:"stage,omitempty"`
+	// Result is set for result messages
+	Result *factories.ServiceResponse `json:"result,omitempty"`
+	// Question is set for question messages
+	Question *Question `json:"question,omitempty"`
+	// Usage is the prompt's total LLM usage, for done messages
+	Usage *usage.Summary `json:"usage,omitempty"`
+	// Cancelled is set on the done message of a cancelled prompt
+	Cancelled bool `json:"cancelled,omitempty"`
+
+	// Error and Code describe an error: the message the REST API would
+	// answer with and its HTTP status
+	Error string `json:"error,omitempty"`
+	Code  int    `json:"code,omitempty"`
+	// RetryAfter is how many seconds to wait, for 429 errors
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// Resolved is what a prompt resolved to
+type Resolved struct {
+	Locale   string         `json:"locale"`
+	Location *geo.Location  `json:"location,omitempty"`
+	Dates    *dates.Range   `json:"dates,omitempty"`
+	Budget   *budget.Budget `json:"budget,omitempty"`
+}
+
+// Ranking is the classifier's score for a service
+type Ranking struct {
+	Service       string `json:"service"`
+	Applicability int    `json:"applicability"`
+}
+
+// Question asks the user to clarify their prompt. The next prompt answers it.
+type Question struct {
+	// Kind is one of the Question kinds, for clients that offer their own UI
+	Kind string `json:"kind"`
+	// Text is the question in the prompt's locale
+	Text string `json:"text"`
+}
+
+// resolvedMessage converts the resolved stage of a run
+func resolvedMessage(id string, ev factories.ProgressEvent) ServerMessage {
+	r := &Resolved{Location: ev.Location, Dates: ev.Dates, Budget: ev.Budget}
+	if ev.Locale != nil {
+		r.Locale = ev.Locale.String()
+	}
+	return ServerMessage{Type: TypeResolved, ID: id, Resolved: r}
+}
+
+// rankingsMessage converts the ranked stage of a run
+func rankingsMessage(id string, results []factories.AnalysisResult) ServerMessage {
+	rankings := make([]Ranking, 0, len(results))
+	for _, result := range results {
+		applicability, _ := strconv.Atoi(result.Applicability)
+		rankings = append(rankings, Ranking{Service: result.Service, Applicability: applicability})
+	}
+	return ServerMessage{Type: TypeRankings, ID: id, Rankings: rankings}
+}
+
+// localeOf returns the locale a run resolved to, or the default
+func localeOf(ev *factories.ProgressEvent) locale.Locale {
+	if ev != nil && ev.Locale != nil {
+		return *ev.Locale
+	}
+	return locale.Default()
+}
@@ -0,0 +1,94 @@
+package chat
+
+import (
+	"strconv"
+
+	"go-backend/factories"
+	"go-backend/locale"
+)
+
+// Kinds of clarifying question
+const (
+	// KindActivity asks what to look for, when no service was applicable
+	// enough to answer
+	KindActivity = "activity"
+	// KindNoResults asks for another place or date, when the services that
+	// answered found nothing
+	KindNoResults = "no_results"
+	// KindLocation asks where to look, when the prompt could not be placed
+	// and the results come from anywhere
+	KindLocation = "location"
+)
+
+// questions are the clarifying questions by kind and language
+var questions = map[string]map[string]string{
+	KindActivity: {
+		"en": "What kind of activity are you looking for? For example concerts, sports or theatre.",
+		"es": "¿Qué tipo de actividad buscas? Por ejemplo conciertos, deportes o teatro.",
+		"fr": "Quel genre d'activité cherchez-vous ? Par exemple des concerts, du sport ou du théâtre.",
+		"de": "Welche Art von Aktivität suchen Sie? Zum Beispiel Konzerte, Sport oder Theater.",
+		"it": "Che tipo di attività cerchi? Per esempio concerti, sport o teatro.",
+		"pt": "Que tipo de atividade você procura? Por exemplo shows, esportes ou teatro.",
+		"nl": "Wat voor soort activiteit zoek je? Bijvoorbeeld concerten, sport of theater.",
+	},
+	KindNoResults: {
+		"en": "I couldn't find anything for that. Would you like to try another place or date?",
+		"es": "No encontré nada para eso. ¿Quieres probar con otro lugar u otra fecha?",
+		"fr": "Je n'ai rien trouvé. Voulez-vous essayer un autre lieu ou une autre date ?",
+		"de": "Dazu habe ich nichts gefunden. Möchten Sie einen anderen Ort oder ein anderes Datum versuchen?",
+		"it": "Non ho trovato nulla. Vuoi provare un altro luogo o un'altra data?",
+		"pt": "Não encontrei nada. Quer tentar outro lugar ou outra data?",
+		"nl": "Ik heb daar niets voor gevonden. Wil je een andere plaats of datum proberen?",
+	},
+	KindLocation: {
+		"en": "Where should I look? These results are not limited to one area.",
+		"es": "¿Dónde debo buscar? Estos resultados no se limitan a una zona.",
+		"fr": "Où dois-je chercher ? Ces résultats ne sont pas limités à une région.",
+		"de": "Wo soll ich suchen? Diese Ergebnisse sind nicht auf eine Gegend beschränkt.",
+		"it": "Dove devo cercare? Questi risultati non sono limitati a una zona.",
+		"pt": "Onde devo procurar? Estes resultados não estão limitados a uma região.",
+		"nl": "Waar moet ik zoeken? Deze resultaten zijn niet beperkt tot één gebied.",
+	},
+}
+
+// newQuestion returns the question of kind in the language of l, or in
+// English if there is no translation
+func newQuestion(kind string, l locale.Locale) *Question {
+	text, ok := questions[kind][l.Language]
+	if !ok {
+		text = questions[kind]["en"]
+	}
+	return &Question{Kind: kind, Text: text}
+}
+
+// clarify picks the question to ask after a run, if any: what to look for
+// when no service was applicable enough, another place or date when the
+// services that answered found nothing, or where to look when the prompt
+// was not placed. resolved is the run's resolved stage, or nil if it never
+// got there, and rankings are the classifier's results.
+func clarify(resolved *factories.ProgressEvent, rankings []factories.AnalysisResult, responses []factories.ServiceResponse) *Question {
+	applicable := false
+	for _, result := range rankings {
+		if applicability, err := strconv.Atoi(result.Applicability); err == nil && applicability >= factories.ApplicabilityThreshold {
+			applicable = true
+		}
+	}
+	answered, found := 0, 0
+	for _, response := range responses {
+		if activities, ok := response.Data.([]interface{}); ok {
+			answered++
+			found += len(activities)
+		}
+	}
+
+	l := localeOf(resolved)
+	switch {
+	case len(rankings) > 0 && !applicable:
+		return newQuestion(KindActivity, l)
+	case answered > 0 && found == 0:
+		return newQuestion(KindNoResults, l)
+	case found > 0 && resolved != nil && resolved.Location == nil:
+		return newQuestion(KindLocation, l)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package chat
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"go-backend/budget"
+	"go-backend/dates"
+	"go-backend/factories"
+	"go-backend/geo"
+	"go-backend/locale"
+)
+
+// Session is what a connection remembers between prompts: the options the
+// client has sent, where, when and in which language the last prompt was
+// about, and the question the user has yet to answer
+type Session struct {
+	ID string
+
+	mu sync.Mutex
+	// options are the prompt options sent so far; Prompt is not used
+	options factories.PromptRequest
+	// last is the resolved stage of the last prompt that got that far
+	last *factories.ProgressEvent
+	// pending is the prompt a question was asked about, and question the
+	// question; the next prompt answers it
+	pending  string
+	question *Question
+}
+
+// merge adds the options set in msg to the session's and returns the
+// prompt to run: msg's own prompt, or, when it answers a question, the
+// answer followed by the prompt the question was about. The answer comes
+// first so a place or date it names wins over the original prompt's.
+func (s *Session) merge(msg ClientMessage) (factories.PromptRequest, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req := msg.PromptRequest
+
+	o := &s.options
+	if req.Location != nil {
+		o.Location = req.Location
+	}
+	if req.Timezone != "" {
+		o.Timezone = req.Timezone
+	}
+	if req.Sort != "" {
+		o.Sort = req.Sort
+	}
+	if req.Preferences != nil {
+		o.Preferences = req.Preferences
+	}
+	if req.MaxPrice != nil {
+		o.MaxPrice = req.MaxPrice
+	}
+	if msg.OnSaleNow != nil {
+		o.OnSaleNow = *msg.OnSaleNow
+	}
+	if req.Budget != nil {
+		o.Budget = req.Budget
+	}
+	if req.Locale != "" {
+		o.Locale = req.Locale
+	}
+
+	prompt := strings.TrimSpace(req.Prompt)
+	if s.question != nil {
+		prompt = prompt + ", " + s.pending
+		s.pending, s.question = "", nil
+	}
+	merged := *o
+	merged.Prompt = prompt
+	return merged, prompt
+}
+
+// withContext carries what the last prompt resolved to over to a prompt
+// that does not say: its location, unless the client sent coordinates, its
+// dates and its budget, unless the prompt names its own, and its language
+// as a fallback for prompts too short to detect one. accepted are the
+// client's Accept-Language preferences.
+func (s *Session) withContext(ctx context.Context, prompt string, accepted []locale.Locale) context.Context {
+	s.mu.Lock()
+	last, options := s.last, s.options
+	s.mu.Unlock()
+	if last == nil {
+		return ctx
+	}
+
+	if loc := last.Location; loc != nil && options.Location == nil {
+		hint := geo.HintFromContext(ctx)
+		hint.Coordinates = &geo.Coordinates{Lat: loc.Lat, Lon: loc.Lon}
+		ctx = geo.WithHint(ctx, hint)
+	}
+	if last.Dates != nil {
+		// The prompt's own dates replace these when the run resolves them
+		ctx = dates.NewContext(ctx, last.Dates)
+	}
+	if last.Budget != nil && options.Budget == nil {
+		if _, named := budget.Parse(prompt); !named {
+			ctx = budget.NewContext(ctx, last.Budget)
+		}
+	}
+	if last.Locale != nil {
+		ctx = locale.WithAccepted(ctx, append([]locale.Locale{*last.Locale}, accepted...))
+	}
+	return ctx
+}
+
+// finish records what a prompt resolved to, if it got that far, and the
+// question asked about it, if any
+func (s *Session) finish(prompt string, resolved *factories.ProgressEvent, question *Question) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if resolved != nil {
+		s.last = resolved
+	}
+	if question != nil {
+		s.pending, s.question = prompt, question
+	}
+}
+
+// reset forgets everything but the session's ID
+func (s *Session) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.options = factories.PromptRequest{}
+	s.last = nil
+	s.pending, s.question = "", nil
+}
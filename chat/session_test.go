@@ -0,0 +1,58 @@
+package chat
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSessionMergeOnSaleNow(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		want     bool
+	}{
+		{"never sent", []string{`{"prompt":"jazz"}`}, false},
+		{"turned on", []string{`{"prompt":"jazz","on_sale_now":true}`}, true},
+		{"kept when left out", []string{`{"prompt":"jazz","on_sale_now":true}`, `{"prompt":"blues"}`}, true},
+		{"turned off", []string{`{"prompt":"jazz","on_sale_now":true}`, `{"prompt":"blues","on_sale_now":false}`}, false},
+		{"turned back on", []string{`{"prompt":"jazz","on_sale_now":true}`, `{"prompt":"blues","on_sale_now":false}`, `{"prompt":"rock","on_sale_now":true}`}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Session{}
+			var got bool
+			for _, raw := range tt.messages {
+				var msg ClientMessage
+				if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+					t.Fatal(err)
+				}
+				req, _ := s.merge(msg)
+				got = req.OnSaleNow
+			}
+			if got != tt.want {
+				t.Errorf("OnSaleNow = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionMergeKeepsOtherOptions(t *testing.T) {
+	s := &Session{}
+	for _, raw := range []string{
+		`{"prompt":"jazz","on_sale_now":true,"sort":"date","timezone":"America/Chicago"}`,
+		`{"prompt":"blues","on_sale_now":false}`,
+	} {
+		var msg ClientMessage
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			t.Fatal(err)
+		}
+		s.merge(msg)
+	}
+	req, prompt := s.merge(ClientMessage{})
+	if req.OnSaleNow || req.Sort != "date" || req.Timezone != "America/Chicago" {
+		t.Errorf("options = %+v, want on_sale_now off with the sort and timezone kept", req)
+	}
+	if prompt != "" {
+		t.Errorf("prompt = %q, want empty", prompt)
+	}
+}
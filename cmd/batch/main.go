@@ -0,0 +1,169 @@
+// Command batch runs a JSONL file of prompts through the same pipeline as
+// the /batch endpoint and writes one JSONL result per prompt, in input order.
+//
+// Each input line is an object with a prompt and an optional id:
+//
+//	{"id": "chi-jazz", "prompt": "Jazz concerts in Chicago this weekend"}
+//
+//	go run ./cmd/batch -in prompts.jsonl -out results.jsonl -concurrency 8
+//
+// Configuration (API keys, base URLs, UPSTREAM_MODE, PROMPTS_DIR, ...) comes
+// from the environment and .env exactly as for the server.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"go-backend/batch"
+	"go-backend/factories"
+	"go-backend/geo"
+	"go-backend/logging"
+	"go-backend/prompts"
+	"go-backend/replay"
+)
+
+func main() {
+	inPath := flag.String("in", "-", "JSONL file of prompts, or - for stdin")
+	outPath := flag.String("out", "-", "JSONL file for results, or - for stdout")
+	concurrency := flag.Int("concurrency", batch.ConfigFromEnv().Concurrency, "prompts processed at once")
+	flag.Parse()
+
+	logger := logging.New(os.Stderr, logging.ParseLevel(os.Getenv("LOG_LEVEL")))
+	slog.SetDefault(logger)
+
+	if err := run(logger, *inPath, *outPath, *concurrency); err != nil {
+		logger.Error("Batch failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(logger *slog.Logger, inPath, outPath string, concurrency int) error {
+	in, err := openInput(inPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	items, err := readItems(in)
+	if err != nil {
+		return err
+	}
+
+	out, err := openOutput(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if dir := os.Getenv("PROMPTS_DIR"); dir != "" {
+		store, err := prompts.LoadDir(dir, prompts.EnvironmentFromEnv())
+		if err != nil {
+			return fmt.Errorf("error loading prompt templates: %v", err)
+		}
+		prompts.SetDefault(store)
+	}
+	if mode := replay.ModeFromEnv(); mode != replay.ModeLive {
+		factories.HTTPClient = replay.NewClient(mode, replay.DirFromEnv())
+	}
+
+	// Stop starting new prompts on Ctrl-C; in-flight ones are cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	director := factories.NewServiceDirector(logger)
+	if director.Locations, err = geo.ResolverFromEnv(); err != nil {
+		return err
+	}
+	director.Ranking.Geocoder = director.Locations.Geocoder
+	runner := &batch.Runner{Director: director, Concurrency: concurrency}
+
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+
+	// Results complete out of order; hold them back until their turn comes
+	pending := make(map[int]batch.Result)
+	next := 0
+	var writeErr error
+	stats := runner.Run(ctx, items, func(r batch.Result) {
+		pending[r.Index] = r
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				return
+			}
+			delete(pending, next)
+			next++
+			if writeErr == nil {
+				writeErr = enc.Encode(ready)
+			}
+		}
+	})
+	if writeErr != nil {
+		return fmt.Errorf("error writing results: %v", writeErr)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing results: %v", err)
+	}
+
+	logger.Info("Batch finished",
+		"prompts", stats.Prompts,
+		"failed", stats.Failed,
+		"llm_calls", stats.Usage.Calls,
+		"shared_calls", stats.Usage.SharedCalls,
+		"llm_tokens", stats.Usage.TotalTokens,
+		"cost_usd", stats.Usage.CostUSD,
+		"upstream_calls", stats.Upstream.Calls,
+		"upstream_shared", stats.Upstream.Shared,
+	)
+	return ctx.Err()
+}
+
+// readItems parses one Item per line, skipping blank lines
+func readItems(r io.Reader) ([]batch.Item, error) {
+	var items []batch.Item
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var item batch.Item
+		if err := json.Unmarshal([]byte(text), &item); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
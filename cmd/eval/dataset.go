@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AnyValue in an expected parameter accepts any non-empty value
+const AnyValue = "*"
+
+// Case is one labeled prompt in the dataset
+type Case struct {
+	ID     string `json:"id"`
+	Prompt string `json:"prompt"`
+	// Services are the services expected to score at or above the
+	// applicability threshold. Empty means none should be routed.
+	Services []string `json:"services"`
+	// Action is the expected Ticketmaster action, if the prompt should be
+	// sent to the action extractor
+	Action *ExpectedAction `json:"action,omitempty"`
+}
+
+// ExpectedAction is the Ticketmaster action and parameters a prompt should
+// be turned into. Only the listed parameters are scored; a value of "*"
+// accepts anything non-empty.
+type ExpectedAction struct {
+	Action     string            `json:"action"`
+	Parameters map[string]string `json:"parameters"`
+}
+
+// loadDataset reads a JSONL dataset, one Case per line. Blank lines and
+// lines starting with # are skipped.
+func loadDataset(path string) ([]Case, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cases []Case
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var c Case
+		if err := json.Unmarshal([]byte(text), &c); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		if c.ID == "" {
+			c.ID = fmt.Sprintf("line-%d", line)
+		}
+		if seen[c.ID] {
+			return nil, fmt.Errorf("%s:%d: duplicate case id %q", path, line, c.ID)
+		}
+		if c.Prompt == "" {
+			return nil, fmt.Errorf("%s:%d: case %q has no prompt", path, line, c.ID)
+		}
+		seen[c.ID] = true
+		cases = append(cases, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("%s: no cases", path)
+	}
+	return cases, nil
+}
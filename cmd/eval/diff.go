@@ -0,0 +1,108 @@
+package main
+
+import (
+	"sort"
+)
+
+// MetricDelta compares one summary metric with the baseline run
+type MetricDelta struct {
+	Metric   string  `json:"metric"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	Delta    float64 `json:"delta"`
+	// Quality metrics are scores in [0, 1] where higher is better; the rest
+	// (latency, tokens, cost) are better lower
+	Quality   bool `json:"quality"`
+	Regressed bool `json:"regressed"`
+}
+
+// Diff is the metric-by-metric comparison with a baseline run
+type Diff []MetricDelta
+
+type metric struct {
+	name    string
+	value   float64
+	quality bool
+}
+
+// flatten lists the summary metrics in report order
+func (s Summary) flatten() []metric {
+	services := make([]string, 0, len(s.Services))
+	for service := range s.Services {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var out []metric
+	for _, service := range services {
+		score := s.Services[service]
+		out = append(out,
+			metric{"service." + service + ".precision", score.Precision, true},
+			metric{"service." + service + ".recall", score.Recall, true},
+		)
+	}
+	out = append(out,
+		metric{"routing.accuracy", s.Routing.Accuracy, true},
+		metric{"action.accuracy", s.Action.Accuracy, true},
+		metric{"params.accuracy", s.Params.Accuracy, true},
+		metric{"params.unexpected", float64(s.UnexpectedParams), false},
+	)
+
+	stages := make([]string, 0, len(s.Latency))
+	for stage := range s.Latency {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		l := s.Latency[stage]
+		out = append(out,
+			metric{"latency." + stage + ".p50_ms", l.P50MS, false},
+			metric{"latency." + stage + ".p95_ms", l.P95MS, false},
+		)
+	}
+
+	return append(out,
+		metric{"usage.total_tokens", float64(s.Usage.TotalTokens), false},
+		metric{"usage.cost_usd", s.Usage.CostUSD, false},
+	)
+}
+
+// diffReports compares the current summary with the baseline's. Metrics
+// missing from the baseline (e.g. a new service) are left out.
+func diffReports(baseline, current *Report) Diff {
+	base := make(map[string]float64)
+	for _, m := range baseline.Summary.flatten() {
+		base[m.name] = m.value
+	}
+
+	var diff Diff
+	for _, m := range current.Summary.flatten() {
+		b, ok := base[m.name]
+		if !ok {
+			continue
+		}
+		delta := m.value - b
+		diff = append(diff, MetricDelta{
+			Metric:    m.name,
+			Baseline:  b,
+			Current:   m.value,
+			Delta:     delta,
+			Quality:   m.quality,
+			Regressed: (m.quality && delta < 0) || (!m.quality && delta > 0),
+		})
+	}
+	return diff
+}
+
+// worstRegression returns the largest drop in any quality metric, or 0 if
+// none got worse. Latency and cost are reported but never fail a run since
+// they vary between live runs.
+func (d Diff) worstRegression() float64 {
+	var worst float64
+	for _, m := range d {
+		if m.Quality && -m.Delta > worst {
+			worst = -m.Delta
+		}
+	}
+	return worst
+}
@@ -0,0 +1,250 @@
+// Command eval measures how well the classifier and the Ticketmaster action
+// extractor handle a labeled dataset of prompts, so prompt and model changes
+// can be checked before they ship.
+//
+// Each case is run through OpenAIService.AnalyzePrompt and, when it has an
+// expected action, AnalyzePromptWithLLM. Upstream calls go live or through
+// the replay transport (-mode replay with recorded fixtures), so a run can be
+// repeated offline. Prompts include the current date, so record and replay
+// with the same FIXED_NOW. The report covers precision and recall per service,
+// action and parameter accuracy, latency and token cost, and can be diffed
+// against the JSON report of an earlier run:
+//
+//	go run ./cmd/eval -dataset eval/dataset.jsonl -json report.json -md report.md
+//	go run ./cmd/eval -mode replay -baseline eval/baseline.json -max-regression 0.05
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/factories"
+	"go-backend/guard"
+	"go-backend/logging"
+	"go-backend/prompts"
+	"go-backend/replay"
+	"go-backend/usage"
+)
+
+func main() {
+	datasetPath := flag.String("dataset", "eval/dataset.jsonl", "JSONL file of labeled prompts")
+	mode := flag.String("mode", string(replay.ModeFromEnv()), "upstream mode: live, record or replay")
+	fixtures := flag.String("fixtures", replay.DirFromEnv(), "fixture directory for record and replay")
+	promptsDir := flag.String("prompts", os.Getenv("PROMPTS_DIR"), "prompt template directory (default: embedded templates)")
+	promptEnv := flag.String("prompt-env", prompts.EnvironmentFromEnv(), "prompt template environment")
+	pricesPath := flag.String("prices", os.Getenv("LLM_PRICES_FILE"), "JSON price table for cost estimates")
+	threshold := flag.Int("threshold", factories.ApplicabilityThreshold, "applicability score a service needs to count as routed")
+	jsonPath := flag.String("json", "", "write the JSON report to this file")
+	mdPath := flag.String("md", "", "write the Markdown report to this file (default: stdout)")
+	baselinePath := flag.String("baseline", "", "JSON report of an earlier run to diff against")
+	maxRegression := flag.Float64("max-regression", -1, "exit non-zero if a quality metric drops by more than this vs the baseline (negative disables)")
+	flag.Parse()
+
+	logger := logging.New(os.Stderr, logging.ParseLevel(os.Getenv("LOG_LEVEL")))
+	slog.SetDefault(logger)
+
+	if err := run(logger, options{
+		dataset:       *datasetPath,
+		mode:          replay.Mode(strings.ToLower(*mode)),
+		fixtures:      *fixtures,
+		promptsDir:    *promptsDir,
+		promptEnv:     *promptEnv,
+		prices:        *pricesPath,
+		threshold:     *threshold,
+		jsonPath:      *jsonPath,
+		mdPath:        *mdPath,
+		baseline:      *baselinePath,
+		maxRegression: *maxRegression,
+	}); err != nil {
+		logger.Error("Evaluation failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+type options struct {
+	dataset       string
+	mode          replay.Mode
+	fixtures      string
+	promptsDir    string
+	promptEnv     string
+	prices        string
+	threshold     int
+	jsonPath      string
+	mdPath        string
+	baseline      string
+	maxRegression float64
+}
+
+// errRegression is returned when the run is worse than the baseline by more
+// than the allowed margin
+var errRegression = errors.New("quality regressed against the baseline")
+
+func run(logger *slog.Logger, opts options) error {
+	switch opts.mode {
+	case replay.ModeLive:
+	case replay.ModeRecord, replay.ModeReplay:
+		// NewOpenAIService only lets a missing API key through when
+		// UPSTREAM_MODE says the run is replayed
+		if opts.mode == replay.ModeReplay {
+			os.Setenv("UPSTREAM_MODE", string(replay.ModeReplay))
+		}
+		factories.HTTPClient = replay.NewClient(opts.mode, opts.fixtures)
+	default:
+		return fmt.Errorf("unknown upstream mode %q", opts.mode)
+	}
+
+	store, err := loadPrompts(opts.promptsDir, opts.promptEnv)
+	if err != nil {
+		return err
+	}
+	prompts.SetDefault(store)
+
+	if opts.prices != "" {
+		table, err := usage.LoadPriceTable(opts.prices)
+		if err != nil {
+			return fmt.Errorf("error loading price table: %v", err)
+		}
+		usage.SetPrices(table)
+	}
+
+	cases, err := loadDataset(opts.dataset)
+	if err != nil {
+		return err
+	}
+
+	svc := factories.NewOpenAIService(logger)
+	// Read after NewOpenAIService has loaded .env, as the director does
+	check := guard.ConfigFromEnv()
+
+	report := Report{
+		GeneratedAt: time.Now().UTC(),
+		Dataset:     opts.dataset,
+		Mode:        string(opts.mode),
+		Threshold:   opts.threshold,
+		Templates:   store.Selected(),
+	}
+	for _, c := range cases {
+		result := evaluate(context.Background(), svc, check, opts.threshold, c)
+		switch {
+		case result.Blocked:
+			logger.Info("Case blocked by the input guard", "case", c.ID, "error", result.Error)
+		case result.Error != "":
+			logger.Warn("Case failed", "case", c.ID, "error", result.Error)
+		}
+		report.Results = append(report.Results, result)
+	}
+	report.score()
+
+	if opts.baseline != "" {
+		baseline, err := loadReport(opts.baseline)
+		if err != nil {
+			return fmt.Errorf("error loading baseline: %v", err)
+		}
+		report.Diff = diffReports(baseline, &report)
+		report.BaselineGeneratedAt = &baseline.GeneratedAt
+	}
+
+	if opts.jsonPath != "" {
+		if err := report.writeJSON(opts.jsonPath); err != nil {
+			return err
+		}
+	}
+	if opts.mdPath != "" {
+		if err := os.WriteFile(opts.mdPath, []byte(report.Markdown()), 0o644); err != nil {
+			return err
+		}
+	} else {
+		fmt.Print(report.Markdown())
+	}
+
+	if opts.maxRegression >= 0 {
+		if worst := report.Diff.worstRegression(); worst > opts.maxRegression {
+			return fmt.Errorf("%w: worst drop %.3f exceeds %.3f", errRegression, worst, opts.maxRegression)
+		}
+	}
+	return nil
+}
+
+func loadPrompts(dir, env string) (*prompts.Store, error) {
+	if dir != "" {
+		return prompts.LoadDir(dir, env)
+	}
+	return prompts.LoadEmbedded(env)
+}
+
+// evaluate runs one case through the classifier and, if it expects an
+// action, the action extractor
+func evaluate(ctx context.Context, svc *factories.OpenAIService, check guard.Config, threshold int, c Case) (result CaseResult) {
+	ctx, ledger := usage.NewContext(ctx)
+
+	result = CaseResult{
+		ID:       c.ID,
+		Expected: sorted(c.Services),
+		Scores:   make(map[string]int),
+	}
+	defer func() { result.Usage = ledger.Summary() }()
+
+	// Prompts go through the same input guard as the API, so blocked
+	// injection attempts count as routing to nothing
+	checked, err := check.Check(c.Prompt)
+	if err != nil {
+		result.Blocked = true
+		result.Error = err.Error()
+		result.scoreParams(c.Action, nil)
+		return result
+	}
+	prompt := checked.Prompt
+
+	start := time.Now()
+	rankings, err := svc.AnalyzePrompt(ctx, prompt)
+	result.ClassificationMS = msSince(start)
+	if err != nil {
+		result.Error = fmt.Sprintf("classification: %v", err)
+	}
+	for _, r := range rankings {
+		score, err := strconv.Atoi(r.Applicability)
+		if err != nil {
+			continue
+		}
+		result.Scores[r.Service] = score
+		if score >= threshold {
+			result.Predicted = append(result.Predicted, r.Service)
+		}
+	}
+	result.Predicted = sorted(result.Predicted)
+
+	if c.Action == nil {
+		return result
+	}
+
+	start = time.Now()
+	action, err := factories.AnalyzePromptWithLLM(ctx, prompt)
+	result.ExtractionMS = msSince(start)
+	if err != nil {
+		if result.Error == "" {
+			result.Error = fmt.Sprintf("action extraction: %v", err)
+		}
+		result.scoreParams(c.Action, nil)
+		return result
+	}
+	result.scoreParams(c.Action, action)
+	return result
+}
+
+func msSince(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+func sorted(values []string) []string {
+	out := append([]string(nil), values...)
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Markdown renders the report for humans, e.g. as a PR comment
+func (rep *Report) Markdown() string {
+	var b strings.Builder
+	s := rep.Summary
+
+	fmt.Fprintf(&b, "# Evaluation report\n\n")
+	fmt.Fprintf(&b, "- Dataset: `%s` (%d cases, %d errors, %d blocked)\n", rep.Dataset, s.Cases, s.Errors, s.Blocked)
+	fmt.Fprintf(&b, "- Upstream mode: %s\n", rep.Mode)
+	fmt.Fprintf(&b, "- Applicability threshold: %d\n", rep.Threshold)
+	fmt.Fprintf(&b, "- Templates: %s\n", templateList(rep.Templates))
+	fmt.Fprintf(&b, "- Generated: %s\n\n", rep.GeneratedAt.Format("2006-01-02 15:04:05 MST"))
+
+	fmt.Fprintf(&b, "## Routing\n\n")
+	fmt.Fprintf(&b, "| Service | Precision | Recall | F1 | TP | FP | FN |\n")
+	fmt.Fprintf(&b, "|---|---:|---:|---:|---:|---:|---:|\n")
+	services := make([]string, 0, len(s.Services))
+	for service := range s.Services {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		sc := s.Services[service]
+		fmt.Fprintf(&b, "| %s | %.3f | %.3f | %.3f | %d | %d | %d |\n",
+			service, sc.Precision, sc.Recall, sc.F1, sc.TruePositives, sc.FalsePositives, sc.FalseNegatives)
+	}
+	fmt.Fprintf(&b, "\nExact routing: %s\n\n", accuracy(s.Routing))
+
+	fmt.Fprintf(&b, "## Action extraction\n\n")
+	fmt.Fprintf(&b, "- Action: %s\n", accuracy(s.Action))
+	fmt.Fprintf(&b, "- Parameters: %s\n", accuracy(s.Params))
+	fmt.Fprintf(&b, "- Unexpected parameters: %d\n\n", s.UnexpectedParams)
+
+	fmt.Fprintf(&b, "## Latency and cost\n\n")
+	fmt.Fprintf(&b, "| Stage | Calls | Mean ms | p50 ms | p95 ms | Max ms |\n")
+	fmt.Fprintf(&b, "|---|---:|---:|---:|---:|---:|\n")
+	stages := make([]string, 0, len(s.Latency))
+	for stage := range s.Latency {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		l := s.Latency[stage]
+		fmt.Fprintf(&b, "| %s | %d | %.1f | %.1f | %.1f | %.1f |\n", stage, l.Count, l.MeanMS, l.P50MS, l.P95MS, l.MaxMS)
+	}
+	fmt.Fprintf(&b, "\n%d LLM calls, %d prompt + %d completion tokens, $%.4f estimated\n\n",
+		s.Usage.Calls, s.Usage.PromptTokens, s.Usage.CompletionTokens, s.Usage.CostUSD)
+
+	if rep.BaselineGeneratedAt != nil {
+		fmt.Fprintf(&b, "## Diff against baseline (%s)\n\n", rep.BaselineGeneratedAt.Format("2006-01-02 15:04:05 MST"))
+		if len(rep.Diff) == 0 {
+			fmt.Fprintf(&b, "No metrics in common with the baseline.\n\n")
+		} else {
+			fmt.Fprintf(&b, "| Metric | Baseline | Current | Delta | |\n")
+			fmt.Fprintf(&b, "|---|---:|---:|---:|---|\n")
+			for _, m := range rep.Diff {
+				flag := ""
+				if m.Regressed {
+					flag = "worse"
+				} else if m.Delta != 0 {
+					flag = "better"
+				}
+				fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n",
+					m.Metric, formatMetric(m.Baseline), formatMetric(m.Current), formatDelta(m.Delta), flag)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	var failures []CaseResult
+	for _, r := range rep.Results {
+		if !r.passed() {
+			failures = append(failures, r)
+		}
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(&b, "## Failing cases\n\n")
+		for _, r := range failures {
+			fmt.Fprintf(&b, "- **%s**: %s\n", r.ID, r.describe())
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// passed reports whether the case was routed and extracted exactly as labeled
+func (r CaseResult) passed() bool {
+	if r.Error != "" && !r.Blocked {
+		return false
+	}
+	if !r.routed() {
+		return false
+	}
+	if r.Action == nil {
+		return true
+	}
+	if !r.Action.Correct && !r.Blocked {
+		return false
+	}
+	for _, p := range r.Action.Params {
+		if !p.Correct && !r.Blocked {
+			return false
+		}
+	}
+	return true
+}
+
+// describe summarizes what went wrong with a failing case
+func (r CaseResult) describe() string {
+	var problems []string
+	if r.Error != "" {
+		problems = append(problems, "error: "+r.Error)
+	}
+	if !r.routed() {
+		problems = append(problems, fmt.Sprintf("routed to [%s], expected [%s]",
+			strings.Join(r.Predicted, ", "), strings.Join(r.Expected, ", ")))
+	}
+	if r.Action != nil && !r.Blocked {
+		if !r.Action.Correct {
+			problems = append(problems, fmt.Sprintf("action %q, expected %q", r.Action.Got, r.Action.Expected))
+		}
+		for _, p := range r.Action.Params {
+			if !p.Correct {
+				problems = append(problems, fmt.Sprintf("%s=%q, expected %q", p.Name, p.Got, p.Expected))
+			}
+		}
+	}
+	return strings.Join(problems, "; ")
+}
+
+func accuracy(a Accuracy) string {
+	return fmt.Sprintf("%.3f (%d/%d)", a.Accuracy, a.Correct, a.Total)
+}
+
+func templateList(templates map[string]string) string {
+	ids := make([]string, 0, len(templates))
+	for id := range templates {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	refs := make([]string, len(ids))
+	for i, id := range ids {
+		refs[i] = "`" + id + "@" + templates[id] + "`"
+	}
+	return strings.Join(refs, ", ")
+}
+
+func formatMetric(v float64) string {
+	if v == float64(int64(v)) {
+		return fmt.Sprintf("%d", int64(v))
+	}
+	return fmt.Sprintf("%.3f", v)
+}
+
+func formatDelta(v float64) string {
+	if v == float64(int64(v)) {
+		return fmt.Sprintf("%+d", int64(v))
+	}
+	return fmt.Sprintf("%+.3f", v)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go-backend/factories"
+	"go-backend/guard"
+	"go-backend/metrics"
+	"go-backend/usage"
+)
+
+// CaseResult is the outcome of one dataset case
+type CaseResult struct {
+	ID               string         `json:"id"`
+	Expected         []string       `json:"expected"`
+	Predicted        []string       `json:"predicted"`
+	Scores           map[string]int `json:"scores"`
+	Blocked          bool           `json:"blocked,omitempty"`
+	Action           *ActionResult  `json:"action,omitempty"`
+	ClassificationMS float64        `json:"classification_ms"`
+	ExtractionMS     float64        `json:"extraction_ms,omitempty"`
+	Usage            usage.Summary  `json:"usage"`
+	Error            string         `json:"error,omitempty"`
+}
+
+// ActionResult compares the extracted Ticketmaster action with the expected one
+type ActionResult struct {
+	Expected   string        `json:"expected"`
+	Got        string        `json:"got"`
+	Correct    bool          `json:"correct"`
+	Params     []ParamResult `json:"params"`
+	Unexpected []string      `json:"unexpected,omitempty"`
+}
+
+// ParamResult compares one expected parameter with what was extracted
+type ParamResult struct {
+	Name     string `json:"name"`
+	Expected string `json:"expected"`
+	Got      string `json:"got"`
+	Correct  bool   `json:"correct"`
+}
+
+// routed reports whether the case was routed to exactly the expected services
+func (r CaseResult) routed() bool {
+	return strings.Join(r.Expected, ",") == strings.Join(r.Predicted, ",")
+}
+
+// scoreParams fills in the action comparison. A nil got (extraction failed
+// or the prompt was blocked) scores every expected parameter as wrong.
+func (r *CaseResult) scoreParams(expected *ExpectedAction, got *factories.TicketmasterAction) {
+	if expected == nil {
+		return
+	}
+
+	ar := &ActionResult{Expected: expected.Action}
+	gotParams := map[string]string{}
+	if got != nil {
+		ar.Got = got.Action
+		ar.Correct = strings.EqualFold(got.Action, expected.Action)
+		gotParams = got.Parameters
+	}
+
+	names := make([]string, 0, len(expected.Parameters))
+	for name := range expected.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		want, have := expected.Parameters[name], gotParams[name]
+		ar.Params = append(ar.Params, ParamResult{
+			Name:     name,
+			Expected: want,
+			Got:      have,
+			Correct:  paramMatches(want, have),
+		})
+	}
+	for name := range gotParams {
+		if _, ok := expected.Parameters[name]; !ok {
+			ar.Unexpected = append(ar.Unexpected, name)
+		}
+	}
+	sort.Strings(ar.Unexpected)
+
+	r.Action = ar
+}
+
+// paramMatches compares parameter values ignoring case and surrounding space
+func paramMatches(want, have string) bool {
+	have = strings.TrimSpace(have)
+	if want == AnyValue {
+		return have != ""
+	}
+	return strings.EqualFold(strings.TrimSpace(want), have)
+}
+
+// ServiceScore is the routing quality for one service
+type ServiceScore struct {
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	FalseNegatives int     `json:"false_negatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	F1             float64 `json:"f1"`
+}
+
+// Accuracy is a count of correct answers out of a total
+type Accuracy struct {
+	Total    int     `json:"total"`
+	Correct  int     `json:"correct"`
+	Accuracy float64 `json:"accuracy"`
+}
+
+// LatencyStats summarizes the latency of one pipeline stage in milliseconds
+type LatencyStats struct {
+	Count  int     `json:"count"`
+	MeanMS float64 `json:"mean_ms"`
+	P50MS  float64 `json:"p50_ms"`
+	P95MS  float64 `json:"p95_ms"`
+	MaxMS  float64 `json:"max_ms"`
+}
+
+// Summary is the aggregate score of a run
+type Summary struct {
+	Cases int `json:"cases"`
+	// Errors counts cases that failed for reasons other than the input guard
+	Errors   int                      `json:"errors"`
+	Blocked  int                      `json:"blocked"`
+	Services map[string]*ServiceScore `json:"services"`
+	// Routing counts cases routed to exactly the expected set of services
+	Routing Accuracy `json:"routing"`
+	Action  Accuracy `json:"action"`
+	Params  Accuracy `json:"params"`
+	// UnexpectedParams counts extracted parameters the dataset did not list
+	UnexpectedParams int                     `json:"unexpected_params"`
+	Latency          map[string]LatencyStats `json:"latency"`
+	Usage            usage.Summary           `json:"usage"`
+}
+
+// Report is the full output of an evaluation run
+type Report struct {
+	GeneratedAt         time.Time         `json:"generated_at"`
+	BaselineGeneratedAt *time.Time        `json:"baseline_generated_at,omitempty"`
+	Dataset             string            `json:"dataset"`
+	Mode                string            `json:"mode"`
+	Threshold           int               `json:"threshold"`
+	Templates           map[string]string `json:"templates"`
+	Summary             Summary           `json:"summary"`
+	Diff                Diff              `json:"diff,omitempty"`
+	Results             []CaseResult      `json:"results"`
+}
+
+// score aggregates the case results into the summary
+func (rep *Report) score() {
+	s := Summary{
+		Cases:    len(rep.Results),
+		Services: make(map[string]*ServiceScore),
+	}
+	for _, service := range guard.ValidServices {
+		s.Services[service] = &ServiceScore{}
+	}
+
+	var classification, extraction []float64
+	for _, r := range rep.Results {
+		if r.Blocked {
+			s.Blocked++
+		} else if r.Error != "" {
+			s.Errors++
+		}
+
+		expected := toSet(r.Expected)
+		predicted := toSet(r.Predicted)
+		for service := range union(expected, predicted) {
+			score, ok := s.Services[service]
+			if !ok {
+				score = &ServiceScore{}
+				s.Services[service] = score
+			}
+			switch {
+			case expected[service] && predicted[service]:
+				score.TruePositives++
+			case predicted[service]:
+				score.FalsePositives++
+			default:
+				score.FalseNegatives++
+			}
+		}
+
+		s.Routing.Total++
+		if r.routed() {
+			s.Routing.Correct++
+		}
+
+		if r.Action != nil {
+			s.Action.Total++
+			if r.Action.Correct {
+				s.Action.Correct++
+			}
+			for _, p := range r.Action.Params {
+				s.Params.Total++
+				if p.Correct {
+					s.Params.Correct++
+				}
+			}
+			s.UnexpectedParams += len(r.Action.Unexpected)
+		}
+
+		if !r.Blocked {
+			classification = append(classification, r.ClassificationMS)
+		}
+		if r.ExtractionMS > 0 {
+			extraction = append(extraction, r.ExtractionMS)
+		}
+
+		s.Usage.Calls += r.Usage.Calls
+		s.Usage.PromptTokens += r.Usage.PromptTokens
+		s.Usage.CompletionTokens += r.Usage.CompletionTokens
+		s.Usage.TotalTokens += r.Usage.TotalTokens
+		s.Usage.CostUSD += r.Usage.CostUSD
+	}
+
+	for _, score := range s.Services {
+		score.Precision = ratio(score.TruePositives, score.TruePositives+score.FalsePositives)
+		score.Recall = ratio(score.TruePositives, score.TruePositives+score.FalseNegatives)
+		if score.Precision+score.Recall > 0 {
+			score.F1 = 2 * score.Precision * score.Recall / (score.Precision + score.Recall)
+		}
+	}
+	s.Routing.Accuracy = ratio(s.Routing.Correct, s.Routing.Total)
+	s.Action.Accuracy = ratio(s.Action.Correct, s.Action.Total)
+	s.Params.Accuracy = ratio(s.Params.Correct, s.Params.Total)
+	s.Latency = map[string]LatencyStats{
+		metrics.StageClassification:   latencyStats(classification),
+		metrics.StageActionExtraction: latencyStats(extraction),
+	}
+
+	rep.Summary = s
+}
+
+// ratio returns n/d, treating an empty denominator as a perfect score since
+// there was nothing to get wrong
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 1
+	}
+	return float64(n) / float64(d)
+}
+
+func latencyStats(samples []float64) LatencyStats {
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	return LatencyStats{
+		Count:  len(sorted),
+		MeanMS: sum / float64(len(sorted)),
+		P50MS:  percentile(sorted, 50),
+		P95MS:  percentile(sorted, 95),
+		MaxMS:  sorted[len(sorted)-1],
+	}
+}
+
+// percentile uses the nearest-rank method on sorted samples
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+func union(a, b map[string]bool) map[string]bool {
+	out := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		out[k] = true
+	}
+	for k := range b {
+		out[k] = true
+	}
+	return out
+}
+
+func loadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rep Report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &rep, nil
+}
+
+func (rep *Report) writeJSON(path string) error {
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
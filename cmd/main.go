@@ -1,44 +1,297 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
+	"go-backend/admin"
+	"go-backend/alerts"
+	"go-backend/batch"
+	"go-backend/breaker"
+	"go-backend/chat"
+	"go-backend/dates"
 	"go-backend/factories"
-	"log"
+	"go-backend/geo"
+	"go-backend/graphqlapi"
+	"go-backend/grpcapi"
+	"go-backend/health"
+	"go-backend/jobs"
+	"go-backend/locale"
+	"go-backend/logging"
+	"go-backend/metrics"
+	"go-backend/openapi"
+	"go-backend/prompts"
+	"go-backend/ratelimit"
+	"go-backend/replay"
+	"go-backend/storage"
+	"go-backend/tracing"
+	"go-backend/usage"
+	"go-backend/webhook"
+	"log/slog"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// Set at build time with -ldflags "-X main.version=... -X main.commit=... -X main.buildTime=..."
+var (
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
+)
+
 func commonMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Request-ID, traceparent, tracestate")
 		next.ServeHTTP(w, r)
 	})
 }
 
 func main() {
+	// JSON logs with secrets redacted; the level comes from LOG_LEVEL
+	logger := logging.FromEnv()
+	slog.SetDefault(logger)
+
+	// Tracing is configured from the OTEL_* environment variables
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		logger.Error("Error setting up tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
 	router := mux.NewRouter()
 	router.Use(commonMiddleware)
+	router.Use(logging.RequestIDMiddleware)
+	router.Use(tracing.Middleware)
+	router.Use(metrics.Middleware)
+
+	// Upstream traffic can be recorded to or replayed from fixtures (UPSTREAM_MODE)
+	upstreamMode := replay.ModeFromEnv()
+	if upstreamMode != replay.ModeLive {
+		factories.HTTPClient = replay.NewClient(upstreamMode, replay.DirFromEnv())
+		logger.Info("Upstream traffic is not live", "mode", upstreamMode, "fixtures", replay.DirFromEnv())
+		// Requests carry the current date, so fixtures only match on another
+		// day when the clock is pinned to the one they were recorded with
+		if os.Getenv("FIXED_NOW") == "" {
+			logger.Warn("FIXED_NOW is not set; fixtures will only match requests made on the day they were recorded")
+		}
+	}
+
+	// Prompt templates: embedded by default, or loaded and hot reloaded from PROMPTS_DIR
+	promptEnv := prompts.EnvironmentFromEnv()
+	if dir := os.Getenv("PROMPTS_DIR"); dir != "" {
+		store, err := prompts.LoadDir(dir, promptEnv)
+		if err != nil {
+			logger.Error("Error loading prompt templates", "dir", dir, "error", err)
+			os.Exit(1)
+		}
+		prompts.SetDefault(store)
+		go store.Watch(context.Background(), dir, envDuration("PROMPTS_RELOAD_INTERVAL", 5*time.Second), logger)
+	}
+	logger.Info("Prompt templates selected", "environment", promptEnv, "versions", prompts.Default().Selected())
 
 	// Create a new service director
-	serviceDirector := factories.NewServiceDirector()
+	serviceDirector := factories.NewServiceDirector(logger)
+
+	// Prompts are resolved to a location from the places they name, the
+	// client's coordinates or its IP address (GEOCODER, GAZETTEER_FILE, GEOIP_FILE)
+	serviceDirector.Locations, err = geo.ResolverFromEnv()
+	if err != nil {
+		logger.Error("Error setting up location resolution", "error", err)
+		os.Exit(1)
+	}
+	// Activities are ranked by distance from the prompt's location with the same geocoder
+	serviceDirector.Ranking.Geocoder = serviceDirector.Locations.Geocoder
+
+	// Per-client rate limiting and daily quotas (read after the director has loaded .env)
+	limitConfig := ratelimit.ConfigFromEnv()
+	limiter := ratelimit.NewLimiter(limitConfig.RequestsPerSecond, limitConfig.Burst)
+	quotas := ratelimit.NewQuotas(limitConfig.Limits)
+	ratelimit.SetAPIKeys(limitConfig.APIKeys)
+	if len(limitConfig.APIKeys) == 0 {
+		logger.Warn("API_KEYS is not set; every client is identified by its IP address")
+	}
+
+	// Upstreams that keep failing are turned away for a while (BREAKER_FAILURES, BREAKER_COOLDOWN)
+	breakerConfig := breaker.ConfigFromEnv()
+	factories.OpenAIBreaker = breaker.New(metrics.UpstreamOpenAI, breakerConfig)
+	factories.TicketmasterBreaker = breaker.New(metrics.UpstreamTicketmaster, breakerConfig)
+
+	// Readiness needs credentials, reachable upstreams and closed breakers.
+	// Replay mode runs offline, so neither credentials nor upstreams are checked.
+	var checks []health.Check
+	if upstreamMode != replay.ModeReplay {
+		checks = append(checks,
+			health.EnvCheck("OPENAI_API_KEY", "TICKETMASTER_API_KEY"),
+			health.UpstreamCheck("openai", factories.OpenAIBaseURL()+"/models", 30*time.Second),
+			health.UpstreamCheck("ticketmaster", factories.TicketmasterBaseURL()+"/", 30*time.Second),
+			health.Check{Name: "openai_breaker", Run: func(context.Context) error { return factories.OpenAIBreaker.Err() }},
+			health.Check{Name: "ticketmaster_breaker", Run: func(context.Context) error { return factories.TicketmasterBreaker.Err() }},
+		)
+	}
+	checker := health.NewChecker(5*time.Second, checks...)
+
+	// Operational endpoints are registered first so probes and scrapes are not rate limited
+	router.HandleFunc("/healthz", checker.Liveness).Methods("GET")
+	router.HandleFunc("/readyz", checker.Readiness).Methods("GET")
+	router.HandleFunc("/version", health.VersionHandler(health.NewBuildInfo(version, commit, buildTime))).Methods("GET")
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	// Runtime variables include the command line and memory statistics, so
+	// they are only shown to the holder of the admin key (ADMIN_KEY)
+	adminKey := admin.KeyFromEnv()
+	router.Handle("/debug/vars", admin.Only(adminKey, expvar.Handler())).Methods("GET")
+	// Process-wide LLM usage, including the per-client breakdown
+	router.Handle("/admin/usage", admin.Only(adminKey, http.HandlerFunc(admin.UsageHandler))).Methods("GET")
+	router.HandleFunc("/openapi.json", openapi.Handler).Methods("GET")
+
+	// Requests are checked against the OpenAPI document before they reach a handler
+	apiDoc, err := openapi.Load()
+	if err != nil {
+		logger.Error("Error loading the OpenAPI document", "error", err)
+		os.Exit(1)
+	}
+
+	api := router.PathPrefix("/").Subrouter()
+	api.Use(ratelimit.Middleware(limiter, quotas))
+	api.Use(geo.Middleware)
+	api.Use(dates.Middleware)
+	api.Use(locale.Middleware)
+	api.Use(openapi.NewValidator(apiDoc).Middleware)
+
+	// Optional price table for LLM cost estimates
+	if path := os.Getenv("LLM_PRICES_FILE"); path != "" {
+		prices, err := usage.LoadPriceTable(path)
+		if err != nil {
+			logger.Error("Error loading LLM price table", "error", err)
+			os.Exit(1)
+		}
+		usage.SetPrices(prices)
+	}
 
 	// Start a simple server to verify the server is running
-	router.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, "Server check verified")
 	}).Methods("GET")
 
 	//Process Prompt
-	router.HandleFunc("/promptOpenAI", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/promptOpenAI", func(w http.ResponseWriter, r *http.Request) {
 		serviceDirector.ProcessPrompt(w, r)
 	}).Methods("POST")
 
-	port := "8000"
-	log.Println("Server listening on port", port)
-	if err := http.ListenAndServe(":"+port, router); err != nil {
-		log.Fatal("Error starting server:", err)
+	// Report the calling client's usage against its daily quotas
+	api.HandleFunc("/usage", ratelimit.UsageHandler(quotas)).Methods("GET")
+
+	// Plans, services, events and venues as GraphQL, for clients that pick
+	// their fields and combine lookups in one request (GRAPHQL_MAX_DEPTH,
+	// GRAPHQL_MAX_COMPLEXITY)
+	graphqlSchema, err := graphqlapi.NewSchema(serviceDirector)
+	if err != nil {
+		logger.Error("Error building the GraphQL schema", "error", err)
+		os.Exit(1)
+	}
+	api.Handle("/graphql", &graphqlapi.Handler{Schema: graphqlSchema, Limits: graphqlapi.LimitsFromEnv()}).Methods("POST")
+
+	// Chat sessions over a WebSocket: prompts in, rankings, progress, results
+	// and clarifying questions out (CHAT_ALLOWED_ORIGINS, CHAT_PING_INTERVAL,
+	// CHAT_MAX_MESSAGE_BYTES)
+	chatHandler := chat.NewHandler(chat.ConfigFromEnv(), serviceDirector, limiter, quotas, logger)
+	api.Handle("/ws", chatHandler).Methods("GET")
+
+	// Prompt history and saved searches (SQLite at STORAGE_DSN unless
+	// STORAGE_DRIVER=none), queried at /history and managed at /searches
+	history, err := storage.FromEnv()
+	switch {
+	case errors.Is(err, storage.ErrDisabled):
+		logger.Info("Prompt history and saved searches are disabled")
+	case err != nil:
+		logger.Error("Error opening prompt history", "error", err)
+		os.Exit(1)
+	default:
+		defer history.Close()
+		serviceDirector.History = history
+		historyHandler := storage.NewHandler(history)
+		api.HandleFunc("/history", historyHandler.List).Methods("GET")
+		api.HandleFunc("/history/{id}", historyHandler.Get).Methods("GET")
+	}
+
+	// Signed callbacks for async jobs and saved search alerts
+	callbacks := webhook.NewSender(webhook.ConfigFromEnv())
+
+	// Background jobs (async prompts and batches), polled at /jobs/{id} and
+	// optionally reported to a signed callback. Job status is kept in JOBS_DIR
+	// (data/jobs by default), so unfinished jobs resume after a restart.
+	jobStore, err := jobs.StoreFromEnv()
+	if err != nil {
+		logger.Error("Error opening job store", "error", err)
+		os.Exit(1)
+	}
+	jobManager := jobs.NewManager(jobs.ConfigFromEnv(), jobStore, callbacks, logger)
+	serviceDirector.Jobs = jobManager
+
+	batchConfig := batch.ConfigFromEnv()
+	batchHandler := &batch.Handler{
+		Runner:       &batch.Runner{Director: serviceDirector, Concurrency: batchConfig.Concurrency},
+		Jobs:         jobManager,
+		MaxItems:     batchConfig.MaxItems,
+		MaxSyncItems: batchConfig.MaxSyncItems,
+	}
+	jobManager.Handle(factories.PromptJobKind, serviceDirector.RunJob)
+	jobManager.Handle(batch.JobKind, batchHandler.RunJob)
+	if err := jobManager.Start(); err != nil {
+		logger.Error("Error starting job manager", "error", err)
+		os.Exit(1)
+	}
+
+	api.Handle("/batch", batchHandler).Methods("POST")
+	api.HandleFunc("/jobs/{id}", jobs.StatusHandler(jobManager)).Methods("GET")
+
+	background := []backgroundService{chatHandler, jobManager}
+
+	// Saved searches are re-run on a schedule and new events reported through
+	// the ALERT_NOTIFIERS
+	if history != nil {
+		notifier, err := alerts.NotifierFromEnv(logger, callbacks)
+		if err != nil {
+			logger.Error("Error setting up alert notifiers", "error", err)
+			os.Exit(1)
+		}
+		alertConfig := alerts.ConfigFromEnv()
+		scheduler := alerts.NewScheduler(alertConfig, history,
+			alerts.TicketmasterSearcher(serviceDirector.Factories["Ticketing"]), notifier, logger)
+		scheduler.Start()
+		background = append(background, scheduler)
+
+		searchHandler := &alerts.Handler{Repo: history, Director: serviceDirector, Callbacks: callbacks, Config: alertConfig}
+		api.HandleFunc("/searches", searchHandler.Create).Methods("POST")
+		api.HandleFunc("/searches", searchHandler.List).Methods("GET")
+		api.HandleFunc("/searches/{id}", searchHandler.Get).Methods("GET")
+		api.HandleFunc("/searches/{id}", searchHandler.Delete).Methods("DELETE")
 	}
 
+	// The same pipeline is served over gRPC on GRPC_PORT, unless it is "off"
+	grpcServer, err := grpcapi.NewServer(grpcapi.ConfigFromEnv(), serviceDirector, limiter, quotas, logger)
+	switch {
+	case errors.Is(err, grpcapi.ErrDisabled):
+		logger.Info("gRPC server is disabled")
+	case err != nil:
+		logger.Error("Error setting up the gRPC server", "error", err)
+		os.Exit(1)
+	default:
+		if err := grpcServer.Start(); err != nil {
+			logger.Error("Error starting the gRPC server", "error", err)
+			os.Exit(1)
+		}
+		background = append(background, grpcServer)
+	}
+
+	if err := runServer(logger, serverConfigFromEnv(), router, checker, background...); err != nil {
+		logger.Error("Server error", "error", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,123 @@
+// Command mockupstreams is a stand-in for the OpenAI chat completions API and
+// the Ticketmaster Discovery API, for local development and CI.
+//
+// Point the backend at it with
+//
+//	OPENAI_BASE_URL=http://localhost:9000/v1
+//	TICKETMASTER_BASE_URL=http://localhost:9000/discovery/v2
+//
+// Responses can be scripted with a JSON file (-script) or replaced at runtime
+// by POSTing a config to /_mock/config. Latency and failure modes (429, 500,
+// malformed JSON, markdown-fenced JSON) can be injected globally or per rule.
+package main
+
+import (
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "address to listen on")
+	scriptPath := flag.String("script", "", "JSON file with scripted responses")
+	latency := flag.Duration("latency", 0, "delay added to every response")
+	mode := flag.String("mode", "", "failure mode for every response: 429, 500, malformed or fenced")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	var cfg Config
+	if *scriptPath != "" {
+		var err error
+		cfg, err = loadConfig(*scriptPath)
+		if err != nil {
+			logger.Error("Error loading script", "error", err)
+			os.Exit(1)
+		}
+	}
+	if *latency > 0 {
+		cfg.Latency = latency.String()
+	}
+	if *mode != "" {
+		cfg.Mode = *mode
+	}
+
+	s := &script{}
+	s.set(cfg)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/_mock/config", s.configHandler).Methods("GET", "POST", "PUT")
+	router.HandleFunc("/v1/chat/completions", s.chatCompletions).Methods("POST")
+	router.HandleFunc("/discovery/v2/{resource}.json", s.discovery).Methods("GET")
+	router.HandleFunc("/discovery/v2/{resource}/{id}.json", s.discovery).Methods("GET")
+	router.HandleFunc("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"object": "list", "data": []interface{}{}})
+	}).Methods("GET", "HEAD")
+	router.HandleFunc("/discovery/v2/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET", "HEAD")
+	router.Use(logRequests(logger))
+
+	logger.Info("Mock upstreams listening", "addr", *addr)
+	srv := &http.Server{Addr: *addr, Handler: router, ReadHeaderTimeout: 5 * time.Second}
+	if err := srv.ListenAndServe(); err != nil {
+		logger.Error("Server error", "error", err)
+		os.Exit(1)
+	}
+}
+
+// serve applies the latency and failure mode in effect, then writes body
+func (s *script) serve(w http.ResponseWriter, resp Response, body []byte) {
+	latency, mode := s.defaults()
+	if resp.Delay != "" {
+		latency, _ = time.ParseDuration(resp.Delay)
+	}
+	if resp.Mode != "" {
+		mode = resp.Mode
+	}
+	time.Sleep(latency)
+
+	switch mode {
+	case modeRateLimit:
+		w.Header().Set("Retry-After", "1")
+		writeJSON(w, http.StatusTooManyRequests, errorBody("Rate limit reached", "rate_limit_exceeded"))
+		return
+	case modeServer:
+		writeJSON(w, http.StatusInternalServerError, errorBody("The server had an error processing your request", "server_error"))
+		return
+	case modeMalformed:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, `{"choices": [{"message": {"content": "`)
+		return
+	}
+
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func errorBody(message, code string) map[string]interface{} {
+	return map[string]interface{}{
+		"error": map[string]interface{}{"message": message, "type": code, "code": code},
+	}
+}
+
+func logRequests(logger *slog.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			next.ServeHTTP(w, r)
+			logger.Info("Request", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start).String())
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var completionID atomic.Int64
+
+// Canned replies for the three prompts the backend sends, used when no rule matches
+const (
+	classifierReply = `[
+  {"service": "Ticketing", "applicability": "95"},
+  {"service": "Accommodations", "applicability": "20"},
+  {"service": "Restaurants", "applicability": "35"}
+]`
+	actionReply    = `{"action": "events", "parameters": {"keyword": "music", "city": "Chicago", "size": 5}}`
+	formatterReply = `{
+  "activity1": {"image": "https://example.com/images/jazz.jpg", "activity_name": "Mock Jazz Night", "time": "19:30", "date": "2030-06-01", "location": "Mock Hall, Chicago", "details": "An evening of live jazz", "link": "https://example.com/events/mock-1"},
+  "activity2": {"image": "https://example.com/images/rock.jpg", "activity_name": "Mock Rock Show", "time": "20:00", "date": "2030-06-08", "location": "Mock Arena, Chicago", "details": "Rock headliner with support", "link": "https://example.com/events/mock-2"}
+}`
+)
+
+// chatCompletions serves /v1/chat/completions
+func (s *script) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading body", http.StatusBadRequest)
+		return
+	}
+	body := string(data)
+
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody("We could not parse the JSON body of your request", "invalid_request_error"))
+		return
+	}
+
+	resp, ok := s.lookup(r, body)
+	if ok && len(resp.Body) > 0 {
+		s.serve(w, resp, resp.Body)
+		return
+	}
+
+	content := resp.Content
+	if content == "" {
+		content = defaultReply(body)
+	}
+
+	_, mode := s.defaults()
+	if resp.Mode != "" {
+		mode = resp.Mode
+	}
+	if mode == modeFenced {
+		content = "```json\n" + content + "\n```"
+	}
+
+	s.serve(w, resp, completion(req.Model, body, content))
+}
+
+// defaultReply picks a canned reply by recognising which prompt was sent
+func defaultReply(body string) string {
+	switch {
+	case strings.Contains(body, "applicab"):
+		return classifierReply
+	case strings.Contains(body, "Ticketmaster API action"), strings.Contains(body, "Ticketmaster Discovery API action"):
+		return actionReply
+	case strings.Contains(body, "activity_name"):
+		return formatterReply
+	default:
+		return "{}"
+	}
+}
+
+// completion wraps content in a chat completion envelope with rough token counts
+func completion(model, prompt, content string) []byte {
+	if model == "" {
+		model = "gpt-3.5-turbo"
+	}
+	promptTokens := len(prompt) / 4
+	completionTokens := len(content) / 4
+
+	out, _ := json.Marshal(map[string]interface{}{
+		"id":      fmt.Sprintf("chatcmpl-mock-%d", completionID.Add(1)),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   model + "-mock",
+		"choices": []interface{}{
+			map[string]interface{}{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": content},
+				"finish_reason": "stop",
+			},
+		},
+		"usage": map[string]int{
+			"prompt_tokens":     promptTokens,
+			"completion_tokens": completionTokens,
+			"total_tokens":      promptTokens + completionTokens,
+		},
+	})
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
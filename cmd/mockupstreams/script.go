@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Failure modes a rule or the global config can inject
+const (
+	modeNone      = ""
+	modeRateLimit = "429"
+	modeServer    = "500"
+	modeMalformed = "malformed"
+	modeFenced    = "fenced"
+)
+
+// Match selects the requests a rule applies to. Empty fields match anything.
+type Match struct {
+	Method       string            `json:"method,omitempty"`
+	Path         string            `json:"path,omitempty"`
+	BodyContains string            `json:"body_contains,omitempty"`
+	Query        map[string]string `json:"query,omitempty"`
+}
+
+// Response is what a rule serves. For chat completions Content is wrapped in
+// a completion envelope; otherwise Body is served as-is.
+type Response struct {
+	Status  int             `json:"status,omitempty"`
+	Content string          `json:"content,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"`
+	Mode    string          `json:"mode,omitempty"`
+	Delay   string          `json:"delay,omitempty"`
+}
+
+// Rule is one scripted response. Times limits how often it fires, so a rule
+// can fail the first attempt and let the retry fall through to the default.
+type Rule struct {
+	Match    Match    `json:"match"`
+	Response Response `json:"response"`
+	Times    int      `json:"times,omitempty"`
+}
+
+// Config is the mock's behaviour: scripted rules plus defaults for every
+// request that no rule matches
+type Config struct {
+	Latency string `json:"latency,omitempty"`
+	Mode    string `json:"mode,omitempty"`
+	Rules   []Rule `json:"rules,omitempty"`
+}
+
+// script holds the active config and tracks how often each rule has fired
+type script struct {
+	mu    sync.Mutex
+	cfg   Config
+	fired []int
+}
+
+func loadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("error reading script: %v", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("error parsing script: %v", err)
+	}
+	return cfg, nil
+}
+
+func (s *script) set(cfg Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = cfg
+	s.fired = make([]int, len(cfg.Rules))
+}
+
+func (s *script) get() Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+// lookup returns the response of the first rule matching the request, if any
+func (s *script) lookup(r *http.Request, body string) (Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, rule := range s.cfg.Rules {
+		if rule.Times > 0 && s.fired[i] >= rule.Times {
+			continue
+		}
+		if !rule.Match.matches(r, body) {
+			continue
+		}
+		s.fired[i]++
+		return rule.Response, true
+	}
+	return Response{}, false
+}
+
+// defaults returns the global latency and failure mode
+func (s *script) defaults() (time.Duration, string) {
+	cfg := s.get()
+	latency, _ := time.ParseDuration(cfg.Latency)
+	return latency, cfg.Mode
+}
+
+func (m Match) matches(r *http.Request, body string) bool {
+	if m.Method != "" && !strings.EqualFold(m.Method, r.Method) {
+		return false
+	}
+	if m.Path != "" && m.Path != r.URL.Path {
+		return false
+	}
+	if m.BodyContains != "" && !strings.Contains(body, m.BodyContains) {
+		return false
+	}
+	q := r.URL.Query()
+	for k, v := range m.Query {
+		if q.Get(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// configHandler lets tests read or replace the script at runtime
+func (s *script) configHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		var cfg Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, "Invalid config", http.StatusBadRequest)
+			return
+		}
+		s.set(cfg)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.get())
+}
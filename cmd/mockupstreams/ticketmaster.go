@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// discovery serves /discovery/v2/{resource}.json searches and
+// /discovery/v2/{resource}/{id}.json lookups
+func (s *script) discovery(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	resource := vars["resource"]
+
+	if r.URL.Query().Get("apikey") == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"fault": map[string]interface{}{"faultstring": "Invalid ApiKey", "detail": map[string]string{"errorcode": "oauth.v2.InvalidApiKey"}},
+		})
+		return
+	}
+
+	resp, ok := s.lookup(r, "")
+	if ok && len(resp.Body) > 0 {
+		s.serve(w, resp, resp.Body)
+		return
+	}
+
+	items := sampleItems(resource, r.URL.Query().Get("keyword"))
+	if items == nil {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"errors": []map[string]string{{"code": "DIS1004", "detail": "Resource not found"}},
+		})
+		return
+	}
+
+	var body interface{}
+	if id, ok := vars["id"]; ok {
+		item := items[0]
+		item["id"] = id
+		body = item
+	} else {
+		size, err := strconv.Atoi(r.URL.Query().Get("size"))
+		if err != nil || size <= 0 || size > len(items) {
+			size = len(items)
+		}
+		body = map[string]interface{}{
+			"_embedded": map[string]interface{}{resource: items[:size]},
+			"page":      map[string]int{"size": size, "totalElements": len(items), "totalPages": 1, "number": 0},
+		}
+	}
+
+	data, _ := json.Marshal(body)
+	s.serve(w, resp, data)
+}
+
+// sampleItems builds a few plausible Discovery entities for a resource
+func sampleItems(resource, keyword string) []map[string]interface{} {
+	if keyword == "" {
+		keyword = "Mock"
+	}
+
+	switch resource {
+	case "events":
+		var events []map[string]interface{}
+		for i := 1; i <= 3; i++ {
+			date := time.Now().AddDate(0, 0, 7*i).Format("2006-01-02")
+			events = append(events, map[string]interface{}{
+				"id":     fmt.Sprintf("mockEvent%d", i),
+				"name":   fmt.Sprintf("%s Event %d", keyword, i),
+				"type":   "event",
+				"url":    fmt.Sprintf("https://example.com/events/mockEvent%d", i),
+				"images": []map[string]interface{}{{"url": fmt.Sprintf("https://example.com/images/event%d.jpg", i), "ratio": "16_9", "width": 640, "height": 360}},
+				"dates": map[string]interface{}{
+					"start":  map[string]string{"localDate": date, "localTime": "19:30:00", "dateTime": date + "T19:30:00Z"},
+					"status": map[string]string{"code": "onsale"},
+				},
+				"sales": map[string]interface{}{
+					"public": map[string]string{"startDateTime": "2020-01-01T10:00:00Z", "endDateTime": date + "T19:30:00Z"},
+				},
+				"priceRanges": []map[string]interface{}{{"type": "standard", "currency": "USD", "min": 25.0 * float64(i), "max": 75.0 * float64(i)}},
+				"classifications": []map[string]interface{}{
+					{"segment": map[string]string{"id": "KZFzniwnSyZfZ7v7nJ", "name": "Music"}, "genre": map[string]string{"id": "KnvZfZ7vAvE", "name": "Jazz"}},
+				},
+				"_embedded": map[string]interface{}{"venues": sampleItems("venues", "")[:1]},
+			})
+		}
+		return events
+	case "venues":
+		return []map[string]interface{}{{
+			"id":         "mockVenue1",
+			"name":       "Mock Hall",
+			"type":       "venue",
+			"url":        "https://example.com/venues/mockVenue1",
+			"city":       map[string]string{"name": "Chicago"},
+			"state":      map[string]string{"stateCode": "IL"},
+			"country":    map[string]string{"countryCode": "US"},
+			"postalCode": "60601",
+			"address":    map[string]string{"line1": "1 Mock Street"},
+			"location":   map[string]string{"latitude": "41.8837", "longitude": "-87.6289"},
+		}}
+	case "attractions":
+		return []map[string]interface{}{{
+			"id":   "mockAttraction1",
+			"name": keyword + " Band",
+			"type": "attraction",
+			"url":  "https://example.com/attractions/mockAttraction1",
+		}}
+	case "classifications":
+		return []map[string]interface{}{{
+			"segment": map[string]string{"id": "KZFzniwnSyZfZ7v7nJ", "name": "Music"},
+		}}
+	default:
+		return nil
+	}
+}
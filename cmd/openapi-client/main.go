@@ -0,0 +1,493 @@
+// Command openapi-client generates the client package from the OpenAPI
+// document in package openapi: a Go type for every component schema and a
+// method for every operation.
+//
+//	go generate ./client
+//
+// or, by hand:
+//
+//	go run ./cmd/openapi-client -out client/api_gen.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"go-backend/openapi"
+)
+
+func main() {
+	out := flag.String("out", "api_gen.go", "file to write")
+	pkg := flag.String("package", "client", "package name of the generated file")
+	flag.Parse()
+
+	doc, err := openapi.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	g := &generator{doc: doc}
+	src, err := g.generate(*pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type generator struct {
+	doc     *openapi.Document
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generate(pkg string) ([]byte, error) {
+	g.imports = map[string]bool{"context": true, "net/http": true}
+
+	g.buf.Reset()
+	g.types()
+	g.operations()
+	code := g.buf.Bytes()
+
+	var file bytes.Buffer
+	fmt.Fprintf(&file, "// Code generated by cmd/openapi-client from openapi/openapi.json. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&file, "package %s\n\n", pkg)
+	var imports []string
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	fmt.Fprintf(&file, "import (\n")
+	for _, imp := range imports {
+		fmt.Fprintf(&file, "\t%q\n", imp)
+	}
+	fmt.Fprintf(&file, ")\n")
+	file.Write(code)
+
+	src, err := format.Source(file.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error formatting generated code: %v\n%s", err, file.Bytes())
+	}
+	return src, nil
+}
+
+// types generates a type for every component schema
+func (g *generator) types() {
+	names := sortedKeys(g.doc.Components.Schemas)
+	for _, name := range names {
+		s := g.doc.Components.Schemas[name]
+		g.printf("\n")
+		g.comment(name, s.Description)
+
+		switch {
+		case s.Type == "string" && len(s.Enum) > 0:
+			g.printf("type %s string\n\n", name)
+			g.printf("const (\n")
+			for _, e := range s.Enum {
+				v := fmt.Sprint(e)
+				g.printf("\t%s%s %s = %q\n", name, goName(v), name, v)
+			}
+			g.printf(")\n")
+		case s.Type == "object" && len(s.Properties) > 0:
+			g.printf("type %s struct {\n", name)
+			for _, prop := range sortedKeys(s.Properties) {
+				ps := s.Properties[prop]
+				required := contains(s.Required, prop)
+				if d := g.doc.Resolve(ps).Description; ps.Ref == "" && d != "" {
+					for _, line := range wrap(d, 70) {
+						g.printf("\t// %s\n", line)
+					}
+				}
+				tag := prop
+				if !required {
+					tag += ",omitempty"
+				}
+				g.printf("\t%s %s `json:%q`\n", goName(prop), g.goType(ps, required), tag)
+			}
+			g.printf("}\n")
+		default:
+			g.printf("type %s %s\n", name, g.goType(s, true))
+		}
+	}
+}
+
+// goType is the Go type for values of s. Optional numbers and objects are
+// pointers so that zero can be told apart from absent.
+func (g *generator) goType(s *openapi.Schema, required bool) string {
+	if name := openapi.RefName(s); name != "" {
+		target := g.doc.Resolve(s)
+		if !required && target != nil && target.Type == "object" {
+			return "*" + name
+		}
+		return name
+	}
+	if len(s.OneOf) > 0 {
+		g.imports["encoding/json"] = true
+		return "json.RawMessage"
+	}
+
+	var t string
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			g.imports["time"] = true
+			t = "time.Time"
+			if !required {
+				return "*" + t
+			}
+			return t
+		}
+		return "string"
+	case "integer":
+		t = "int"
+	case "number":
+		t = "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + g.goType(s.Items, true)
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "map[string]" + g.goType(s.AdditionalProperties, true)
+		}
+		return "map[string]interface{}"
+	default:
+		g.imports["encoding/json"] = true
+		return "json.RawMessage"
+	}
+	if !required {
+		return "*" + t
+	}
+	return t
+}
+
+type method struct {
+	path, verb string
+	op         *openapi.Operation
+}
+
+// operations generates a Client method for every operation but WebSocket
+// handshakes
+func (g *generator) operations() {
+	var methods []method
+	for _, path := range sortedKeys(g.doc.Paths) {
+		for _, verb := range []string{"get", "post", "put", "patch", "delete"} {
+			op := g.doc.Paths[path][verb]
+			if op == nil {
+				continue
+			}
+			// WebSocket handshakes need a WebSocket client rather than a method
+			if _, upgrade := op.Responses["101"]; upgrade {
+				continue
+			}
+			methods = append(methods, method{path: path, verb: verb, op: op})
+		}
+	}
+	for _, m := range methods {
+		g.operation(m)
+	}
+}
+
+func (g *generator) operation(m method) {
+	op := m.op
+	name := goName(op.OperationID)
+
+	var pathParams, otherParams []openapi.Parameter
+	for _, p := range op.Parameters {
+		if p.In == "path" {
+			pathParams = append(pathParams, p)
+		} else {
+			otherParams = append(otherParams, p)
+		}
+	}
+
+	// Query and header parameters go in a struct of their own
+	paramsType := ""
+	if len(otherParams) > 0 {
+		paramsType = name + "Params"
+		g.printf("\n// %s are the optional parameters of %s\n", paramsType, name)
+		g.printf("type %s struct {\n", paramsType)
+		for _, p := range otherParams {
+			if p.Description != "" {
+				for _, line := range wrap(p.Description, 70) {
+					g.printf("\t// %s\n", line)
+				}
+			}
+			g.printf("\t%s %s\n", goName(p.Name), g.goType(p.Schema, p.Required || p.Schema.Type == "string"))
+		}
+		g.printf("}\n")
+	}
+
+	result, resultCode, resultText := g.response(op, false)
+	accepted, _, _ := g.response(op, true)
+
+	args := []string{"ctx context.Context"}
+	for _, p := range pathParams {
+		args = append(args, lowerFirst(goName(p.Name))+" string")
+	}
+	bodyType := ""
+	if op.RequestBody != nil {
+		if media, ok := op.RequestBody.Content[openapi.JSONContent]; ok {
+			bodyType = g.goType(media.Schema, true)
+			args = append(args, "body "+bodyType)
+		}
+	}
+	if paramsType != "" {
+		args = append(args, "params *"+paramsType)
+	}
+
+	var results []string
+	if result != "" {
+		results = append(results, result)
+	}
+	if accepted != "" {
+		results = append(results, "*"+accepted)
+	}
+	results = append(results, "error")
+
+	g.printf("\n// %s calls %s %s: %s.", name, strings.ToUpper(m.verb), m.path, lowerFirst(op.Summary))
+	if accepted != "" {
+		g.printf("\n// If the request is queued instead, the second result is set.")
+	}
+	g.printf("\nfunc (c *Client) %s(%s) (%s) {\n", name, strings.Join(args, ", "), strings.Join(results, ", "))
+
+	// Path
+	path := fmt.Sprintf("%q", m.path)
+	for _, p := range pathParams {
+		g.imports["net/url"] = true
+		g.imports["strings"] = true
+		path = fmt.Sprintf("strings.Replace(%s, %q, url.PathEscape(%s), 1)", path, "{"+p.Name+"}", lowerFirst(goName(p.Name)))
+	}
+	g.printf("\tpath := %s\n", path)
+
+	// Query and headers
+	g.printf("\tvar query url.Values\n\theader := make(http.Header)\n")
+	g.imports["net/url"] = true
+	if paramsType != "" {
+		g.printf("\tif params != nil {\n")
+		for _, p := range otherParams {
+			field := "params." + goName(p.Name)
+			set := fmt.Sprintf("header.Set(%q, %%s)", p.Name)
+			if p.In == "query" {
+				set = fmt.Sprintf("query = addQuery(query, %q, %%s)", p.Name)
+			}
+			switch {
+			case p.Schema.Type == "string":
+				g.printf("\t\tif %s != \"\" {\n\t\t\t%s\n\t\t}\n", field, fmt.Sprintf(set, field))
+			default:
+				g.imports["fmt"] = true
+				g.printf("\t\tif %s != nil {\n\t\t\t%s\n\t\t}\n", field, fmt.Sprintf(set, "fmt.Sprint(*"+field+")"))
+			}
+		}
+		g.printf("\t}\n")
+	}
+
+	bodyArg := "nil"
+	if bodyType != "" {
+		bodyArg = "body"
+	}
+	g.printf("\tstatus, data, err := c.do(ctx, %q, path, query, header, %s)\n", strings.ToUpper(m.verb), bodyArg)
+
+	zero := func() string {
+		var z []string
+		if result != "" {
+			z = append(z, zeroValue(result))
+		}
+		if accepted != "" {
+			z = append(z, "nil")
+		}
+		return strings.Join(append(z, "err"), ", ")
+	}
+	g.printf("\tif err != nil {\n\t\treturn %s\n\t}\n", zero())
+
+	g.printf("\tswitch status {\n")
+	if resultCode != "" {
+		g.printf("\tcase %s:\n", resultCode)
+		switch {
+		case result == "":
+			g.printf("\t\treturn nil\n")
+		case resultText:
+			ret := "string(data)"
+			if accepted != "" {
+				ret += ", nil"
+			}
+			g.printf("\t\treturn %s, nil\n", ret)
+		default:
+			g.printf("\t\tvar out %s\n", result)
+			ret := "out"
+			if accepted != "" {
+				ret += ", nil"
+			}
+			g.printf("\t\treturn %s, decode(data, &out)\n", ret)
+		}
+	}
+	if accepted != "" {
+		g.printf("\tcase 202:\n\t\tvar out %s\n", accepted)
+		ret := "&out, decode(data, &out)"
+		if result != "" {
+			ret = zeroValue(result) + ", " + ret
+		}
+		g.printf("\t\treturn %s\n", ret)
+	}
+	g.printf("\t}\n")
+	err := "newAPIError(status, data)"
+	var z []string
+	if result != "" {
+		z = append(z, zeroValue(result))
+	}
+	if accepted != "" {
+		z = append(z, "nil")
+	}
+	g.printf("\treturn %s\n}\n", strings.Join(append(z, err), ", "))
+}
+
+// response returns the Go type and status code of the operation's success
+// response, or of its 202 response if accepted is set. text reports a
+// text/plain body.
+func (g *generator) response(op *openapi.Operation, accepted bool) (goType, code string, text bool) {
+	for _, c := range sortedKeys(op.Responses) {
+		if !strings.HasPrefix(c, "2") || (c == "202") != accepted {
+			continue
+		}
+		r := op.Responses[c]
+		if media, ok := r.Content[openapi.JSONContent]; ok {
+			t := g.goType(media.Schema, true)
+			if accepted {
+				t = openapi.RefName(media.Schema)
+			}
+			return t, c, false
+		}
+		if _, ok := r.Content["text/plain"]; ok {
+			return "string", c, true
+		}
+		return "", c, false
+	}
+	return "", "", false
+}
+
+func zeroValue(t string) string {
+	switch {
+	case t == "string":
+		return `""`
+	case strings.HasPrefix(t, "[]"), strings.HasPrefix(t, "map["), strings.HasPrefix(t, "*"):
+		return "nil"
+	}
+	return t + "{}"
+}
+
+func (g *generator) comment(name, description string) {
+	if description == "" {
+		return
+	}
+	for _, article := range []string{"The ", "A ", "An "} {
+		if strings.HasPrefix(description, article) {
+			description = name + " is " + lowerFirst(description)
+			break
+		}
+	}
+	for _, line := range wrap(description, 74) {
+		g.printf("// %s\n", line)
+	}
+}
+
+// initialisms are written in capitals in Go names
+var initialisms = map[string]bool{"id": true, "url": true, "uri": true, "ms": true, "usd": true, "km": true, "llm": true, "api": true, "json": true}
+
+// goName turns snake_case, kebab-case and camelCase names into exported Go
+// names: job_id becomes JobID and X-Admin-Key XAdminKey
+func goName(s string) string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+	}
+	for i, r := range s {
+		switch {
+		case r == '_' || r == '-' || r == '.' || r == ' ':
+			flush()
+		case unicode.IsUpper(r) && i > 0 && len(word) > 0 && !unicode.IsUpper(word[len(word)-1]):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+	}
+	flush()
+
+	var b strings.Builder
+	for _, w := range words {
+		lower := strings.ToLower(w)
+		if initialisms[lower] {
+			b.WriteString(strings.ToUpper(lower))
+			continue
+		}
+		b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	// Keep initialisms like "LLM" or "ID" whole
+	if len(s) > 1 && unicode.IsUpper(rune(s[1])) {
+		if strings.ToUpper(s) == s {
+			return strings.ToLower(s)
+		}
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func wrap(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
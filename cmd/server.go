@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go-backend/health"
+)
+
+// serverConfig holds the HTTP server timeouts
+type serverConfig struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	DrainDelay        time.Duration
+}
+
+// serverConfigFromEnv reads the server settings. Prompts fan out to several
+// LLM and upstream calls, so the write timeout is generous by default.
+func serverConfigFromEnv() serverConfig {
+	return serverConfig{
+		Addr:              ":" + envString("PORT", "8000"),
+		ReadTimeout:       envDuration("SERVER_READ_TIMEOUT", 15*time.Second),
+		ReadHeaderTimeout: envDuration("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+		WriteTimeout:      envDuration("SERVER_WRITE_TIMEOUT", 90*time.Second),
+		IdleTimeout:       envDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
+		ShutdownTimeout:   envDuration("SERVER_SHUTDOWN_TIMEOUT", 60*time.Second),
+		DrainDelay:        envDuration("SERVER_DRAIN_DELAY", 0),
+	}
+}
+
+// backgroundService is work that runs alongside the HTTP server, such as the
+// job manager, and is shut down after it
+type backgroundService interface {
+	Shutdown(ctx context.Context) error
+}
+
+// runServer serves handler until SIGINT or SIGTERM, then stops accepting new
+// connections and waits for in-flight requests to finish, then for the
+// background services
+func runServer(logger *slog.Logger, cfg serverConfig, handler http.Handler, checker *health.Checker, background ...backgroundService) error {
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		logger.Info("Server listening", "addr", cfg.Addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Fail readiness first so load balancers stop routing new prompts here
+	logger.Info("Shutting down, draining in-flight requests", "timeout", cfg.ShutdownTimeout.String())
+	checker.SetDraining()
+	time.Sleep(cfg.DrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	// Background work gets whatever is left of the shutdown timeout to finish
+	for _, svc := range background {
+		if err := svc.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("Background work did not finish before shutdown", "service", fmt.Sprintf("%T", svc), "error", err)
+		}
+	}
+
+	logger.Info("Server stopped")
+	return nil
+}
+
+func envString(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
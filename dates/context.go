@@ -0,0 +1,83 @@
+package dates
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+	_ "time/tzdata" // timezones must resolve in minimal containers too
+)
+
+// TimezoneHeader carries the user's IANA timezone, e.g. "America/Chicago"
+const TimezoneHeader = "X-Timezone"
+
+// TicketmasterLayout is the date-time format the Discovery API accepts
+const TicketmasterLayout = "2006-01-02T15:04:05Z"
+
+// Now returns the current time, or FIXED_NOW (RFC 3339) if it is set, so
+// recorded fixtures replay the same requests on any day
+func Now() time.Time {
+	if v := os.Getenv("FIXED_NOW"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
+
+// DefaultTimezone is DEFAULT_TIMEZONE, or UTC if it is unset or invalid
+func DefaultTimezone() *time.Location {
+	if loc, err := time.LoadLocation(os.Getenv("DEFAULT_TIMEZONE")); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// LoadTimezone parses an IANA timezone name. Unlike time.LoadLocation it
+// does not treat "" or "Local" as valid.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, &time.ParseError{Value: name, Message: ": unknown time zone " + name}
+	}
+	return time.LoadLocation(name)
+}
+
+type timezoneKey struct{}
+type rangeKey struct{}
+
+// WithTimezone returns a context carrying the user's timezone
+func WithTimezone(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, timezoneKey{}, loc)
+}
+
+// TimezoneFromContext returns the user's timezone, or DefaultTimezone if the
+// request did not give one
+func TimezoneFromContext(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(timezoneKey{}).(*time.Location); ok {
+		return loc
+	}
+	return DefaultTimezone()
+}
+
+// NewContext returns a context carrying the date range resolved for the prompt
+func NewContext(ctx context.Context, r *Range) context.Context {
+	return context.WithValue(ctx, rangeKey{}, r)
+}
+
+// FromContext returns the date range resolved for the prompt, or nil if it
+// named none the parser understood
+func FromContext(ctx context.Context) *Range {
+	r, _ := ctx.Value(rangeKey{}).(*Range)
+	return r
+}
+
+// Middleware attaches the timezone in the X-Timezone header, if valid, to
+// each request
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if loc, err := LoadTimezone(r.Header.Get(TimezoneHeader)); err == nil {
+			r = r.WithContext(WithTimezone(r.Context(), loc))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
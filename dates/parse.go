@@ -0,0 +1,347 @@
+// Package dates resolves the dates a prompt asks about ("this weekend",
+// "next Friday", "between June 3 and June 5") to a time range, relative to
+// when the request was made and in the user's timezone. Expressions it does
+// not recognise are left to the LLM.
+package dates
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Range is a resolved date range. End is exclusive.
+type Range struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Expr is the part of the prompt the range was resolved from
+	Expr string `json:"expr"`
+}
+
+// EveningStart is when "tonight" and "Friday night" begin
+const EveningStart = 17
+
+// Parse finds the first date expression in text and resolves it relative to
+// now in loc. The range is returned in UTC. Ranges never start before now.
+func Parse(text string, now time.Time, loc *time.Location) (Range, bool) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	p := parser{now: now.In(loc), toks: tokenize(text)}
+
+	for i := range p.toks {
+		r, n, ok := p.between(i)
+		if !ok {
+			r, n, ok = p.point(i)
+		}
+		if !ok {
+			continue
+		}
+		if r.Start.Before(p.now) {
+			r.Start = p.now
+		}
+		if !r.End.After(r.Start) {
+			continue
+		}
+		return Range{
+			Start: r.Start.UTC(),
+			End:   r.End.UTC(),
+			Expr:  strings.Join(p.toks[i:i+n], " "),
+		}, true
+	}
+	return Range{}, false
+}
+
+type parser struct {
+	now  time.Time
+	toks []string
+}
+
+func (p *parser) tok(i int) string {
+	if i < len(p.toks) {
+		return p.toks[i]
+	}
+	return ""
+}
+
+// between parses "between A and B" and "from A to B", spanning the start of
+// A to the end of B
+func (p *parser) between(i int) (Range, int, bool) {
+	if w := p.tok(i); w != "between" && w != "from" {
+		return Range{}, 0, false
+	}
+	a, n1, ok := p.point(i + 1)
+	if !ok {
+		return Range{}, 0, false
+	}
+	switch p.tok(i + 1 + n1) {
+	case "and", "to", "until", "till", "through", "thru":
+	default:
+		return Range{}, 0, false
+	}
+	b, n2, ok := p.point(i + 2 + n1)
+	if !ok {
+		return Range{}, 0, false
+	}
+	// "from Friday to Monday" runs into the week after if B comes first
+	for !b.End.After(a.Start) {
+		b.Start, b.End = b.Start.AddDate(0, 0, 7), b.End.AddDate(0, 0, 7)
+		if b.End.Sub(a.Start) > 366*24*time.Hour {
+			return Range{}, 0, false
+		}
+	}
+	return Range{Start: a.Start, End: b.End}, 2 + n1 + n2, true
+}
+
+// point parses a single date expression at i and reports how many tokens it used
+func (p *parser) point(i int) (Range, int, bool) {
+	today := midnight(p.now)
+
+	switch w := p.tok(i); w {
+	case "today":
+		return Range{Start: p.now, End: today.AddDate(0, 0, 1)}, 1, true
+	case "tonight":
+		return p.evening(today), 1, true
+	case "tomorrow":
+		if isEvening(p.tok(i + 1)) {
+			return p.evening(today.AddDate(0, 0, 1)), 2, true
+		}
+		return day(today.AddDate(0, 0, 1)), 1, true
+	case "weekend":
+		return p.weekend(0), 1, true
+	case "this", "the", "coming", "next":
+		offset := 0
+		if w == "next" {
+			offset = 1
+		}
+		return p.relative(i+1, offset, w)
+	case "on":
+		if wd, ok := weekdays[p.tok(i+1)]; ok {
+			r, n := p.weekday(i+1, wd, 0)
+			return r, n + 1, true
+		}
+		r, n, ok := p.date(i + 1)
+		return r, n + 1, ok
+	case "in", "during":
+		if m, ok := months[p.tok(i+1)]; ok {
+			if year, ok := parseYear(p.tok(i + 2)); ok {
+				return monthRange(year, m, p.now.Location()), 3, true
+			}
+			return p.month(m), 2, true
+		}
+		return Range{}, 0, false
+	}
+
+	if wd, ok := weekdays[p.tok(i)]; ok {
+		r, n := p.weekday(i, wd, 0)
+		return r, n, true
+	}
+	if m, ok := months[p.tok(i)]; ok {
+		if year, ok := parseYear(p.tok(i + 1)); ok {
+			return monthRange(year, m, p.now.Location()), 2, true
+		}
+	}
+	return p.date(i)
+}
+
+// relative parses what follows "this", "the", "coming" or "next"
+func (p *parser) relative(i, offset int, word string) (Range, int, bool) {
+	today := midnight(p.now)
+
+	switch p.tok(i) {
+	case "weekend":
+		return p.weekend(offset), 2, true
+	case "week":
+		monday := today.AddDate(0, 0, -daysSinceMonday(today))
+		if offset == 0 {
+			return Range{Start: p.now, End: monday.AddDate(0, 0, 7)}, 2, true
+		}
+		return Range{Start: monday.AddDate(0, 0, 7), End: monday.AddDate(0, 0, 14)}, 2, true
+	case "month":
+		first := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
+		if offset == 0 {
+			return Range{Start: p.now, End: first.AddDate(0, 1, 0)}, 2, true
+		}
+		return Range{Start: first.AddDate(0, 1, 0), End: first.AddDate(0, 2, 0)}, 2, true
+	}
+
+	if wd, ok := weekdays[p.tok(i)]; ok {
+		r, n := p.weekday(i, wd, offset)
+		return r, n + 1, true
+	}
+
+	// "next 10 days", "the next 2 weeks"
+	if word == "next" || word == "the" {
+		j := i
+		if word == "the" && p.tok(j) == "next" {
+			j++
+		}
+		if n, err := strconv.Atoi(p.tok(j)); err == nil && n > 0 && n <= 365 {
+			switch p.tok(j + 1) {
+			case "days", "day":
+				return Range{Start: p.now, End: today.AddDate(0, 0, n+1)}, j + 2 - i + 1, true
+			case "weeks", "week":
+				return Range{Start: p.now, End: today.AddDate(0, 0, 7*n+1)}, j + 2 - i + 1, true
+			}
+		}
+	}
+	return Range{}, 0, false
+}
+
+// weekday resolves a weekday name at i, optionally followed by "night".
+// Without offset it is the next such day, today included; with offset it is
+// the next one after today.
+func (p *parser) weekday(i int, wd time.Weekday, offset int) (Range, int) {
+	today := midnight(p.now)
+	ahead := (int(wd) - int(today.Weekday()) + 7) % 7
+	if ahead == 0 && offset > 0 {
+		ahead = 7
+	}
+	d := today.AddDate(0, 0, ahead)
+	if isEvening(p.tok(i + 1)) {
+		return p.evening(d), 2
+	}
+	return day(d), 1
+}
+
+// weekend returns Friday evening to Monday of this weekend (or the one in
+// progress), or of a later one
+func (p *parser) weekend(offset int) Range {
+	today := midnight(p.now)
+	monday := today.AddDate(0, 0, -daysSinceMonday(today))
+	friday := monday.AddDate(0, 0, 4)
+	r := Range{
+		Start: friday.Add(EveningStart * time.Hour),
+		End:   monday.AddDate(0, 0, 7),
+	}
+	r.Start, r.End = r.Start.AddDate(0, 0, 7*offset), r.End.AddDate(0, 0, 7*offset)
+	return r
+}
+
+// month returns the next occurrence of month: the rest of it if it is the
+// current month, otherwise all of it this year or next
+func (p *parser) month(m time.Month) Range {
+	year := p.now.Year()
+	if m < p.now.Month() {
+		year++
+	}
+	return monthRange(year, m, p.now.Location())
+}
+
+// date parses "June 5", "June 5th 2030", "5 June", "5th of June" and
+// "2030-06-05". Dates without a year are the next such day.
+func (p *parser) date(i int) (Range, int, bool) {
+	loc := p.now.Location()
+
+	if t, err := time.ParseInLocation("2006-01-02", p.tok(i), loc); err == nil {
+		return day(t), 1, true
+	}
+
+	var (
+		m   time.Month
+		d   int
+		n   int
+		ok  bool
+		dOK bool
+	)
+	if m, ok = months[p.tok(i)]; ok {
+		d, dOK = parseDay(p.tok(i + 1))
+		n = 2
+	} else if d, dOK = parseDay(p.tok(i)); dOK {
+		j := i + 1
+		if p.tok(j) == "of" {
+			j++
+		}
+		m, ok = months[p.tok(j)]
+		n = j + 1 - i
+	}
+	if !ok || !dOK {
+		return Range{}, 0, false
+	}
+
+	year, hasYear := parseYear(p.tok(i + n))
+	if hasYear {
+		n++
+	} else {
+		year = p.now.Year()
+	}
+	t := time.Date(year, m, d, 0, 0, 0, 0, loc)
+	if t.Day() != d {
+		// No such day in the month, e.g. June 31
+		return Range{}, 0, false
+	}
+	if !hasYear && t.AddDate(0, 0, 1).Before(p.now) {
+		t = t.AddDate(1, 0, 0)
+	}
+	return day(t), n, true
+}
+
+func (p *parser) evening(d time.Time) Range {
+	return Range{Start: d.Add(EveningStart * time.Hour), End: d.AddDate(0, 0, 1)}
+}
+
+func day(d time.Time) Range {
+	return Range{Start: d, End: d.AddDate(0, 0, 1)}
+}
+
+func monthRange(year int, m time.Month, loc *time.Location) Range {
+	first := time.Date(year, m, 1, 0, 0, 0, 0, loc)
+	return Range{Start: first, End: first.AddDate(0, 1, 0)}
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func daysSinceMonday(t time.Time) int {
+	return (int(t.Weekday()) + 6) % 7
+}
+
+func isEvening(w string) bool {
+	return w == "night" || w == "evening"
+}
+
+// parseDay parses a day of the month, with or without an ordinal suffix
+func parseDay(w string) (int, bool) {
+	for _, suffix := range []string{"st", "nd", "rd", "th"} {
+		w = strings.TrimSuffix(w, suffix)
+	}
+	d, err := strconv.Atoi(w)
+	return d, err == nil && d >= 1 && d <= 31
+}
+
+func parseYear(w string) (int, bool) {
+	if len(w) != 4 {
+		return 0, false
+	}
+	y, err := strconv.Atoi(w)
+	return y, err == nil && y >= 2000 && y <= 2100
+}
+
+// tokenize lowercases text and splits it into words, keeping hyphens inside
+// words so ISO dates stay whole
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+	// "sun", "mon", "wed" and "sat" are left out: they are common words too
+	"tue": time.Tuesday, "tues": time.Tuesday, "thu": time.Thursday, "thur": time.Thursday,
+	"thurs": time.Thursday, "fri": time.Friday,
+}
+
+// months are only recognised next to a day or year, or after "in" or
+// "during": on their own, "may" and "march" are ordinary words
+var months = map[string]time.Month{
+	"january": time.January, "february": time.February, "march": time.March, "april": time.April,
+	"may": time.May, "june": time.June, "july": time.July, "august": time.August,
+	"september": time.September, "october": time.October, "november": time.November, "december": time.December,
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April, "jun": time.June,
+	"jul": time.July, "aug": time.August, "sep": time.September, "sept": time.September, "oct": time.October,
+	"nov": time.November, "dec": time.December,
+}
@@ -0,0 +1,130 @@
+package dates
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A Wednesday morning
+	now := time.Date(2026, time.October, 14, 10, 0, 0, 0, chicago)
+
+	const layout = "2006-01-02 15:04"
+	tests := []struct {
+		text       string
+		start, end string
+		expr       string
+		ok         bool
+	}{
+		{"concerts today", "2026-10-14 10:00", "2026-10-15 00:00", "today", true},
+		{"jazz tonight", "2026-10-14 17:00", "2026-10-15 00:00", "tonight", true},
+		{"tomorrow", "2026-10-15 00:00", "2026-10-16 00:00", "tomorrow", true},
+		{"tomorrow night", "2026-10-15 17:00", "2026-10-16 00:00", "tomorrow night", true},
+		{"this weekend", "2026-10-16 17:00", "2026-10-19 00:00", "this weekend", true},
+		{"next weekend", "2026-10-23 17:00", "2026-10-26 00:00", "next weekend", true},
+		{"this week", "2026-10-14 10:00", "2026-10-19 00:00", "this week", true},
+		{"next week", "2026-10-19 00:00", "2026-10-26 00:00", "next week", true},
+		{"this month", "2026-10-14 10:00", "2026-11-01 00:00", "this month", true},
+		{"next month", "2026-11-01 00:00", "2026-12-01 00:00", "next month", true},
+		{"on Friday", "2026-10-16 00:00", "2026-10-17 00:00", "on friday", true},
+		{"friday night", "2026-10-16 17:00", "2026-10-17 00:00", "friday night", true},
+		// A weekday is the next one, today included, unless it says next
+		{"wednesday", "2026-10-14 10:00", "2026-10-15 00:00", "wednesday", true},
+		{"next wednesday", "2026-10-21 00:00", "2026-10-22 00:00", "next wednesday", true},
+		{"the next 3 days", "2026-10-14 10:00", "2026-10-18 00:00", "the next 3 days", true},
+		{"next 2 weeks", "2026-10-14 10:00", "2026-10-29 00:00", "next 2 weeks", true},
+		{"June 5th", "2027-06-05 00:00", "2027-06-06 00:00", "june 5th", true},
+		{"5th of December", "2026-12-05 00:00", "2026-12-06 00:00", "5th of december", true},
+		{"2026-11-03", "2026-11-03 00:00", "2026-11-04 00:00", "2026-11-03", true},
+		{"october 14", "2026-10-14 10:00", "2026-10-15 00:00", "october 14", true},
+		{"in March", "2027-03-01 00:00", "2027-04-01 00:00", "in march", true},
+		{"during december 2027", "2027-12-01 00:00", "2028-01-01 00:00", "during december 2027", true},
+		{"between June 3 and June 5", "2027-06-03 00:00", "2027-06-06 00:00", "between june 3 and june 5", true},
+		{"from friday to monday", "2026-10-16 00:00", "2026-10-20 00:00", "from friday to monday", true},
+
+		// Past dates and words that only look like dates
+		{"2020-01-01", "", "", "", false},
+		{"may I see some jazz", "", "", "", false},
+		{"june 31", "", "", "", false},
+		{"the 2 of us", "", "", "", false},
+		{"concerts in Chicago", "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			r, ok := Parse(tt.text, now, chicago)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v (range %+v)", ok, tt.ok, r)
+			}
+			if !ok {
+				return
+			}
+			if got := r.Start.In(chicago).Format(layout); got != tt.start {
+				t.Errorf("start = %s, want %s", got, tt.start)
+			}
+			if got := r.End.In(chicago).Format(layout); got != tt.end {
+				t.Errorf("end = %s, want %s", got, tt.end)
+			}
+			if r.Expr != tt.expr {
+				t.Errorf("expr = %q, want %q", r.Expr, tt.expr)
+			}
+			if r.Start.Location() != time.UTC {
+				t.Errorf("start is in %v, want UTC", r.Start.Location())
+			}
+		})
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	// Late Friday evening in UTC is already Saturday in Tokyo
+	now := time.Date(2026, time.October, 16, 20, 0, 0, 0, time.UTC)
+	tokyo, err := LoadTimezone("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		loc   *time.Location
+		start time.Time
+	}{
+		{nil, time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC)},
+		{tokyo, time.Date(2026, time.October, 17, 15, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		r, ok := Parse("tomorrow", now, tt.loc)
+		if !ok || !r.Start.Equal(tt.start) {
+			t.Errorf("Parse(tomorrow) in %v = %v, %v; want start %v", tt.loc, r.Start, ok, tt.start)
+		}
+	}
+}
+
+func TestLoadTimezone(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"America/Chicago", false},
+		{"UTC", false},
+		{"", true},
+		{"Local", true},
+		{"Mars/Olympus", true},
+	}
+	for _, tt := range tests {
+		if _, err := LoadTimezone(tt.name); (err != nil) != tt.wantErr {
+			t.Errorf("LoadTimezone(%q) err = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNow(t *testing.T) {
+	t.Setenv("FIXED_NOW", "2026-10-16T18:00:00Z")
+	if got, want := Now(), time.Date(2026, time.October, 16, 18, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Now() = %v with FIXED_NOW set, want %v", got, want)
+	}
+	t.Setenv("FIXED_NOW", "yesterday")
+	if got := Now(); time.Since(got) > time.Minute {
+		t.Errorf("Now() = %v with an invalid FIXED_NOW, want the current time", got)
+	}
+}
@@ -0,0 +1,123 @@
+// Package dedup collapses identical upstream calls made while serving a batch
+// of prompts. A Group attached to a context makes concurrent callers with the
+// same key share one in-flight call, and later callers reuse its result.
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+
+	"go-backend/metrics"
+)
+
+// Group remembers the upstream calls made through it. Successful results are
+// kept for the group's lifetime, so a group should be scoped to one batch.
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+	stats Stats
+}
+
+// Stats counts the calls made through a group
+type Stats struct {
+	// Calls is how many calls actually went upstream
+	Calls int `json:"calls"`
+	// Shared is how many calls were answered from another caller's result
+	Shared int `json:"shared"`
+}
+
+// ErrPanicked is returned to the callers sharing a call that panicked; the
+// caller that made it gets the panic
+var ErrPanicked = errors.New("shared upstream call panicked")
+
+type call struct {
+	done chan struct{}
+	val  []byte
+	err  error
+}
+
+type groupKey struct{}
+
+// NewContext returns a context carrying a fresh group
+func NewContext(ctx context.Context) (context.Context, *Group) {
+	g := &Group{calls: make(map[string]*call)}
+	return context.WithValue(ctx, groupKey{}, g), g
+}
+
+// FromContext returns the group attached to ctx, or nil if there is none
+func FromContext(ctx context.Context) *Group {
+	g, _ := ctx.Value(groupKey{}).(*Group)
+	return g
+}
+
+// Key hashes the parts identifying an upstream call into a group key, so keys
+// never hold credentials or request bodies in clear text
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Do calls fn once per key within the group attached to ctx and returns its
+// result. shared reports whether the result came from another caller. Failed
+// calls are not kept, so the next caller with the key tries again. If fn
+// panics, the panic carries on in this caller and the callers waiting on it
+// get ErrPanicked. Without a group fn is simply called.
+func Do(ctx context.Context, key string, fn func() ([]byte, error)) (val []byte, shared bool, err error) {
+	g := FromContext(ctx)
+	if g == nil {
+		val, err = fn()
+		return val, false, err
+	}
+
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.stats.Shared++
+		g.mu.Unlock()
+		metrics.ObserveCache(metrics.CacheDedup, true)
+
+		select {
+		case <-c.done:
+			return c.val, true, c.err
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+	}
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.stats.Calls++
+	g.mu.Unlock()
+	metrics.ObserveCache(metrics.CacheDedup, false)
+
+	// Waiters are released and the key forgotten even if fn panics or
+	// exits the goroutine
+	returned := false
+	defer func() {
+		if !returned {
+			c.val, c.err = nil, ErrPanicked
+		}
+		if c.err != nil {
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+		}
+		close(c.done)
+	}()
+
+	c.val, c.err = fn()
+	returned = true
+	return c.val, false, c.err
+}
+
+// Stats returns the group's call counts so far
+func (g *Group) Stats() Stats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stats
+}
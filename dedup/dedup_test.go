@@ -0,0 +1,144 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	errUpstream := errors.New("upstream failed")
+	tests := []struct {
+		name string
+		// results are what fn returns on each call that reaches it
+		results    []error
+		calls      int
+		wantCalls  int
+		wantShared int
+	}{
+		{name: "success is kept", results: []error{nil}, calls: 3, wantCalls: 1, wantShared: 2},
+		{name: "failure is retried", results: []error{errUpstream, nil}, calls: 3, wantCalls: 2, wantShared: 1},
+		{name: "failures are all retried", results: []error{errUpstream, errUpstream, errUpstream}, calls: 3, wantCalls: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, g := NewContext(context.Background())
+			n := 0
+			fn := func() ([]byte, error) {
+				err := tt.results[n]
+				n++
+				if err != nil {
+					return nil, err
+				}
+				return []byte("ok"), nil
+			}
+			for i := 0; i < tt.calls; i++ {
+				val, _, err := Do(ctx, "k", fn)
+				if err == nil && string(val) != "ok" {
+					t.Errorf("call %d = %q, want ok", i, val)
+				}
+			}
+			if got := g.Stats(); got != (Stats{Calls: tt.wantCalls, Shared: tt.wantShared}) {
+				t.Errorf("stats = %+v, want %d calls and %d shared", got, tt.wantCalls, tt.wantShared)
+			}
+		})
+	}
+}
+
+func TestDoWithoutGroup(t *testing.T) {
+	n := 0
+	for i := 0; i < 2; i++ {
+		Do(context.Background(), "k", func() ([]byte, error) {
+			n++
+			return nil, nil
+		})
+	}
+	if n != 2 {
+		t.Errorf("fn called %d times without a group, want 2", n)
+	}
+}
+
+func TestDoShared(t *testing.T) {
+	ctx, g := NewContext(context.Background())
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	var wg sync.WaitGroup
+	results := make([]bool, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i > 0 {
+				<-started
+			}
+			_, shared, err := Do(ctx, "k", func() ([]byte, error) {
+				close(started)
+				<-release
+				return []byte("ok"), nil
+			})
+			if err != nil {
+				t.Errorf("caller %d: %v", i, err)
+			}
+			results[i] = shared
+		}(i)
+	}
+	<-started
+	// Let the waiters reach the in-flight call before it finishes
+	for g.Stats().Shared < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if results[0] || !results[1] || !results[2] {
+		t.Errorf("shared = %v, want only the later callers sharing", results)
+	}
+}
+
+func TestDoPanic(t *testing.T) {
+	ctx, g := NewContext(context.Background())
+	started := make(chan struct{})
+
+	waiter := make(chan error, 1)
+	go func() {
+		<-started
+		_, _, err := Do(ctx, "k", func() ([]byte, error) {
+			t.Error("waiter ran fn while the call was in flight")
+			return nil, nil
+		})
+		waiter <- err
+	}()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic did not reach the caller that made the call")
+			}
+		}()
+		Do(ctx, "k", func() ([]byte, error) {
+			close(started)
+			for g.Stats().Shared < 1 {
+				time.Sleep(time.Millisecond)
+			}
+			panic("boom")
+		})
+	}()
+
+	select {
+	case err := <-waiter:
+		if !errors.Is(err, ErrPanicked) {
+			t.Errorf("waiter err = %v, want ErrPanicked", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter still blocked after the call panicked")
+	}
+
+	// The key is forgotten, so the next caller makes the call again
+	val, shared, err := Do(ctx, "k", func() ([]byte, error) { return []byte("ok"), nil })
+	if err != nil || shared || string(val) != "ok" {
+		t.Errorf("after the panic Do = %q, %v, %v; want a fresh call", val, shared, err)
+	}
+}
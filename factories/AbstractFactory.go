@@ -1,9 +1,25 @@
 package factories
 
+import "context"
+
 type AbstractFactory interface {
 	CreateProduct() AbstractProduct
 }
 
 type AbstractProduct interface {
-	PerformAction(data map[string]string) (map[string]interface{}, error)
+	PerformAction(ctx context.Context, data map[string]string) (map[string]interface{}, error)
+}
+
+// ActivityEnricher is implemented by products that can fill in the fields of
+// formatted activities from the raw data they returned, where the formatter
+// may have left them out or got them wrong
+type ActivityEnricher interface {
+	EnrichActivities(raw map[string]interface{}, activities []interface{})
+}
+
+// ActionValidator is implemented by products that check an action given to
+// them directly, rather than extracted from a prompt, before it is run. It
+// returns the data to run with, keeping only what the product allows.
+type ActionValidator interface {
+	ValidateAction(data map[string]string) (map[string]string, error)
 }
@@ -1,13 +1,17 @@
 package factories
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
-	"strings"
+
+	"go-backend/guard"
+	"go-backend/metrics"
+	"go-backend/prompts"
+	"go-backend/replay"
+	"go-backend/tracing"
 
 	"github.com/joho/godotenv"
 )
@@ -19,111 +23,82 @@ type AnalysisResult struct {
 
 type OpenAIService struct {
 	APIKey string
+	Logger *slog.Logger
 }
 
-func NewOpenAIService() *OpenAIService {
+func NewOpenAIService(logger *slog.Logger) *OpenAIService {
 	// Load .env file
 	err := godotenv.Load() // This will load the .env file in the same directory as the main.go file
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		logger.Warn("Error loading .env file, using the process environment", "error", err)
 	}
 
+	// Replayed fixtures need no credentials
 	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		log.Fatal("OPENAI_API_KEY environment variable is not set.")
+	if apiKey == "" && replay.ModeFromEnv() != replay.ModeReplay {
+		logger.Error("OPENAI_API_KEY environment variable is not set")
+		os.Exit(1)
 	}
 	return &OpenAIService{
 		APIKey: apiKey,
+		Logger: logger,
 	}
 }
 
-func (o *OpenAIService) AnalyzePrompt(prompt string) ([]AnalysisResult, error) {
-	jsonData := map[string]interface{}{
-		"model": "gpt-3.5-turbo",
-		"messages": []map[string]string{
-			{
-				"role": "user",
-				"content": fmt.Sprintf(`Given the prompt, "%s" generate a JSON array ranking how applicable each service is for this prompt. Use the format:
-				[
-  {
-	"service": "Ticketing",
-	"applicability": "XX"
-  },
-  {
-	"service": "Accommodations",
-	"applicability": "XX"
-  },
-  {
-	"service": "Restaurants",
-	"applicability": "XX"
-  }
-]
-
-- "Applicability" reflects the relevance of each service for fulfilling the user's goal.
-- Rank each service from 0%% (irrelevant) to 100%% (highly relevant).
-- In the JSON object, don't include the percent symbol in the applicability value.
-- For context: The "Ticketing" service provides tickets to events, "Accommodations" helps with travel accommodations, and "Restaurants" suggests nearby dining options.
-Return only the JSON object as a string`, prompt),
-			},
-		},
-		"max_tokens":  100,
-		"temperature": 0.5,
-	}
+func (o *OpenAIService) AnalyzePrompt(ctx context.Context, prompt string) (results []AnalysisResult, err error) {
+	ctx, span := tracing.Start(ctx, "OpenAIService.AnalyzePrompt")
+	defer func() { tracing.End(span, err) }()
 
-	jsonValue, err := json.Marshal(jsonData)
+	rendered, err := prompts.Render(prompts.Classifier, map[string]interface{}{"Prompt": prompt})
 	if err != nil {
-		return nil, fmt.Errorf("error marshaling json data: %w", err)
+		return nil, err
 	}
 
-	request, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", strings.NewReader(string(jsonValue)))
-	if err != nil {
-		return nil, fmt.Errorf("error creating new request: %w", err)
+	jsonData := map[string]interface{}{
+		"model":       "gpt-3.5-turbo",
+		"max_tokens":  100,
+		"temperature": 0.5,
 	}
 
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Authorization", "Bearer "+o.APIKey)
-
-	client := &http.Client{}
-	response, err := client.Do(request)
+	content, err := chatCompletion(ctx, o.APIKey, metrics.StageClassification, rendered, jsonData)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %w", err)
+		return nil, err
 	}
-	defer response.Body.Close()
 
-	data, err := ioutil.ReadAll(response.Body)
+	results, err = o.FilterOpenAIResponse(content)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
+		return nil, err
 	}
 
-	var respData map[string]interface{}
-	if err := json.Unmarshal(data, &respData); err != nil {
-		return nil, fmt.Errorf("error unmarshaling response data: %w", err)
-	}
-
-	return o.FilterOpenAIResponse(respData)
+	return o.validateResults(ctx, results)
 }
 
-func (o *OpenAIService) FilterOpenAIResponse(data map[string]interface{}) ([]AnalysisResult, error) {
-	choices, ok := data["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		return nil, fmt.Errorf("error: 'choices' is not a slice or is empty")
+// validateResults drops rankings for unknown services or with out-of-range
+// scores, so a steered model cannot route the request somewhere unexpected
+func (o *OpenAIService) validateResults(ctx context.Context, results []AnalysisResult) ([]AnalysisResult, error) {
+	rankings := make([]guard.Ranking, len(results))
+	for i, r := range results {
+		rankings[i] = guard.Ranking{Service: r.Service, Applicability: r.Applicability}
 	}
 
-	choice, ok := choices[0].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("error: first item in 'choices' is not a map")
+	valid, problems := guard.ValidateRankings(rankings)
+	if len(problems) > 0 {
+		metrics.ObserveRejectedOutput(metrics.StageClassification)
+		o.Logger.WarnContext(ctx, "Dropped invalid classifier output", "problems", problems)
 	}
-
-	messageMap, ok := choice["message"].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("error: 'message' is not a map")
+	if len(valid) == 0 {
+		return nil, fmt.Errorf("classifier returned no valid service rankings")
 	}
 
-	content, ok := messageMap["content"].(string)
-	if !ok {
-		return nil, fmt.Errorf("error: 'content' is not a string")
+	validated := make([]AnalysisResult, len(valid))
+	for i, r := range valid {
+		validated[i] = AnalysisResult{Service: r.Service, Applicability: r.Applicability}
 	}
+	return validated, nil
+}
 
+// FilterOpenAIResponse parses the classifier's reply into analysis results
+func (o *OpenAIService) FilterOpenAIResponse(content string) ([]AnalysisResult, error) {
 	// Directly unmarshal JSON string
 	var services []AnalysisResult
 	err := json.Unmarshal([]byte(content), &services)
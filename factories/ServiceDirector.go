@@ -1,128 +1,640 @@
 package factories
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/breaker"
+	"go-backend/budget"
+	"go-backend/dates"
+	"go-backend/geo"
+	"go-backend/guard"
+	"go-backend/jobs"
+	"go-backend/locale"
+	"go-backend/logging"
+	"go-backend/metrics"
+	"go-backend/ranking"
+	"go-backend/ratelimit"
+	"go-backend/storage"
+	"go-backend/usage"
 )
 
+// ApplicabilityThreshold is the classifier score a service needs before its
+// factory is invoked
+const ApplicabilityThreshold = 90
+
 type ServiceDirector struct {
 	Factories     map[string]AbstractFactory
 	OpenAIService *OpenAIService
+	Logger        *slog.Logger
+	Guard         guard.Config
+	// Jobs runs async prompts; async requests are refused while it is nil
+	Jobs *jobs.Manager
+	// History stores every run for later querying; nothing is kept while it is nil
+	History storage.Repository
+	// Locations resolves where each prompt is about; prompts get no location while it is nil
+	Locations *geo.Resolver
+	// Ranking orders each service's activities; they are left in the
+	// formatter's order while it is nil
+	Ranking *ranking.Ranker
+}
+
+// PromptJobKind tags async prompts in the job manager
+const PromptJobKind = "prompt"
+
+// PromptRequest is the body accepted by /promptOpenAI
+type PromptRequest struct {
+	Prompt string `json:"prompt"`
+	// Async queues the prompt as a job and answers 202 with its id at once
+	Async bool `json:"async,omitempty"`
+	// CallbackURL, for async prompts, receives the []ServiceResponse when the
+	// job finishes
+	CallbackURL string `json:"callback_url,omitempty"`
+	// Location is where the client is, for prompts like "concerts near me".
+	// It takes precedence over the X-Geo-Position header.
+	Location *geo.Coordinates `json:"location,omitempty"`
+	// Timezone is the user's IANA timezone, used to resolve dates such as
+	// "tonight". It takes precedence over the X-Timezone header.
+	Timezone string `json:"timezone,omitempty"`
+	// Sort orders each service's activities: relevance (the default), date,
+	// distance or name
+	Sort string `json:"sort,omitempty"`
+	// Preferences are terms the user wants more or less of
+	Preferences *ranking.Preferences `json:"preferences,omitempty"`
+	// MaxPrice drops activities whose cheapest ticket costs more, in the
+	// activity's own currency
+	MaxPrice *float64 `json:"max_price,omitempty"`
+	// OnSaleNow keeps only activities with tickets on sale right now
+	OnSaleNow bool `json:"on_sale_now,omitempty"`
+	// Budget is the most the user wants to spend in total, as an amount in
+	// budget.DefaultCurrency or an object with an amount and currency. It
+	// takes precedence over a budget named in the prompt.
+	Budget *budget.Budget `json:"budget,omitempty"`
+	// Locale is the language, and optionally region, to answer in, e.g.
+	// "fr-CA". It takes precedence over the prompt's language and the
+	// Accept-Language header.
+	Locale string `json:"locale,omitempty"`
+}
+
+// InvalidOptionError reports a PromptRequest option that is out of range or
+// malformed
+type InvalidOptionError struct {
+	Option string
+}
+
+func (e *InvalidOptionError) Error() string {
+	return "invalid " + e.Option
+}
+
+// WithOptions validates the request's options and attaches them to ctx for
+// Run: the location, timezone, ranking and filters, budget and locale. An
+// invalid option is reported as an *InvalidOptionError.
+func (req PromptRequest) WithOptions(ctx context.Context) (context.Context, error) {
+	if loc := req.Location; loc != nil {
+		if err := loc.Validate(); err != nil {
+			return ctx, &InvalidOptionError{Option: "location"}
+		}
+		hint := geo.HintFromContext(ctx)
+		hint.Coordinates = loc
+		ctx = geo.WithHint(ctx, hint)
+	}
+	if req.Timezone != "" {
+		tz, err := dates.LoadTimezone(req.Timezone)
+		if err != nil {
+			return ctx, &InvalidOptionError{Option: "timezone"}
+		}
+		ctx = dates.WithTimezone(ctx, tz)
+	}
+	if !ranking.ValidSort(req.Sort) {
+		return ctx, &InvalidOptionError{Option: "sort"}
+	}
+	if req.MaxPrice != nil && *req.MaxPrice < 0 {
+		return ctx, &InvalidOptionError{Option: "max_price"}
+	}
+	if req.Sort != "" || req.Preferences != nil || req.MaxPrice != nil || req.OnSaleNow {
+		opts := ranking.Options{Sort: req.Sort, MaxPrice: req.MaxPrice, OnSaleNow: req.OnSaleNow}
+		if req.Preferences != nil {
+			opts.Preferences = *req.Preferences
+		}
+		ctx = ranking.WithOptions(ctx, opts)
+	}
+	if b := req.Budget; b != nil {
+		if err := b.Validate(); err != nil {
+			return ctx, &InvalidOptionError{Option: "budget"}
+		}
+		ctx = budget.NewContext(ctx, b)
+	}
+	if req.Locale != "" {
+		l, err := locale.Parse(req.Locale)
+		if err != nil {
+			return ctx, &InvalidOptionError{Option: "locale"}
+		}
+		ctx = locale.WithRequested(ctx, l)
+	}
+	return ctx, nil
 }
 
 type Product interface {
-	PerformAction(data map[string]string) (map[string]interface{}, error)
+	PerformAction(ctx context.Context, data map[string]string) (map[string]interface{}, error)
 }
 
-func NewServiceDirector() *ServiceDirector {
+func NewServiceDirector(logger *slog.Logger) *ServiceDirector {
 	sd := &ServiceDirector{
 		Factories:     make(map[string]AbstractFactory),
-		OpenAIService: NewOpenAIService(),
+		OpenAIService: NewOpenAIService(logger),
+		Logger:        logger,
+		Ranking:       &ranking.Ranker{Weights: ranking.DefaultWeights},
 	}
-	sd.Factories["Ticketing"] = &TicketmasterFactory{}
+	// Read after NewOpenAIService has loaded .env
+	sd.Guard = guard.ConfigFromEnv()
+	sd.Factories["Ticketing"] = &TicketmasterFactory{Logger: logger}
 	return sd
 }
 
 type ServiceResponse struct {
-	Service string      `json:"service"`
-	Data    interface{} `json:"data"`
-	Error   string      `json:"error"`
+	Service string         `json:"service"`
+	Data    interface{}    `json:"data"`
+	Error   string         `json:"error"`
+	Usage   *usage.Summary `json:"usage,omitempty"`
+	Prompts []string       `json:"prompts,omitempty"`
 }
 
 func (sd *ServiceDirector) ProcessPrompt(w http.ResponseWriter, r *http.Request) {
-	var requestBody map[string]string
+	var requestBody PromptRequest
 	err := json.NewDecoder(r.Body).Decode(&requestBody)
 	if err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	prompt, exists := requestBody["prompt"]
-	if !exists {
+	prompt := requestBody.Prompt
+	if prompt == "" {
 		http.Error(w, "Prompt is required", http.StatusBadRequest)
 		return
 	}
 
-	analysisResults, err := sd.OpenAIService.AnalyzePrompt(prompt)
+	if requestBody.CallbackURL != "" && !requestBody.Async {
+		http.Error(w, "callback_url requires async", http.StatusBadRequest)
+		return
+	}
+	ctx, err := requestBody.WithOptions(r.Context())
+	var invalid *InvalidOptionError
+	if errors.As(err, &invalid) {
+		http.Error(w, "Invalid "+invalid.Option, http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(ctx)
+	if requestBody.Async {
+		sd.submitPrompt(w, r, requestBody)
+		return
+	}
+
+	// Every LLM call made for this request is recorded in the ledger
+	ctx, ledger := usage.NewContext(ctx)
+
+	serviceResponses, err := sd.Run(ctx, prompt)
 	if err != nil {
-		log.Println("Error processing prompt:", err)
-		http.Error(w, "Failed to analyze the prompt", http.StatusInternalServerError)
+		writeRunError(ctx, w, err)
 		return
 	}
 
-	//Testing the response for the result types
-	for _, result := range analysisResults {
-		log.Printf("Service: %s, Applicability: %s%%\n", result.Service, result.Applicability)
+	respData, _ := json.Marshal(serviceResponses)
+	setUsageHeaders(w, ledger)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(respData)
+}
+
+// submitPrompt queues an async prompt and answers 202 with the job id. The
+// prompt is screened first so rejected prompts fail fast rather than as jobs.
+func (sd *ServiceDirector) submitPrompt(w http.ResponseWriter, r *http.Request, req PromptRequest) {
+	if sd.Jobs == nil {
+		http.Error(w, "Async prompts are not enabled on this server", http.StatusNotImplemented)
+		return
 	}
+	if req.CallbackURL != "" {
+		if err := sd.Jobs.Callbacks().ValidateURL(req.CallbackURL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if _, err := sd.Guard.Check(req.Prompt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The whole request is kept as the job's input, with what the headers
+	// said folded in, so a job resumed after a restart runs the same way
+	ctx := r.Context()
+	if req.Location == nil {
+		req.Location = geo.HintFromContext(ctx).Coordinates
+	}
+	if tz := dates.TimezoneFromContext(ctx).String(); req.Timezone == "" && tz != "Local" {
+		req.Timezone = tz
+	}
+	job, err := sd.Jobs.Submit(ctx, PromptJobKind, req, 0, req.CallbackURL)
+	if errors.Is(err, jobs.ErrQueueFull) || errors.Is(err, jobs.ErrShuttingDown) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Job queue is full, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		sd.Logger.ErrorContext(r.Context(), "Error submitting prompt job", "error", err)
+		http.Error(w, "Failed to submit the prompt", http.StatusInternalServerError)
+		return
+	}
+	jobs.WriteAccepted(w, job)
+}
+
+// RunJob is the jobs.Handler for async prompts. The job's result is the
+// []ServiceResponse /promptOpenAI would have returned.
+func (sd *ServiceDirector) RunJob(ctx context.Context, job jobs.Job, progress func(int)) (interface{}, error) {
+	var req PromptRequest
+	if err := json.Unmarshal(job.Input, &req); err != nil {
+		// Jobs queued by earlier versions kept only the prompt
+		if err := json.Unmarshal(job.Input, &req.Prompt); err != nil {
+			return nil, fmt.Errorf("error decoding prompt: %v", err)
+		}
+	}
+	// A resumed job has none of the submitting request's context
+	ctx, err := req.WithOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := sd.Run(ctx, req.Prompt)
+	if err != nil {
+		_, msg := RunErrorStatus(err)
+		return nil, errors.New(msg)
+	}
+	return responses, nil
+}
 
+// writeRunError maps an error from Run to an HTTP response
+func writeRunError(ctx context.Context, w http.ResponseWriter, err error) {
+	status, msg := RunErrorStatus(err)
+	if status == http.StatusTooManyRequests {
+		ratelimit.TooManyRequests(w, ratelimit.RetryAfter(ctx), msg)
+		return
+	}
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "30")
+	}
+	http.Error(w, msg, status)
+}
+
+// RunErrorStatus maps an error from Run or Query to the HTTP status and message the
+// client is given. Internal errors are not passed through.
+func RunErrorStatus(err error) (int, string) {
+	switch {
+	case guard.IsRejection(err):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, ratelimit.ErrQuotaExceeded):
+		return http.StatusTooManyRequests, "Daily quota exceeded"
+	case errors.Is(err, ErrUnknownService):
+		return http.StatusNotFound, err.Error()
+	case errors.Is(err, guard.ErrInvalidAction):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, breaker.ErrOpen):
+		return http.StatusServiceUnavailable, "Upstream service unavailable, try again later"
+	default:
+		return http.StatusInternalServerError, "Failed to analyze the prompt"
+	}
+}
+
+// ErrUnknownService is returned by Query for a service the director has no
+// factory for
+var ErrUnknownService = errors.New("unknown service")
+
+// Run sends a prompt through the pipeline: it screens the prompt, ranks the
+// services, and has every service over the applicability threshold fetch and
+// format its data. Failures of individual services are reported in their
+// responses; the error is only set when the prompt is rejected by the input
+// guard (see guard.IsRejection), the client is out of quota, or the prompt
+// could not be ranked. When the request or prompt sets a budget, the bundles
+// that fit it follow the services as a budget.ServiceName response. LLM usage
+// goes to the ledger in ctx, if any, and the run is saved to History when it
+// is set. Progress is reported to the ProgressFunc in ctx, if any.
+func (sd *ServiceDirector) Run(ctx context.Context, prompt string) ([]ServiceResponse, error) {
 	var serviceResponses []ServiceResponse
+	err := sd.Stream(ctx, prompt, func(response ServiceResponse) error {
+		serviceResponses = append(serviceResponses, response)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return serviceResponses, nil
+}
 
-	for _, result := range analysisResults {
-		service := result.Service
-		applicabilityInt, err := strconv.Atoi(result.Applicability)
+// Stream runs a prompt like Run, but hands each response to send as soon as
+// it is ready rather than collecting them. It stops at the first error from
+// send and returns it.
+func (sd *ServiceDirector) Stream(ctx context.Context, prompt string, send func(ServiceResponse) error) (err error) {
+	ledger := usage.FromContext(ctx)
+	if ledger == nil {
+		ctx, ledger = usage.NewContext(ctx)
+	}
+	ctx = logging.NewContext(ctx, sd.Logger)
 
-		if err != nil {
-			log.Printf("Error converting applicability to integer: %v", err)
+	ctx, rec := storage.NewContext(ctx)
+	client, _ := ratelimit.ClientFromContext(ctx)
+	rec.SetPrompt(prompt, client, logging.RequestID(ctx))
+	defer func() {
+		sd.saveHistory(ctx, rec, ledger, err)
+	}()
+
+	ctx, prompt, err = sd.prepare(ctx, prompt)
+	if err != nil {
+		return err
+	}
+	reportProgress(ctx, ProgressEvent{
+		Stage:    ProgressResolved,
+		Locale:   locale.FromContext(ctx),
+		Location: geo.FromContext(ctx),
+		Dates:    dates.FromContext(ctx),
+		Budget:   budget.FromContext(ctx),
+	})
+
+	classifyStart := time.Now()
+	analysisResults, err := sd.OpenAIService.AnalyzePrompt(ctx, prompt)
+	if err != nil {
+		if !errors.Is(err, ratelimit.ErrQuotaExceeded) {
+			sd.Logger.ErrorContext(ctx, "Error processing prompt", "error", err)
 		}
+		return err
+	}
+
+	rankings := make([]storage.Ranking, 0, len(analysisResults))
+	for _, result := range analysisResults {
+		sd.Logger.InfoContext(ctx, "Service ranked", "service", result.Service, "applicability", result.Applicability)
+		applicability, _ := strconv.Atoi(result.Applicability)
+		rankings = append(rankings, storage.Ranking{Service: result.Service, Applicability: applicability})
+	}
+	rec.SetRankings(rankings, time.Since(classifyStart))
+	reportProgress(ctx, ProgressEvent{Stage: ProgressRanked, Rankings: analysisResults})
+
+	var candidates []budget.Candidates
+	for _, result := range analysisResults {
+		serviceStart := time.Now()
+		response, applicability, routed := sd.runService(ctx, ledger, result, prompt)
 
-		if applicabilityInt < 90 {
-			log.Printf("Skipping service: %s (Applicability: %d%%)\n", service, applicabilityInt)
-			serviceResponses = append(serviceResponses, ServiceResponse{
-				Service: service,
-				Data:    nil,
-				Error:   fmt.Sprintf("Applicability below threshold (%d%%)", applicabilityInt),
-			})
-			continue
+		rec.Service(result.Service, func(s *storage.ServiceRecord) {
+			s.Applicability = applicability
+			s.Routed = routed
+			s.Error = response.Error
+			s.DurationMS = time.Since(serviceStart).Milliseconds()
+		})
+		if activities, ok := response.Data.([]interface{}); ok {
+			candidates = append(candidates, budget.Candidates{Service: response.Service, Activities: activities})
+		}
+		if err := send(response); err != nil {
+			return err
 		}
+	}
 
-		factory, exists := sd.Factories[service]
-		if !exists {
-			errMsg := fmt.Sprintf("Factory not found for service: %s", service)
-			log.Println(errMsg)
-			serviceResponses = append(serviceResponses, ServiceResponse{
-				Service: service,
-				Data:    nil,
-				Error:   errMsg,
-			})
-			continue
+	// With a budget, the services' activities are also offered as bundles
+	// that fit it, listed after the services themselves
+	if b := budget.FromContext(ctx); b != nil {
+		return send(ServiceResponse{Service: budget.ServiceName, Data: budget.Combine(*b, candidates)})
+	}
+	return nil
+}
+
+// Query has one service answer directly, without the classifier. data is
+// what the service's product is given: a "prompt" to analyze, or an
+// "action" and its parameters to run as is. A prompt is screened and
+// resolved as in Run. Failures of the service itself are reported in the
+// response; the error is set for an unknown service, an action the
+// service does not allow, a rejected prompt or a client out of quota.
+// Direct queries are not saved to History.
+func (sd *ServiceDirector) Query(ctx context.Context, service string, data map[string]string) (ServiceResponse, error) {
+	factory, exists := sd.Factories[service]
+	if !exists {
+		return ServiceResponse{}, fmt.Errorf("%w: %s", ErrUnknownService, service)
+	}
+	ledger := usage.FromContext(ctx)
+	if ledger == nil {
+		ctx, ledger = usage.NewContext(ctx)
+	}
+	ctx = logging.NewContext(ctx, sd.Logger)
+
+	prompt, hasPrompt := data["prompt"]
+	ctx, prompt, err := sd.prepare(ctx, prompt)
+	if err != nil {
+		return ServiceResponse{}, err
+	}
+	if hasPrompt {
+		data = map[string]string{"prompt": prompt}
+	}
+
+	// Actions given directly are checked before anything is charged for them
+	if !hasPrompt {
+		if validator, ok := factory.CreateProduct().(ActionValidator); ok {
+			if data, err = validator.ValidateAction(data); err != nil {
+				return ServiceResponse{}, err
+			}
 		}
+	}
 
-		product := factory.CreateProduct()
-		rawData, err := product.PerformAction(map[string]string{"prompt": prompt})
+	// Without the classifier call, the quota has to be checked up front
+	if err := ratelimit.CheckLLM(ctx); err != nil {
+		return ServiceResponse{}, err
+	}
+	return sd.performService(ctx, ledger, service, factory, prompt, data), nil
+}
+
+// ResolveSearch turns a prompt into the Ticketmaster action /promptOpenAI
+// would run for it: screened and resolved to a locale, location and dates
+// like any prompt, then extracted by the LLM
+func (sd *ServiceDirector) ResolveSearch(ctx context.Context, prompt string) (*TicketmasterAction, error) {
+	ctx = logging.NewContext(ctx, sd.Logger)
+	ctx, prompt, err := sd.prepare(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	return ResolveTicketmasterAction(ctx, prompt)
+}
+
+// prepare screens a prompt and resolves what every service shares: the
+// locale, location, date range and budget. It returns the normalized prompt
+// and a context carrying the rest.
+func (sd *ServiceDirector) prepare(ctx context.Context, prompt string) (context.Context, string, error) {
+	// Normalize the prompt and screen it before it goes anywhere near the LLM
+	if prompt != "" {
+		checked, err := sd.Guard.Check(prompt)
+		for _, pattern := range checked.Matches {
+			metrics.ObserveInjection(pattern, errors.Is(err, guard.ErrInjection))
+		}
+		if len(checked.Matches) > 0 {
+			sd.Logger.WarnContext(ctx, "Prompt matched injection patterns", "patterns", checked.Matches, "policy", sd.Guard.Policy)
+		}
 		if err != nil {
-			log.Printf("Error processing service %s: %v\n", service, err)
-			serviceResponses = append(serviceResponses, ServiceResponse{
-				Service: service,
-				Data:    nil,
-				Error:   err.Error(),
-			})
-			continue
+			return ctx, "", err
 		}
+		prompt = checked.Prompt
+	}
 
-		// Format the raw data
-		formattedData, err := FormatData(service, []CombinedData{{Service: service, Data: rawData}})
+	// Every service answers in the same language
+	lang := locale.Resolve(ctx, prompt)
+	sd.Logger.InfoContext(ctx, "Locale resolved", "locale", lang.String())
+	ctx = locale.NewContext(ctx, &lang)
 
-		fmt.Printf("Formatted data for service %s: %v\n", service, formattedData)
-		if err != nil {
-			log.Printf("Error formatting data for service %s: %v\n", service, err)
-			serviceResponses = append(serviceResponses, ServiceResponse{
-				Service: service,
-				Data:    nil,
-				Error:   fmt.Sprintf("Failed to format data: %v", err),
-			})
-			continue
+	// Every service searches around the same place
+	if loc := sd.Locations.Resolve(ctx, prompt, geo.HintFromContext(ctx)); loc != nil {
+		sd.Logger.InfoContext(ctx, "Location resolved", "source", loc.Source, "city", loc.City, "country", loc.Country)
+		ctx = geo.NewContext(ctx, loc)
+	}
+
+	// Dates like "this weekend" are resolved here, in the user's timezone;
+	// anything the parser does not understand is left to the LLM
+	if r, ok := dates.Parse(prompt, dates.Now(), dates.TimezoneFromContext(ctx)); ok {
+		sd.Logger.InfoContext(ctx, "Date range resolved", "expr", r.Expr, "start", r.Start, "end", r.End)
+		ctx = dates.NewContext(ctx, &r)
+	}
+
+	// A spending limit in the prompt, like "under $200", applies unless the
+	// request gave its own budget
+	if budget.FromContext(ctx) == nil {
+		if b, ok := budget.Parse(prompt); ok {
+			ctx = budget.NewContext(ctx, &b)
+		}
+	}
+	if b := budget.FromContext(ctx); b != nil {
+		sd.Logger.InfoContext(ctx, "Budget set", "amount", b.Amount, "currency", b.Currency)
+	}
+	return ctx, prompt, nil
+}
+
+// runService has one ranked service answer the prompt if it is applicable
+// enough. It reports the parsed applicability and whether the service's
+// factory was invoked.
+func (sd *ServiceDirector) runService(ctx context.Context, ledger *usage.Ledger, result AnalysisResult, prompt string) (response ServiceResponse, applicability int, routed bool) {
+	service := result.Service
+	applicabilityInt, err := strconv.Atoi(result.Applicability)
+
+	if err != nil {
+		sd.Logger.WarnContext(ctx, "Error converting applicability to integer", "service", service, "error", err)
+	} else {
+		metrics.ObserveApplicability(service, applicabilityInt)
+	}
+
+	if applicabilityInt < ApplicabilityThreshold {
+		sd.Logger.InfoContext(ctx, "Skipping service", "service", service, "applicability", applicabilityInt)
+		return ServiceResponse{
+			Service: service,
+			Data:    nil,
+			Error:   fmt.Sprintf("Applicability below threshold (%d%%)", applicabilityInt),
+		}, applicabilityInt, false
+	}
+
+	factory, exists := sd.Factories[service]
+	if !exists {
+		errMsg := fmt.Sprintf("Factory not found for service: %s", service)
+		sd.Logger.WarnContext(ctx, "Factory not found", "service", service)
+		return ServiceResponse{
+			Service: service,
+			Data:    nil,
+			Error:   errMsg,
+		}, applicabilityInt, false
+	}
+
+	return sd.performService(ctx, ledger, service, factory, prompt, map[string]string{"prompt": prompt}), applicabilityInt, true
+}
+
+// performService has the service's product act on data, then formats,
+// filters, ranks and prices the activities it returned
+func (sd *ServiceDirector) performService(ctx context.Context, ledger *usage.Ledger, service string, factory AbstractFactory, prompt string, data map[string]string) ServiceResponse {
+	serviceCtx := usage.WithService(ctx, service)
+
+	reportProgress(ctx, ProgressEvent{Stage: ProgressFetching, Service: service})
+	product := factory.CreateProduct()
+	rawData, err := product.PerformAction(serviceCtx, data)
+	if err != nil {
+		sd.Logger.ErrorContext(ctx, "Error processing service", "service", service, "error", err)
+		return ServiceResponse{
+			Service: service,
+			Data:    nil,
+			Error:   err.Error(),
+			Usage:   ledger.ServiceSummary(service),
+			Prompts: ledger.Templates(service),
 		}
+	}
+
+	// Format the raw data
+	reportProgress(ctx, ProgressEvent{Stage: ProgressFormatting, Service: service})
+	formattedData, err := FormatData(serviceCtx, service, []CombinedData{{Service: service, Data: rawData}})
 
-		serviceResponses = append(serviceResponses, ServiceResponse{
+	if err != nil {
+		sd.Logger.ErrorContext(ctx, "Error formatting data", "service", service, "error", err)
+		return ServiceResponse{
 			Service: service,
-			Data:    formattedData,
-		})
+			Data:    nil,
+			Error:   fmt.Sprintf("Failed to format data: %v", err),
+			Usage:   ledger.ServiceSummary(service),
+			Prompts: ledger.Templates(service),
+		}
 	}
 
-	respData, _ := json.Marshal(serviceResponses)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(respData)
+	// Prices and availability come from the raw data, then the activities
+	// the request rules out are dropped before the rest are ranked
+	if enricher, ok := product.(ActivityEnricher); ok {
+		enricher.EnrichActivities(rawData, formattedData)
+	}
+	formattedData = ranking.Filter(serviceCtx, formattedData)
+
+	// Merge duplicates and order the activities for the prompt
+	formattedData = sd.Ranking.Rank(serviceCtx, prompt, formattedData)
+
+	// Estimate costs against the budget, if any
+	formattedData = budget.Annotate(serviceCtx, service, formattedData)
+
+	sd.Logger.DebugContext(ctx, "Formatted data", "service", service, "activities", len(formattedData))
+	storage.RecordActivities(serviceCtx, formattedData)
+	return ServiceResponse{
+		Service: service,
+		Data:    formattedData,
+		Usage:   ledger.ServiceSummary(service),
+		Prompts: ledger.Templates(service),
+	}
+}
+
+// saveHistory writes the finished run to History. The write outlives the
+// request's context so a client hanging up does not lose the record.
+func (sd *ServiceDirector) saveHistory(ctx context.Context, rec *storage.Recorder, ledger *usage.Ledger, err error) {
+	if sd.History == nil {
+		return
+	}
+	status, msg := http.StatusOK, ""
+	if err != nil {
+		status, msg = RunErrorStatus(err)
+	}
+	record := rec.Finish(status, msg, ledger)
+	record.ID = storage.NewID()
+	if err := sd.History.SavePrompt(context.WithoutCancel(ctx), record); err != nil {
+		sd.Logger.ErrorContext(ctx, "Error saving prompt history", "error", err)
+	}
+}
+
+// setUsageHeaders reports the request's total LLM usage and the prompt
+// templates it used in the response headers
+func setUsageHeaders(w http.ResponseWriter, ledger *usage.Ledger) {
+	summary := ledger.Summary()
+	w.Header().Set("X-LLM-Calls", strconv.Itoa(summary.Calls))
+	w.Header().Set("X-LLM-Prompt-Tokens", strconv.Itoa(summary.PromptTokens))
+	w.Header().Set("X-LLM-Completion-Tokens", strconv.Itoa(summary.CompletionTokens))
+	w.Header().Set("X-LLM-Cost-USD", strconv.FormatFloat(summary.CostUSD, 'f', 6, 64))
+
+	var templates []string
+	for _, r := range ledger.Records() {
+		if r.Template != "" {
+			templates = append(templates, r.Template)
+		}
+	}
+	w.Header().Set("X-Prompt-Templates", strings.Join(templates, ", "))
 }
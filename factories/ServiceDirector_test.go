@@ -0,0 +1,119 @@
+package factories
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-backend/geo"
+	"go-backend/jobs"
+	"go-backend/replay"
+)
+
+// newReplayDirector returns a director whose upstream calls are served from
+// the fixtures in testdata/fixtures. They were recorded from cmd/mockupstreams
+// with UPSTREAM_MODE=record and FIXED_NOW set as below, so a change to any
+// upstream request shows up as a missing fixture.
+func newReplayDirector(t *testing.T) *ServiceDirector {
+	t.Setenv("FIXED_NOW", "2026-10-16T18:00:00Z")
+	t.Setenv("UPSTREAM_MODE", string(replay.ModeReplay))
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("TICKETMASTER_API_KEY", "")
+	t.Setenv("OPENAI_BASE_URL", "")
+	t.Setenv("TICKETMASTER_BASE_URL", "")
+
+	client := HTTPClient
+	HTTPClient = replay.NewClient(replay.ModeReplay, replay.DefaultDir)
+	t.Cleanup(func() { HTTPClient = client })
+
+	sd := NewServiceDirector(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	sd.Locations = &geo.Resolver{Geocoder: geo.DefaultGazetteer()}
+	return sd
+}
+
+// TestProcessPromptReplay runs a prompt end to end without touching the network
+func TestProcessPromptReplay(t *testing.T) {
+	sd := newReplayDirector(t)
+
+	body := `{"prompt":"concerts in Chicago this weekend"}`
+	w := httptest.NewRecorder()
+	sd.ProcessPrompt(w, httptest.NewRequest(http.MethodPost, "/promptOpenAI", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	var responses []ServiceResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	tests := []struct {
+		service    string
+		activities int
+		hasError   bool
+	}{
+		{"Ticketing", 2, false},
+		{"Accommodations", 0, true},
+		{"Restaurants", 0, true},
+	}
+	if len(responses) != len(tests) {
+		t.Fatalf("got %d responses, want %d: %s", len(responses), len(tests), w.Body.String())
+	}
+	for i, tt := range tests {
+		got := responses[i]
+		if got.Service != tt.service {
+			t.Errorf("responses[%d].Service = %q, want %q", i, got.Service, tt.service)
+		}
+		if (got.Error != "") != tt.hasError {
+			t.Errorf("%s: error = %q, want error %v", tt.service, got.Error, tt.hasError)
+		}
+		activities, _ := got.Data.([]interface{})
+		if len(activities) != tt.activities {
+			t.Errorf("%s: %d activities, want %d", tt.service, len(activities), tt.activities)
+		}
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	sd := newReplayDirector(t)
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+		// wantMiss is set when Ticketing should find no fixture for its request
+		wantMiss bool
+	}{
+		{name: "request", input: `{"prompt":"concerts in Chicago this weekend","timezone":"UTC","async":true}`},
+		{name: "prompt queued by an earlier version", input: `"concerts in Chicago this weekend"`},
+		// The options are checked again, as the job may have been resumed
+		{name: "invalid option", input: `{"prompt":"concerts in Chicago this weekend","sort":"price"}`, wantErr: true},
+		// Another timezone moves "this weekend", so no fixture matches
+		{name: "options apply", input: `{"prompt":"concerts in Chicago this weekend","timezone":"Asia/Tokyo"}`, wantMiss: true},
+		{name: "not a request", input: `42`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := sd.RunJob(context.Background(), jobs.Job{Kind: PromptJobKind, Input: json.RawMessage(tt.input)}, func(int) {})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("result = %v, want an error", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			responses, _ := result.([]ServiceResponse)
+			if len(responses) == 0 || responses[0].Service != "Ticketing" {
+				t.Fatalf("responses = %+v, want Ticketing first", responses)
+			}
+			if missed := strings.Contains(responses[0].Error, "no fixture"); missed != tt.wantMiss {
+				t.Errorf("Ticketing error = %q, want a missing fixture %v", responses[0].Error, tt.wantMiss)
+			}
+		})
+	}
+}
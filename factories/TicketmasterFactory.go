@@ -1,23 +1,56 @@
 package factories
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"go-backend/dates"
+	"go-backend/dedup"
+	"go-backend/geo"
+	"go-backend/guard"
+	"go-backend/locale"
+	"go-backend/logging"
+	"go-backend/metrics"
+	"go-backend/prompts"
+	"go-backend/ratelimit"
+	"go-backend/storage"
+	"go-backend/tracing"
+	"go-backend/usage"
 )
 
+const defaultTicketmasterBaseURL = "https://app.ticketmaster.com/discovery/v2"
+
+// TicketmasterBaseURL returns the Discovery API root, overridable with
+// TICKETMASTER_BASE_URL to point the pipeline at a mock server
+func TicketmasterBaseURL() string {
+	if base := os.Getenv("TICKETMASTER_BASE_URL"); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	return defaultTicketmasterBaseURL
+}
+
 // TicketmasterFactory struct
-type TicketmasterFactory struct{}
+type TicketmasterFactory struct {
+	Logger *slog.Logger
+}
 
 // CreateProduct method for TicketmasterFactory
 func (f *TicketmasterFactory) CreateProduct() AbstractProduct {
 	return &TicketmasterProduct{
 		TicketmasterApiKey:  os.Getenv("TICKETMASTER_API_KEY"),
-		TicketmasterBaseUrl: "https://app.ticketmaster.com/discovery/v2",
+		TicketmasterBaseUrl: TicketmasterBaseURL(),
+		Logger:              f.Logger,
 	}
 }
 
@@ -25,59 +58,91 @@ func (f *TicketmasterFactory) CreateProduct() AbstractProduct {
 type TicketmasterProduct struct {
 	TicketmasterApiKey  string
 	TicketmasterBaseUrl string
+	Logger              *slog.Logger
 }
 
 // PerformAction method to use LLM for action determination
-func (p *TicketmasterProduct) PerformAction(data map[string]string) (map[string]interface{}, error) {
+func (p *TicketmasterProduct) PerformAction(ctx context.Context, data map[string]string) (result map[string]interface{}, err error) {
+	ctx, span := tracing.Start(ctx, "TicketmasterProduct.PerformAction")
+	defer func() { tracing.End(span, err) }()
+
 	// Check if the prompt is provided for LLM analysis
 	prompt, exists := data["prompt"]
 	if exists {
 		// Analyze the prompt to determine the action and parameters
-		actionDetails, err := AnalyzePromptWithLLM(prompt)
+		actionDetails, err := ResolveTicketmasterAction(ctx, prompt)
 
 		if err != nil {
 			return nil, fmt.Errorf("error analyzing prompt with LLM: %v", err)
 		}
 
-		if actionDetails != nil {
-			fmt.Printf("The analyzed action is: Action: %s, Params: %v\n", actionDetails.Action, actionDetails.Parameters)
+		if actionDetails == nil {
+			return nil, fmt.Errorf("error analyzing prompt with LLM: no action suggested")
 		}
+		p.Logger.InfoContext(ctx, "Analyzed Ticketmaster action", "action", actionDetails.Action, "params", actionDetails.Parameters)
 
 		// Proceed with the determined action and parameters
-		return p.performHTTPRequest(*actionDetails)
+		return p.performHTTPRequest(ctx, *actionDetails)
 	}
 
-	// Fallback to directly using provided action if no prompt analysis is needed
-	action, ok := data["action"]
-	if !ok {
-		return nil, fmt.Errorf("action key is required in data or prompt for analysis")
+	// Fallback to directly using provided action if no prompt analysis is needed.
+	// It is checked like an extracted one so callers cannot reach other paths
+	// or send other parameters with our API key.
+	data, err = p.ValidateAction(data)
+	if err != nil {
+		return nil, err
 	}
-
-	// Extract additional parameters and perform the HTTP request using TicketmasterAction struct
 	params := make(map[string]string)
 	for k, v := range data {
-		if k != "action" && k != "prompt" { // Exclude action and prompt keys
+		if k != "action" {
 			params[k] = v
 		}
 	}
 	actionDetails := TicketmasterAction{
-		Action:     action,
+		Action:     data["action"],
 		Parameters: params,
 	}
 
-	return p.performHTTPRequest(actionDetails)
+	return p.performHTTPRequest(ctx, actionDetails)
+}
+
+// ValidateAction checks a direct action against the same allowlist as
+// extracted ones and drops the parameters that are not allowed
+func (p *TicketmasterProduct) ValidateAction(data map[string]string) (map[string]string, error) {
+	action, ok := data["action"]
+	if !ok {
+		return nil, fmt.Errorf("action key is required in data or prompt for analysis")
+	}
+	params := make(map[string]string)
+	for k, v := range data {
+		if k != "action" && k != "prompt" {
+			params[k] = v
+		}
+	}
+	action, params, dropped, err := guard.ValidateTicketmasterAction(action, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(dropped) > 0 {
+		p.Logger.Warn("Dropped unsupported Ticketmaster parameters", "params", dropped)
+	}
+	params["action"] = action
+	return params, nil
 }
 
-func (p *TicketmasterProduct) performHTTPRequest(tma TicketmasterAction) (map[string]interface{}, error) {
+func (p *TicketmasterProduct) performHTTPRequest(ctx context.Context, tma TicketmasterAction) (result map[string]interface{}, err error) {
+	ctx, span := tracing.Start(ctx, "TicketmasterProduct.performHTTPRequest",
+		attribute.String("ticketmaster.action", tma.Action))
+	defer func() { tracing.End(span, err) }()
+
+	storage.RecordAction(ctx, tma.Action, tma.Parameters)
+
 	// Make sure the base URL is correct and ends without a slash
-	baseURL := "https://app.ticketmaster.com/discovery/v2"
+	baseURL := strings.TrimSuffix(p.TicketmasterBaseUrl, "/")
 
 	// Construct the endpoint URL by appending the action and ".json" properly
 	endpoint := fmt.Sprintf("%s/%s.json", baseURL, tma.Action)
 
-	// Add the action parameters to the endpoint if they exist
-	println("the number of params is: ", len(tma.Parameters))
-
 	// Parse the URL to check for errors
 	u, err := url.Parse(endpoint)
 	if err != nil {
@@ -93,30 +158,161 @@ func (p *TicketmasterProduct) performHTTPRequest(tma TicketmasterAction) (map[st
 
 	u.RawQuery = q.Encode()
 
-	fmt.Println("The full URL is: ", u.String())
+	p.Logger.DebugContext(ctx, "Calling Ticketmaster", "url", u.String())
 
-	// Make the HTTP GET request
-	resp, err := http.Get(u.String())
+	// The same search made for another prompt in a batch is only sent once
+	body, shared, err := dedup.Do(ctx, dedup.Key("ticketmaster", u.String()), func() ([]byte, error) {
+		// Count the call against the client's daily upstream quota
+		if err := ratelimit.AddUpstreamCall(ctx); err != nil {
+			return nil, err
+		}
+		return p.get(ctx, u.String())
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error making HTTP request: %v", err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Bool("ticketmaster.shared", shared))
+	if shared {
+		storage.RecordSharedUpstream(ctx)
 	}
-	defer resp.Body.Close()
 
 	// Decode the JSON response
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, fmt.Errorf("error decoding JSON response: %v", err)
 	}
 
 	return result, nil
 }
 
+// get sends a Discovery API request and returns the raw response body
+func (p *TicketmasterProduct) get(ctx context.Context, rawURL string) ([]byte, error) {
+	// Make the HTTP GET request
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %v", err)
+	}
+
+	start := time.Now()
+	defer metrics.ObserveStage(metrics.StageUpstreamCall, usage.ServiceFromContext(ctx), start)
+
+	tracing.Inject(req)
+
+	if err := TicketmasterBreaker.Allow(); err != nil {
+		return nil, err
+	}
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		recordUpstream(TicketmasterBreaker, req, 0, err)
+		metrics.ObserveUpstream(metrics.UpstreamTicketmaster, 0, err)
+		return nil, fmt.Errorf("error making HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+	recordUpstream(TicketmasterBreaker, req, resp.StatusCode, nil)
+	metrics.ObserveUpstream(metrics.UpstreamTicketmaster, resp.StatusCode, nil)
+	storage.RecordUpstream(ctx, resp.StatusCode, time.Since(start))
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
+	// Transient failures are returned as errors so they are never shared
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("Ticketmaster returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading HTTP response: %v", err)
+	}
+	return body, nil
+}
+
 // TicketmasterAction contains the action and parameters required for the Ticketmaster API
 type TicketmasterAction struct {
 	Action     string            `json:"action"`
 	Parameters map[string]string `json:"parameters"`
 }
 
+// ResolveTicketmasterAction has the LLM turn a prompt into a Discovery API
+// action, then points it at the location, date range and locale resolved
+// for the prompt in ctx. The action is nil if the LLM suggested none.
+func ResolveTicketmasterAction(ctx context.Context, prompt string) (*TicketmasterAction, error) {
+	tma, err := AnalyzePromptWithLLM(ctx, prompt)
+	if err != nil || tma == nil {
+		return tma, err
+	}
+	applyLocation(tma.Parameters, geo.FromContext(ctx))
+	applyDateRange(tma, dates.FromContext(ctx))
+	applyLocale(tma.Parameters, locale.FromContext(ctx))
+	return tma, nil
+}
+
+// defaultSearchRadius is the radius, in miles, searched around a resolved
+// location when the prompt does not give one
+const defaultSearchRadius = "25"
+
+// applyLocation points a search at the resolved location. The deprecated
+// latlong is always converted to a geoPoint. A place named in the prompt
+// overrides whatever the LLM chose; the client's own location is only used
+// if the LLM found no place to search.
+func applyLocation(params map[string]string, loc *geo.Location) {
+	if latlong, ok := params["latlong"]; ok {
+		delete(params, "latlong")
+		if c, err := geo.ParseCoordinates(latlong); err == nil {
+			params["geoPoint"] = geo.Geohash(c.Lat, c.Lon, geo.GeohashPrecision)
+		}
+	}
+	if loc == nil {
+		return
+	}
+
+	if loc.Source != geo.SourcePrompt {
+		for _, key := range []string{"geoPoint", "postalCode", "city", "stateCode", "marketId", "venueId"} {
+			if params[key] != "" {
+				return
+			}
+		}
+	}
+	params["geoPoint"] = loc.Geohash()
+	if params["radius"] == "" {
+		params["radius"] = defaultSearchRadius
+		params["unit"] = "miles"
+	}
+}
+
+// applyLocale asks for results in the user's locale, whatever the LLM
+// chose. A search with nowhere to look is also limited to the locale's
+// country.
+func applyLocale(params map[string]string, l *locale.Locale) {
+	if l == nil {
+		return
+	}
+	// Discovery locales are lowercase and fall back to any language with "*"
+	params["locale"] = strings.ToLower(l.String()) + ",*"
+	if l.Region == "" {
+		return
+	}
+	for _, key := range []string{"geoPoint", "postalCode", "city", "stateCode", "countryCode", "marketId", "venueId"} {
+		if params[key] != "" {
+			return
+		}
+	}
+	params["countryCode"] = l.Region
+}
+
+// applyDateRange sets an event search's dates to the range the date parser
+// resolved, which wins over whatever the LLM chose
+func applyDateRange(tma *TicketmasterAction, r *dates.Range) {
+	if r == nil || tma.Action != "events" {
+		return
+	}
+	tma.Parameters["startDateTime"], tma.Parameters["endDateTime"] = TicketmasterRange(*r)
+}
+
+// TicketmasterRange formats a range for the Discovery API, whose
+// endDateTime is inclusive
+func TicketmasterRange(r dates.Range) (start, end string) {
+	return r.Start.UTC().Format(dates.TicketmasterLayout), r.End.Add(-time.Second).UTC().Format(dates.TicketmasterLayout)
+}
+
 // Helper function to convert interface{} to string safely
 func toString(value interface{}) string {
 	switch v := value.(type) {
@@ -131,60 +327,42 @@ func toString(value interface{}) string {
 }
 
 // AnalyzePromptWithLLM uses an LLM to analyze the prompt and suggest Ticketmaster actions
-func AnalyzePromptWithLLM(prompt string) (*TicketmasterAction, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	print("the api key is: ", apiKey)
-	endpoint := "https://api.openai.com/v1/chat/completions"
+func AnalyzePromptWithLLM(ctx context.Context, prompt string) (tma *TicketmasterAction, err error) {
+	ctx, span := tracing.Start(ctx, "AnalyzePromptWithLLM")
+	defer func() { tracing.End(span, err) }()
 
-	requestBody := map[string]interface{}{
-		"model": "gpt-3.5-turbo",
-		"messages": []map[string]string{
-			{"role": "system", "content": "You are a system that dervies API actions and query paramters based on user prompts. Please return only a json object with the action and parameters."},
-			{"role": "system", "content": "Query param with date must be of valid format YYYY-MM-DDTHH:mm:ssZ {example: 2020-08-01T14:00:00Z }"},
-			{"role": "user", "content": fmt.Sprintf("Given the user's request: '%s', determine the most appropriate Ticketmaster API action and parameters. Return a JSON object with the action and parameters. Consider valid actions such as attractions, classifications, events, venues. Include details on how to use the following query parameters effectively: \n- id (Filter entities by its id)\n- keyword (Keyword to search on)\n- attractionId (Filter by attraction id)\n- venueId (Filter by venue id)\n- postalCode (Filter by postal code / zipcode)\n- latlong (Filter events by latitude and longitude; deprecated)\n- radius (Radius of the area for event search)\n- unit (Unit of the radius, e.g., miles, km)\n- source (Filter entities by source name, e.g., ticketmaster, universe, frontgate)\n- locale (Locale in ISO code format)\n- marketId, startDateTime, endDateTime (Filter events by market, start and end dates)\n- includeTBA, includeTBD (Include events with dates to be announced or defined)\n- size, page (Pagination options)\n- sort (Sorting order of the search results, e.g., 'name,asc', 'date,desc')\n- onsaleStartDateTime, onsaleEndDateTime (Filter events by onsale start and end dates)\n- city, countryCode, stateCode (Filter by geographical location)\n- classificationName, classificationId (Filter by type of event, like genre or segment)\n- includeFamily (Include family-friendly classifications)\n- promoterId, genreId, subGenreId, typeId, subTypeId (Filter by various IDs related to event categorization)\n- geoPoint (Filter events by geoHash)\n- includeSpellcheck (Include spell check suggestions in response)", prompt)},
-		},
-		"max_tokens": 500,
-	}
+	apiKey := os.Getenv("OPENAI_API_KEY")
 
-	body, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %v", err)
+	// The model is told the user's current time so it does not invent dates
+	// or times ("tonight", "in 3 hours"), and is given the range the date
+	// parser resolved, if any. Tests pin the time with FIXED_NOW.
+	tz := dates.TimezoneFromContext(ctx)
+	var dateRange map[string]string
+	if r := dates.FromContext(ctx); r != nil {
+		start, end := TicketmasterRange(*r)
+		dateRange = map[string]string{"Start": start, "End": end}
 	}
-
-	req, err := http.NewRequest("POST", endpoint, strings.NewReader(string(body)))
+	rendered, err := prompts.Render(prompts.TicketmasterAction, map[string]interface{}{
+		"Prompt":    prompt,
+		"Now":       dates.Now().In(tz).Format("Monday 2 January 2006, 15:04"),
+		"Timezone":  tz.String(),
+		"DateRange": dateRange,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %v", err)
+	requestBody := map[string]interface{}{
+		"model":      "gpt-3.5-turbo",
+		"max_tokens": 500,
 	}
-	defer resp.Body.Close()
 
-	responseData, err := io.ReadAll(resp.Body)
+	content, err := chatCompletion(ctx, apiKey, metrics.StageActionExtraction, rendered, requestBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response data: %v", err)
-	}
-
-	type Response struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
-	}
-	var response Response
-
-	if err := json.Unmarshal(responseData, &response); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+		return nil, err
 	}
 
-	if len(response.Choices) == 0 || response.Choices[0].Message.Content == "" {
+	if content == "" {
 		return nil, fmt.Errorf("no response or empty content from LLM")
 	}
 
@@ -192,9 +370,9 @@ func AnalyzePromptWithLLM(prompt string) (*TicketmasterAction, error) {
 		Action     string                 `json:"action"`
 		Parameters map[string]interface{} `json:"parameters"`
 	}
-	print("The content is: ", response.Choices[0].Message.Content)
+	logging.FromContext(ctx).DebugContext(ctx, "Ticketmaster action extracted", "content", content)
 
-	if err := json.Unmarshal([]byte(response.Choices[0].Message.Content), &intermediate); err != nil {
+	if err := json.Unmarshal([]byte(content), &intermediate); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal action from content: %v", err)
 	}
 
@@ -204,9 +382,20 @@ func AnalyzePromptWithLLM(prompt string) (*TicketmasterAction, error) {
 		params[key] = toString(value)
 	}
 
+	// Only allowed actions and query parameters ever reach Ticketmaster
+	validAction, validParams, dropped, err := guard.ValidateTicketmasterAction(intermediate.Action, params)
+	if err != nil {
+		metrics.ObserveRejectedOutput(metrics.StageActionExtraction)
+		return nil, fmt.Errorf("invalid action from LLM: %v", err)
+	}
+	if len(dropped) > 0 {
+		metrics.ObserveRejectedOutput(metrics.StageActionExtraction)
+		logging.FromContext(ctx).WarnContext(ctx, "Dropped unsupported Ticketmaster parameters", "params", dropped)
+	}
+
 	action := TicketmasterAction{
-		Action:     intermediate.Action,
-		Parameters: params,
+		Action:     validAction,
+		Parameters: validParams,
 	}
 
 	return &action, nil
@@ -0,0 +1,73 @@
+package factories
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-backend/dates"
+)
+
+// newLLMServer answers every chat completion with content and hands the
+// system message of each request to seen
+func newLLMServer(t *testing.T, content string, seen func(system string)) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, m := range req.Messages {
+			if m.Role == "system" && seen != nil {
+				seen(m.Content)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": content}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("OPENAI_BASE_URL", srv.URL)
+	t.Setenv("OPENAI_API_KEY", "test")
+}
+
+func TestPerformActionWithoutAction(t *testing.T) {
+	for _, content := range []string{"null", "{}", `{"action": "", "parameters": {}}`} {
+		t.Run(content, func(t *testing.T) {
+			newLLMServer(t, content, nil)
+			p := &TicketmasterProduct{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+			result, err := p.PerformAction(context.Background(), map[string]string{"prompt": "concerts"})
+			if err == nil {
+				t.Errorf("PerformAction = %v, want an error", result)
+			}
+		})
+	}
+}
+
+func TestAnalyzePromptWithLLMNow(t *testing.T) {
+	t.Setenv("FIXED_NOW", "2026-10-16T18:00:00Z")
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("no timezone data:", err)
+	}
+
+	var system string
+	newLLMServer(t, `{"action": "events", "parameters": {"keyword": "comedy"}}`, func(s string) { system = s })
+
+	ctx := dates.WithTimezone(context.Background(), chicago)
+	if _, err := AnalyzePromptWithLLM(ctx, "comedy in 3 hours"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "current time is Friday 16 October 2026, 13:00 (America/Chicago)"; !strings.Contains(system, want) {
+		t.Errorf("system message does not say %q:\n%s", want, system)
+	}
+}
@@ -0,0 +1,147 @@
+package factories
+
+import (
+	"strings"
+	"unicode"
+
+	"go-backend/ranking"
+)
+
+// ticketmasterStatuses maps Discovery dates.status.code values to activity statuses
+var ticketmasterStatuses = map[string]string{
+	"onsale":      ranking.StatusOnSale,
+	"offsale":     ranking.StatusOffSale,
+	"canceled":    ranking.StatusCancelled,
+	"cancelled":   ranking.StatusCancelled,
+	"rescheduled": ranking.StatusRescheduled,
+	"postponed":   ranking.StatusPostponed,
+}
+
+// EnrichActivities sets the Discovery event and venue ids, price range, sale
+// status and public on-sale dates of each activity from the event it was
+// formatted from. An activity is matched to its event by link, or else by
+// name and date.
+func (p *TicketmasterProduct) EnrichActivities(raw map[string]interface{}, activities []interface{}) {
+	embedded, _ := raw["_embedded"].(map[string]interface{})
+	events, _ := embedded["events"].([]interface{})
+	if len(events) == 0 {
+		return
+	}
+
+	byURL := make(map[string]map[string]interface{})
+	byName := make(map[string]map[string]interface{})
+	for _, e := range events {
+		event, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if url, _ := event["url"].(string); url != "" {
+			byURL[url] = event
+		}
+		name, _ := event["name"].(string)
+		date, _ := jsonPath(event, "dates", "start", "localDate").(string)
+		byName[eventKey(name, date)] = event
+	}
+
+	for _, a := range activities {
+		activity, ok := a.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		link, _ := activity["link"].(string)
+		event, ok := byURL[link]
+		if !ok {
+			name, _ := activity["activity_name"].(string)
+			date, _ := activity["date"].(string)
+			event, ok = byName[eventKey(name, date)]
+		}
+		if ok {
+			applyIDs(activity, event)
+			applyOffer(activity, event)
+		}
+	}
+}
+
+// applyIDs records which event, and which of its venues, activity is, so
+// clients can look up their details
+func applyIDs(activity, event map[string]interface{}) {
+	if id, _ := event["id"].(string); id != "" {
+		activity["event_id"] = id
+	}
+	venues, _ := jsonPath(event, "_embedded", "venues").([]interface{})
+	if len(venues) > 0 {
+		if id, _ := jsonPath(venues[0], "id").(string); id != "" {
+			activity["venue_id"] = id
+		}
+	}
+}
+
+// applyOffer copies an event's prices, status and sale window to activity
+func applyOffer(activity, event map[string]interface{}) {
+	// Ranges in other currencies than the first are left out rather than
+	// compared as if they were the same money
+	var currency string
+	var min, max float64
+	found := false
+	ranges, _ := event["priceRanges"].([]interface{})
+	for _, r := range ranges {
+		pr, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		c, _ := pr["currency"].(string)
+		lo, loOK := pr["min"].(float64)
+		hi, hiOK := pr["max"].(float64)
+		if !loOK || !hiOK || (found && c != currency) {
+			continue
+		}
+		if !found || lo < min {
+			min = lo
+		}
+		if !found || hi > max {
+			max = hi
+		}
+		currency, found = c, true
+	}
+	if found {
+		activity["price_min"] = min
+		activity["price_max"] = max
+		activity["currency"] = currency
+	}
+
+	if code, _ := jsonPath(event, "dates", "status", "code").(string); code != "" {
+		if status, ok := ticketmasterStatuses[strings.ToLower(code)]; ok {
+			activity["status"] = status
+		}
+	}
+	if start, _ := jsonPath(event, "sales", "public", "startDateTime").(string); start != "" {
+		activity["onsale_start"] = start
+	}
+	if end, _ := jsonPath(event, "sales", "public", "endDateTime").(string); end != "" {
+		activity["onsale_end"] = end
+	}
+}
+
+// jsonPath walks nested JSON objects and returns the value at keys, or nil
+func jsonPath(v interface{}, keys ...string) interface{} {
+	for _, k := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+// eventKey matches an event to its activity despite differences in the
+// formatter's punctuation and casing
+func eventKey(name, date string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+	return name + "|" + date
+}
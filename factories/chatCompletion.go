@@ -0,0 +1,153 @@
+package factories
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"go-backend/dedup"
+	"go-backend/metrics"
+	"go-backend/prompts"
+	"go-backend/ratelimit"
+	"go-backend/tracing"
+	"go-backend/usage"
+)
+
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAIBaseURL returns the OpenAI API root, overridable with OPENAI_BASE_URL
+// to point the pipeline at a mock server
+func OpenAIBaseURL() string {
+	if base := os.Getenv("OPENAI_BASE_URL"); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	return defaultOpenAIBaseURL
+}
+
+// chatCompletionResponse is the subset of the chat completion response we use
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// chatCompletion sends the rendered prompt to OpenAI, with the model settings
+// in requestBody, and returns the content of the first choice. The call's
+// token usage and prompt template are recorded under stage and charged to the
+// client's daily quota.
+func chatCompletion(ctx context.Context, apiKey, stage string, prompt prompts.Rendered, requestBody map[string]interface{}) (content string, err error) {
+	ctx, span := tracing.Start(ctx, "openai.chat_completion",
+		attribute.String("llm.stage", stage),
+		attribute.String("llm.prompt_template", prompt.Ref()))
+	defer func() { tracing.End(span, err) }()
+
+	requestBody["messages"] = prompt.Messages
+
+	body, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling request body: %v", err)
+	}
+
+	// Identical completions requested for other prompts in a batch are only
+	// made (and paid for) once
+	responseData, shared, err := dedup.Do(ctx, dedup.Key("openai", string(body)), func() ([]byte, error) {
+		if err := ratelimit.CheckLLM(ctx); err != nil {
+			return nil, err
+		}
+		return postChatCompletion(ctx, apiKey, stage, body)
+	})
+	if err != nil {
+		return "", err
+	}
+	span.SetAttributes(attribute.Bool("llm.shared", shared))
+
+	var response chatCompletionResponse
+	if err := json.Unmarshal(responseData, &response); err != nil {
+		return "", fmt.Errorf("error unmarshaling response data: %v", err)
+	}
+
+	// The response reports the dated model actually used; fall back to the requested one
+	model := response.Model
+	if model == "" {
+		model, _ = requestBody["model"].(string)
+	}
+	usage.Add(ctx, usage.Record{
+		Stage:            stage,
+		Template:         prompt.Ref(),
+		Model:            model,
+		PromptTokens:     response.Usage.PromptTokens,
+		CompletionTokens: response.Usage.CompletionTokens,
+		Shared:           shared,
+	})
+	span.SetAttributes(
+		attribute.String("llm.model", model),
+		attribute.Int("llm.prompt_tokens", response.Usage.PromptTokens),
+		attribute.Int("llm.completion_tokens", response.Usage.CompletionTokens),
+	)
+	if !shared {
+		ratelimit.AddLLMTokens(ctx, response.Usage.TotalTokens)
+	}
+
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("no choices available in the response")
+	}
+
+	return response.Choices[0].Message.Content, nil
+}
+
+// postChatCompletion sends a chat completion request and returns the raw
+// response body
+func postChatCompletion(ctx context.Context, apiKey, stage string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", OpenAIBaseURL()+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	tracing.Inject(req)
+
+	start := time.Now()
+	defer metrics.ObserveStage(stage, usage.ServiceFromContext(ctx), start)
+
+	if err := OpenAIBreaker.Allow(); err != nil {
+		return nil, err
+	}
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		recordUpstream(OpenAIBreaker, req, 0, err)
+		metrics.ObserveUpstream(metrics.UpstreamOpenAI, 0, err)
+		return nil, fmt.Errorf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+	recordUpstream(OpenAIBreaker, req, resp.StatusCode, nil)
+	metrics.ObserveUpstream(metrics.UpstreamOpenAI, resp.StatusCode, nil)
+
+	responseData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %v", err)
+	}
+
+	// Errors are returned rather than parsed so they are never shared
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("OpenAI returned status %d", resp.StatusCode)
+	}
+	return responseData, nil
+}
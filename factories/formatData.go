@@ -2,13 +2,20 @@ package factories
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
 	"os"
 	"strings"
+
+	"go-backend/guard"
+	"go-backend/locale"
+	"go-backend/logging"
+	"go-backend/metrics"
+	"go-backend/prompts"
+	"go-backend/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type CombinedData struct {
@@ -16,13 +23,15 @@ type CombinedData struct {
 	Data    interface{} `json:"data"`
 }
 
-func FormatData(service string, combinedData []CombinedData) ([]interface{}, error) {
+func FormatData(ctx context.Context, service string, combinedData []CombinedData) (activities []interface{}, err error) {
+	ctx, span := tracing.Start(ctx, "FormatData", attribute.String("service", service))
+	defer func() { tracing.End(span, err) }()
+
 	var parsedActivities []interface{}
-	openAiEndpoint := "https://api.openai.com/v1/chat/completions"
 	openAiApiKey := os.Getenv("OPENAI_API_KEY")
 
 	if len(combinedData) == 0 {
-		log.Println("No data provided for combined formatting.")
+		logging.FromContext(ctx).WarnContext(ctx, "No data provided for combined formatting", "service", service)
 		return parsedActivities, nil
 	}
 
@@ -37,86 +46,34 @@ func FormatData(service string, combinedData []CombinedData) ([]interface{}, err
 	}
 
 	correctedData := bytes.ReplaceAll(jsonData, []byte("`"), []byte("'"))
-	correctedDataString := string(correctedData)
-
-	requestBody := map[string]interface{}{
-		"model": "gpt-3.5-turbo",
-		"messages": []map[string]string{
-			{
-				"role":    "system",
-				"content": "You are a data extraction assistant that processes raw JSON data from multiple services. Extract activities in a standardized format...",
-			},
-			{
-				"role": "user",
-				"content": fmt.Sprintf("Format the following combined raw data into the standardized activity format, where these fields make up a json file:\n\n%s.\n"+
-					"Extract activities in a standardized format:\n"+
-					"- image: URL or image data for the activity.\n"+
-					"- activity_name: Name or title of the activity.\n"+
-					"- time: Time or duration of the activity (if available).\n"+
-					"- date: Date of the activity (if available).\n"+
-					"- location: Location of the activity.\n"+
-					"- details: Key highlights or details about the activity.\n"+
-					"- link: url to more information about the activity.",
-					correctedDataString),
-			},
-		},
-		"max_tokens":  1500,
-		"temperature": 0.3,
-	}
+	// Upstream text must not be able to close the data block in the prompt
+	correctedDataString := guard.StripDelimiters(string(correctedData))
 
-	body, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, fmt.Errorf("error marshaling request body: %v", err)
+	// Activity text is written in the user's language
+	lang := locale.Default()
+	if l := locale.FromContext(ctx); l != nil {
+		lang = *l
 	}
-
-	req, err := http.NewRequest("POST", openAiEndpoint, bytes.NewReader(body))
+	rendered, err := prompts.Render(prompts.Formatter, map[string]interface{}{
+		"Data":     correctedDataString,
+		"Language": fmt.Sprintf("%s (%s)", lang.Name(), lang),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error creating request: %v", err)
+		return nil, err
 	}
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+openAiApiKey)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error making HTTP request: %v", err)
+	requestBody := map[string]interface{}{
+		"model":       "gpt-3.5-turbo",
+		"max_tokens":  1500,
+		"temperature": 0.3,
 	}
-	defer resp.Body.Close()
 
-	responseData, err := ioutil.ReadAll(resp.Body)
+	llmOutput, err := chatCompletion(ctx, openAiApiKey, metrics.StageFormatting, rendered, requestBody)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %v", err)
-	}
-
-	var response struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
-	}
-
-	if err := json.Unmarshal(responseData, &response); err != nil {
-		return nil, fmt.Errorf("error unmarshaling response data: %v", err)
-	}
-
-	if len(response.Choices) == 0 {
-		return nil, fmt.Errorf("no choices available in the response")
+		return nil, err
 	}
 
-	llmOutput := response.Choices[0].Message.Content
-
-	// Clean up the output if necessary
-	cleanedOutput := strings.Replace(llmOutput, " ", "", -1)
-
-	// Remove Markdown backticks and trim spaces
-	cleanedOutput = strings.Trim(cleanedOutput, "` \n")
-
-	// Remove `json` prefix if present
-	cleanedOutput = strings.TrimPrefix(cleanedOutput, "json")
-
-	cleanedOutput = strings.ReplaceAll(cleanedOutput, "\n", "")
-	cleanedOutput = strings.ReplaceAll(cleanedOutput, "\\n", "")
+	cleanedOutput := trimCodeFence(llmOutput)
 
 	var formattedData map[string]interface{}
 	if err := json.Unmarshal([]byte(cleanedOutput), &formattedData); err != nil {
@@ -129,3 +86,16 @@ func FormatData(service string, combinedData []CombinedData) ([]interface{}, err
 
 	return parsedActivities, nil
 }
+
+// trimCodeFence returns the JSON inside a Markdown code fence the model may
+// have wrapped its output in, without the whitespace around it
+func trimCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimPrefix(s, "json")
+	s = strings.TrimSuffix(strings.TrimSpace(s), "```")
+	return strings.TrimSpace(s)
+}
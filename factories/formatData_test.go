@@ -0,0 +1,19 @@
+package factories
+
+import "testing"
+
+func TestTrimCodeFence(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"a": "Concierto al aire libre"}`, `{"a": "Concierto al aire libre"}`},
+		{"\n  {\"a\": 1}\n", `{"a": 1}`},
+		{"```json\n{\"a\": \"Jazz in the park\"}\n```", `{"a": "Jazz in the park"}`},
+		{"```\n{\"a\": 1}\n```\n", `{"a": 1}`},
+	}
+	for _, tt := range tests {
+		if got := trimCodeFence(tt.in); got != tt.want {
+			t.Errorf("trimCodeFence(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package factories
+
+import (
+	"net/http"
+
+	"go-backend/breaker"
+	"go-backend/metrics"
+)
+
+// HTTPClient is used for every upstream call the factories make. Its
+// transport can be swapped to record or replay upstream traffic.
+var HTTPClient = http.DefaultClient
+
+// Breakers turn calls away from an upstream that keeps failing. They are
+// replaced with ones configured from the environment at startup.
+var (
+	OpenAIBreaker       = breaker.New(metrics.UpstreamOpenAI, breaker.DefaultConfig)
+	TicketmasterBreaker = breaker.New(metrics.UpstreamTicketmaster, breaker.DefaultConfig)
+)
+
+// recordUpstream reports the outcome of an upstream call to its breaker.
+// Transport errors, 429s and 5xx responses count as failures; calls the
+// client cancelled say nothing about the upstream.
+func recordUpstream(b *breaker.Breaker, req *http.Request, status int, err error) {
+	switch {
+	case req.Context().Err() != nil:
+		b.Release()
+	case err != nil:
+		b.Record(true)
+	default:
+		b.Record(status == http.StatusTooManyRequests || status >= 500)
+	}
+}
@@ -0,0 +1,56 @@
+package factories
+
+import (
+	"context"
+
+	"go-backend/budget"
+	"go-backend/dates"
+	"go-backend/geo"
+	"go-backend/locale"
+)
+
+// Stages of a run reported to a ProgressFunc, in the order a run reaches them
+const (
+	// ProgressResolved is reported once the prompt has been screened and its
+	// locale, location, dates and budget resolved
+	ProgressResolved = "resolved"
+	// ProgressRanked is reported once the classifier has ranked the services
+	ProgressRanked = "ranked"
+	// ProgressFetching is reported as a service's product starts fetching data
+	ProgressFetching = "fetching"
+	// ProgressFormatting is reported as a service's data starts being formatted
+	ProgressFormatting = "formatting"
+)
+
+// ProgressEvent is one step of a run
+type ProgressEvent struct {
+	Stage string
+	// Service is set for the fetching and formatting stages
+	Service string
+	// Rankings are the classifier's results, for the ranked stage
+	Rankings []AnalysisResult
+	// Locale, Location, Dates and Budget are what the prompt resolved to, for
+	// the resolved stage. Location, Dates and Budget are nil when there was none.
+	Locale   *locale.Locale
+	Location *geo.Location
+	Dates    *dates.Range
+	Budget   *budget.Budget
+}
+
+// ProgressFunc is told about each step of a run as it happens. It is called
+// on the goroutine running the prompt, so it should not block.
+type ProgressFunc func(ProgressEvent)
+
+type progressKey struct{}
+
+// WithProgress returns a context whose runs report their progress to fn
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// reportProgress hands ev to the context's ProgressFunc, if any
+func reportProgress(ctx context.Context, ev ProgressEvent) {
+	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && fn != nil {
+		fn(ev)
+	}
+}
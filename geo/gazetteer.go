@@ -0,0 +1,215 @@
+package geo
+
+import (
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Geocoder finds the place a prompt names
+type Geocoder interface {
+	// Geocode returns the first place named in text; ok is false if it names none
+	Geocode(ctx context.Context, text string) (loc Location, ok bool, err error)
+}
+
+//go:embed data/gazetteer.csv
+var defaultGazetteer string
+
+// Gazetteer is an offline Geocoder over a fixed list of places. It matches
+// place names and aliases as whole words; aliases written in capitals, such
+// as "NYC" or "LA", only match in capitals.
+type Gazetteer struct {
+	names []gazetteerName
+}
+
+type gazetteerName struct {
+	// words is the normalized name; caseSensitive names are not lowercased
+	words         []string
+	caseSensitive bool
+	loc           Location
+}
+
+// placeCues are the words that introduce a place in a prompt, as in "jazz
+// in Chicago". Without one, a name is as likely to be a band, a team or a
+// dish ("Phoenix tickets", "Nashville hot chicken") as a place to search.
+var placeCues = map[string]bool{
+	"in":       true,
+	"near":     true,
+	"around":   true,
+	"at":       true,
+	"outside":  true,
+	"visiting": true,
+}
+
+// placeQualifiers may come between a cue and the place it introduces, as in
+// "shows around downtown Seattle"
+var placeQualifiers = map[string]bool{
+	"the":      true,
+	"downtown": true,
+	"uptown":   true,
+	"midtown":  true,
+	"central":  true,
+	"greater":  true,
+	"metro":    true,
+	"old":      true,
+	"north":    true,
+	"south":    true,
+	"east":     true,
+	"west":     true,
+	"northern": true,
+	"southern": true,
+	"eastern":  true,
+	"western":  true,
+}
+
+// maxQualifiers is how many qualifiers may come between a cue and a place
+const maxQualifiers = 2
+
+// DefaultGazetteer returns the built-in gazetteer of major cities
+func DefaultGazetteer() *Gazetteer {
+	g, err := ParseGazetteer(strings.NewReader(defaultGazetteer))
+	if err != nil {
+		panic(fmt.Sprintf("built-in gazetteer: %v", err))
+	}
+	return g
+}
+
+// LoadGazetteer reads a gazetteer file; see ParseGazetteer for the format
+func LoadGazetteer(path string) (*Gazetteer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseGazetteer(f)
+}
+
+// ParseGazetteer reads CSV rows of name, aliases (separated by |), state,
+// country, latitude and longitude. Lines starting with # are comments.
+func ParseGazetteer(r io.Reader) (*Gazetteer, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 6
+
+	g := &Gazetteer{}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		lat, err := strconv.ParseFloat(row[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid latitude: %v", row[0], err)
+		}
+		lon, err := strconv.ParseFloat(row[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid longitude: %v", row[0], err)
+		}
+		if err := (Coordinates{Lat: lat, Lon: lon}).Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %v", row[0], err)
+		}
+		loc := Location{Lat: lat, Lon: lon, City: row[0], State: row[2], Country: row[3], Source: SourcePrompt}
+
+		names := []string{row[0]}
+		if row[1] != "" {
+			names = append(names, strings.Split(row[1], "|")...)
+		}
+		for _, name := range names {
+			caseSensitive := name == strings.ToUpper(name)
+			words := strings.Fields(normalize(name, !caseSensitive))
+			if len(words) > 0 {
+				g.names = append(g.names, gazetteerName{words: words, caseSensitive: caseSensitive, loc: loc})
+			}
+		}
+	}
+	return g, nil
+}
+
+// Geocode returns the place named earliest in text. Where names overlap at
+// the same position, the longest wins ("New York City" over "New York").
+func (g *Gazetteer) Geocode(ctx context.Context, text string) (Location, bool, error) {
+	loc, ok := g.find(text, false)
+	return loc, ok, nil
+}
+
+// GeocodeCued is like Geocode but only matches a place introduced by a cue
+// such as "in" or "near", for free text like prompts
+func (g *Gazetteer) GeocodeCued(ctx context.Context, text string) (Location, bool, error) {
+	loc, ok := g.find(text, true)
+	return loc, ok, nil
+}
+
+func (g *Gazetteer) find(text string, cued bool) (Location, bool) {
+	exact := strings.Fields(normalize(text, false))
+	lower := make([]string, len(exact))
+	for i, w := range exact {
+		lower[i] = strings.ToLower(w)
+	}
+
+	for pos := range exact {
+		if cued && !cuedAt(lower, pos) {
+			continue
+		}
+		best := -1
+		for i, n := range g.names {
+			words := lower
+			if n.caseSensitive {
+				words = exact
+			}
+			if hasWordsAt(words, pos, n.words) && (best < 0 || len(n.words) > len(g.names[best].words)) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			return g.names[best].loc, true
+		}
+	}
+	return Location{}, false
+}
+
+// cuedAt reports whether a place cue comes before pos, allowing a few
+// qualifiers in between
+func cuedAt(lower []string, pos int) bool {
+	for i := pos - 1; i >= 0 && i >= pos-1-maxQualifiers; i-- {
+		if placeCues[lower[i]] {
+			return true
+		}
+		if !placeQualifiers[lower[i]] {
+			return false
+		}
+	}
+	return false
+}
+
+// hasWordsAt reports whether words continues with name at pos
+func hasWordsAt(words []string, pos int, name []string) bool {
+	if pos+len(name) > len(words) {
+		return false
+	}
+	for i, w := range name {
+		if words[pos+i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize turns everything but letters and digits into single spaces,
+// lowercasing if asked
+func normalize(s string, lower bool) string {
+	if lower {
+		s = strings.ToLower(s)
+	}
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
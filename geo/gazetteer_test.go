@@ -0,0 +1,111 @@
+package geo
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestGazetteerGeocode(t *testing.T) {
+	g := DefaultGazetteer()
+	tests := []struct {
+		text string
+		want string
+		ok   bool
+	}{
+		{"Chicago", "Chicago", true},
+		{"MockHall, Chicago", "Chicago", true},
+		{"jazz in chicago tonight", "Chicago", true},
+		{"Phoenix tickets", "Phoenix", true},
+		{"a show in New York City", "New York", true},
+		{"weekend in NYC", "New York", true},
+		{"something in LA", "Los Angeles", true},
+		// Aliases in capitals only match in capitals
+		{"la la land", "", false},
+		// Names are whole words
+		{"chicagoland speedway", "", false},
+		// The earliest name wins
+		{"Boston to Chicago", "Boston", true},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			loc, ok, err := g.Geocode(context.Background(), tt.text)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tt.ok || loc.City != tt.want {
+				t.Errorf("Geocode(%q) = %q, %v; want %q, %v", tt.text, loc.City, ok, tt.want, tt.ok)
+			}
+			if ok && loc.Source != SourcePrompt {
+				t.Errorf("source = %q, want %q", loc.Source, SourcePrompt)
+			}
+		})
+	}
+}
+
+func TestGazetteerGeocodeCued(t *testing.T) {
+	g := DefaultGazetteer()
+	tests := []struct {
+		text string
+		want string
+		ok   bool
+	}{
+		{"jazz in Chicago this weekend", "Chicago", true},
+		{"restaurants near Boston", "Boston", true},
+		{"hotels around San Francisco", "San Francisco", true},
+		{"In NYC tonight", "New York", true},
+		{"Nashville hot chicken in Boston", "Boston", true},
+		{"shows around downtown Seattle", "Seattle", true},
+		{"comedy in downtown Chicago", "Chicago", true},
+		{"hotels in the greater Boston area", "Boston", true},
+		{"Phoenix tickets", "", false},
+		{"Paris Hilton concert", "", false},
+		{"Chicago concerts", "", false},
+		{"in the mood for Chicago", "", false},
+		{"in downtown bars Chicago style pizza", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			loc, ok, err := g.GeocodeCued(context.Background(), tt.text)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tt.ok || loc.City != tt.want {
+				t.Errorf("GeocodeCued(%q) = %q, %v; want %q, %v", tt.text, loc.City, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseGazetteer(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		wantErr bool
+	}{
+		{name: "valid", csv: "# comment\nSpringfield,Spfld|SPR,IL,US,39.78,-89.65\n"},
+		{name: "missing field", csv: "Springfield,,IL,US,39.78\n", wantErr: true},
+		{name: "invalid latitude", csv: "Springfield,,IL,US,north,-89.65\n", wantErr: true},
+		{name: "off the globe", csv: "Springfield,,IL,US,99,-89.65\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := ParseGazetteer(strings.NewReader(tt.csv))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for _, text := range []string{"in springfield", "in spfld", "in SPR"} {
+				if loc, ok, _ := g.Geocode(context.Background(), text); !ok || loc.City != "Springfield" || loc.State != "IL" {
+					t.Errorf("Geocode(%q) = %+v, %v; want Springfield", text, loc, ok)
+				}
+			}
+			if _, ok, _ := g.Geocode(context.Background(), "spr"); ok {
+				t.Error("capitalised alias matched in lower case")
+			}
+		})
+	}
+}
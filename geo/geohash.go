@@ -0,0 +1,40 @@
+package geo
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// GeohashPrecision is the geohash length sent as Ticketmaster's geoPoint.
+// Nine characters is a cell of a few metres, well inside any search radius.
+const GeohashPrecision = 9
+
+// Geohash encodes a coordinate as a geohash of the given length
+func Geohash(lat, lon float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+
+	hash := make([]byte, 0, precision)
+	var bits, ch int
+	even := true
+	for len(hash) < precision {
+		// Bits alternate between longitude and latitude, longitude first
+		r, v := &latRange, lat
+		if even {
+			r, v = &lonRange, lon
+		}
+		mid := (r[0] + r[1]) / 2
+		ch <<= 1
+		if v >= mid {
+			ch |= 1
+			r[0] = mid
+		} else {
+			r[1] = mid
+		}
+		even = !even
+
+		bits++
+		if bits == 5 {
+			hash = append(hash, base32[ch])
+			bits, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
@@ -0,0 +1,25 @@
+package geo
+
+import "testing"
+
+func TestGeohash(t *testing.T) {
+	tests := []struct {
+		lat, lon  float64
+		precision int
+		want      string
+	}{
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{41.8781, -87.6298, 9, "dp3wjztvt"},
+		{48.8566, 2.3522, 6, "u09tvw"},
+		{-33.8688, 151.2093, 5, "r3gx2"},
+		{0, 0, 4, "s000"},
+		{-90, -180, 3, "000"},
+		{90, 180, 3, "zzz"},
+		{41.8781, -87.6298, 0, ""},
+	}
+	for _, tt := range tests {
+		if got := Geohash(tt.lat, tt.lon, tt.precision); got != tt.want {
+			t.Errorf("Geohash(%v, %v, %d) = %q, want %q", tt.lat, tt.lon, tt.precision, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package geo
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+)
+
+// IPLocator finds roughly where an IP address is
+type IPLocator interface {
+	// Locate returns the location of ip; ok is false if it is unknown
+	Locate(ctx context.Context, ip net.IP) (loc Location, ok bool, err error)
+}
+
+// IPTable is an offline IPLocator over a list of networks
+type IPTable struct {
+	entries []ipEntry
+}
+
+type ipEntry struct {
+	network *net.IPNet
+	loc     Location
+}
+
+// LoadIPTable reads CSV rows of CIDR, city, state, country, latitude and
+// longitude. Lines starting with # are comments. The most specific network
+// containing an address wins.
+func LoadIPTable(path string) (*IPTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cr := csv.NewReader(f)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 6
+
+	t := &IPTable{}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, network, err := net.ParseCIDR(row[0])
+		if err != nil {
+			return nil, err
+		}
+		lat, err := strconv.ParseFloat(row[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid latitude: %v", row[0], err)
+		}
+		lon, err := strconv.ParseFloat(row[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid longitude: %v", row[0], err)
+		}
+		if err := (Coordinates{Lat: lat, Lon: lon}).Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %v", row[0], err)
+		}
+		t.entries = append(t.entries, ipEntry{
+			network: network,
+			loc:     Location{Lat: lat, Lon: lon, City: row[1], State: row[2], Country: row[3], Source: SourceIP},
+		})
+	}
+	return t, nil
+}
+
+func (t *IPTable) Locate(ctx context.Context, ip net.IP) (Location, bool, error) {
+	best, bestBits := -1, -1
+	for i, e := range t.entries {
+		if !e.network.Contains(ip) {
+			continue
+		}
+		if bits, _ := e.network.Mask.Size(); bits > bestBits {
+			best, bestBits = i, bits
+		}
+	}
+	if best < 0 {
+		return Location{}, false, nil
+	}
+	return t.entries[best].loc, true, nil
+}
@@ -0,0 +1,132 @@
+// Package geo works out where a prompt is about: a place named in the prompt,
+// coordinates the client sent, or the location of the client's IP address.
+// The resolved location travels in the request context so every factory
+// searches the same area.
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Source says how a location was resolved
+type Source string
+
+const (
+	// SourcePrompt is a place named in the prompt, found by the geocoder
+	SourcePrompt Source = "prompt"
+	// SourceClient is coordinates the client sent with the request
+	SourceClient Source = "client"
+	// SourceIP is the location of the client's IP address
+	SourceIP Source = "ip"
+)
+
+// Location is a resolved place
+type Location struct {
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	City    string  `json:"city,omitempty"`
+	State   string  `json:"state,omitempty"`
+	Country string  `json:"country,omitempty"`
+	Source  Source  `json:"source"`
+}
+
+// Geohash returns the location's geohash at GeohashPrecision
+func (l Location) Geohash() string {
+	return Geohash(l.Lat, l.Lon, GeohashPrecision)
+}
+
+// Coordinates are a latitude and longitude sent by the client
+type Coordinates struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// ErrInvalidCoordinates is returned for coordinates off the globe
+var ErrInvalidCoordinates = errors.New("invalid coordinates")
+
+// Validate checks the coordinates are on the globe
+func (c Coordinates) Validate() error {
+	if math.IsNaN(c.Lat) || math.IsNaN(c.Lon) || c.Lat < -90 || c.Lat > 90 || c.Lon < -180 || c.Lon > 180 {
+		return ErrInvalidCoordinates
+	}
+	return nil
+}
+
+// PositionHeader carries the client's coordinates as "lat,lon"
+const PositionHeader = "X-Geo-Position"
+
+// ParseCoordinates parses "lat,lon"
+func ParseCoordinates(s string) (Coordinates, error) {
+	latStr, lonStr, ok := strings.Cut(s, ",")
+	if !ok {
+		return Coordinates{}, ErrInvalidCoordinates
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil {
+		return Coordinates{}, fmt.Errorf("%w: %v", ErrInvalidCoordinates, err)
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err != nil {
+		return Coordinates{}, fmt.Errorf("%w: %v", ErrInvalidCoordinates, err)
+	}
+	c := Coordinates{Lat: lat, Lon: lon}
+	return c, c.Validate()
+}
+
+// Hint is what the request says about where the client is
+type Hint struct {
+	Coordinates *Coordinates
+	IP          net.IP
+}
+
+type hintKey struct{}
+type locationKey struct{}
+
+// WithHint returns a context carrying hint
+func WithHint(ctx context.Context, hint Hint) context.Context {
+	return context.WithValue(ctx, hintKey{}, hint)
+}
+
+// HintFromContext returns the hint attached to ctx, if any
+func HintFromContext(ctx context.Context) Hint {
+	hint, _ := ctx.Value(hintKey{}).(Hint)
+	return hint
+}
+
+// NewContext returns a context carrying the resolved location
+func NewContext(ctx context.Context, loc *Location) context.Context {
+	return context.WithValue(ctx, locationKey{}, loc)
+}
+
+// FromContext returns the location resolved for the prompt, or nil if none
+// could be
+func FromContext(ctx context.Context) *Location {
+	loc, _ := ctx.Value(locationKey{}).(*Location)
+	return loc
+}
+
+// Middleware attaches a Hint to each request: the coordinates in the
+// X-Geo-Position header, if valid, and the client's IP address
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var hint Hint
+		if v := r.Header.Get(PositionHeader); v != "" {
+			if c, err := ParseCoordinates(v); err == nil {
+				hint.Coordinates = &c
+			}
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		hint.IP = net.ParseIP(host)
+		next.ServeHTTP(w, r.WithContext(WithHint(r.Context(), hint)))
+	})
+}
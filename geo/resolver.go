@@ -0,0 +1,94 @@
+package geo
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go-backend/logging"
+)
+
+// Resolver works out the location a prompt is about. A place the prompt
+// names wins over the client's coordinates, which win over its IP address.
+type Resolver struct {
+	// Geocoder finds places named in prompts; nil disables it
+	Geocoder Geocoder
+	// IPs locates client addresses; nil disables it
+	IPs IPLocator
+}
+
+// CuedGeocoder is a Geocoder that can insist on a cue like "in" or "near"
+// before a place. The resolver prefers it for prompts, where a bare name is
+// often not a place to search.
+type CuedGeocoder interface {
+	GeocodeCued(ctx context.Context, text string) (loc Location, ok bool, err error)
+}
+
+// ResolverFromEnv builds a resolver from GEOCODER ("gazetteer", the default,
+// or "none"), GAZETTEER_FILE to replace the built-in list of places, and
+// GEOIP_FILE, a table of networks to locate client addresses with
+func ResolverFromEnv() (*Resolver, error) {
+	r := &Resolver{}
+
+	switch geocoder := os.Getenv("GEOCODER"); geocoder {
+	case "", "gazetteer":
+		if path := os.Getenv("GAZETTEER_FILE"); path != "" {
+			g, err := LoadGazetteer(path)
+			if err != nil {
+				return nil, fmt.Errorf("error loading gazetteer: %v", err)
+			}
+			r.Geocoder = g
+		} else {
+			r.Geocoder = DefaultGazetteer()
+		}
+	case "none":
+	default:
+		return nil, fmt.Errorf("unknown geocoder %q", geocoder)
+	}
+
+	if path := os.Getenv("GEOIP_FILE"); path != "" {
+		t, err := LoadIPTable(path)
+		if err != nil {
+			return nil, fmt.Errorf("error loading IP table: %v", err)
+		}
+		r.IPs = t
+	}
+	return r, nil
+}
+
+// Resolve returns the location for prompt given what the request says about
+// the client, or nil if there is none. Lookup errors are logged and skipped:
+// a prompt without a location still gets an answer.
+func (r *Resolver) Resolve(ctx context.Context, prompt string, hint Hint) *Location {
+	if r == nil {
+		return nil
+	}
+	logger := logging.FromContext(ctx)
+
+	if r.Geocoder != nil {
+		geocode := r.Geocoder.Geocode
+		if cued, ok := r.Geocoder.(CuedGeocoder); ok {
+			geocode = cued.GeocodeCued
+		}
+		loc, ok, err := geocode(ctx, prompt)
+		if err != nil {
+			logger.WarnContext(ctx, "Error geocoding prompt", "error", err)
+		} else if ok {
+			return &loc
+		}
+	}
+
+	if c := hint.Coordinates; c != nil && c.Validate() == nil {
+		return &Location{Lat: c.Lat, Lon: c.Lon, Source: SourceClient}
+	}
+
+	if r.IPs != nil && hint.IP != nil && hint.IP.IsGlobalUnicast() && !hint.IP.IsPrivate() {
+		loc, ok, err := r.IPs.Locate(ctx, hint.IP)
+		if err != nil {
+			logger.WarnContext(ctx, "Error locating client address", "error", err)
+		} else if ok {
+			return &loc
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geoip.csv")
+	table := "# cidr,city,state,country,lat,lon\n8.8.0.0/16,Mountain View,CA,US,37.386,-122.0838\n8.8.8.0/24,Denver,CO,US,39.7392,-104.9903\n"
+	if err := os.WriteFile(path, []byte(table), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ips, err := LoadIPTable(path)
+	if err != nil {
+		t.Fatalf("LoadIPTable: %v", err)
+	}
+	r := &Resolver{Geocoder: DefaultGazetteer(), IPs: ips}
+
+	client := &Coordinates{Lat: 40.1, Lon: -75.2}
+	tests := []struct {
+		name       string
+		prompt     string
+		hint       Hint
+		wantCity   string
+		wantSource Source
+	}{
+		{name: "place in the prompt", prompt: "jazz in Chicago", hint: Hint{Coordinates: client, IP: net.ParseIP("8.8.8.8")}, wantCity: "Chicago", wantSource: SourcePrompt},
+		{name: "bare name is not a place", prompt: "Phoenix tickets", hint: Hint{Coordinates: client}, wantSource: SourceClient},
+		{name: "client coordinates", prompt: "jazz near me", hint: Hint{Coordinates: client, IP: net.ParseIP("8.8.8.8")}, wantSource: SourceClient},
+		{name: "invalid coordinates fall through", prompt: "jazz", hint: Hint{Coordinates: &Coordinates{Lat: 91}, IP: net.ParseIP("8.8.8.8")}, wantCity: "Denver", wantSource: SourceIP},
+		{name: "most specific network", prompt: "jazz", hint: Hint{IP: net.ParseIP("8.8.8.8")}, wantCity: "Denver", wantSource: SourceIP},
+		{name: "wider network", prompt: "jazz", hint: Hint{IP: net.ParseIP("8.8.4.4")}, wantCity: "Mountain View", wantSource: SourceIP},
+		{name: "private address", prompt: "jazz", hint: Hint{IP: net.ParseIP("10.0.0.1")}},
+		{name: "unknown address", prompt: "jazz", hint: Hint{IP: net.ParseIP("1.1.1.1")}},
+		{name: "nothing", prompt: "jazz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := r.Resolve(context.Background(), tt.prompt, tt.hint)
+			if tt.wantSource == "" {
+				if loc != nil {
+					t.Fatalf("Resolve = %+v, want nil", loc)
+				}
+				return
+			}
+			if loc == nil {
+				t.Fatalf("Resolve = nil, want %s location", tt.wantSource)
+			}
+			if loc.Source != tt.wantSource || loc.City != tt.wantCity {
+				t.Errorf("Resolve = %q from %q, want %q from %q", loc.City, loc.Source, tt.wantCity, tt.wantSource)
+			}
+		})
+	}
+
+	var none *Resolver
+	if loc := none.Resolve(context.Background(), "jazz in Chicago", Hint{}); loc != nil {
+		t.Errorf("nil resolver resolved %+v", loc)
+	}
+}
+
+func TestParseCoordinates(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Coordinates
+		wantErr bool
+	}{
+		{in: "41.8781,-87.6298", want: Coordinates{Lat: 41.8781, Lon: -87.6298}},
+		{in: " 41.8781 , -87.6298 ", want: Coordinates{Lat: 41.8781, Lon: -87.6298}},
+		{in: "-90,180", want: Coordinates{Lat: -90, Lon: 180}},
+		{in: "41.8781", wantErr: true},
+		{in: "north,west", wantErr: true},
+		{in: "91,0", wantErr: true},
+		{in: "0,-181", wantErr: true},
+		{in: "NaN,0", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCoordinates(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidCoordinates) {
+				t.Errorf("ParseCoordinates(%q) err = %v, want ErrInvalidCoordinates", tt.in, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseCoordinates(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package graphqlapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"go-backend/dedup"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// Request is the body accepted by /graphql
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Handler answers GraphQL queries POSTed as JSON. Errors in the query,
+// including going over the limits, are reported in the result's errors with
+// status 200, as GraphQL clients expect.
+type Handler struct {
+	Schema graphql.Schema
+	Limits Limits
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Query == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Repeated lookups of the same event or venue share one upstream call
+	ctx, _ := dedup.NewContext(r.Context())
+	result := h.Execute(ctx, req)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Execute parses and validates the query, checks it against the limits and
+// runs it
+func (h *Handler) Execute(ctx context.Context, req Request) *graphql.Result {
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	if validation := graphql.ValidateDocument(&h.Schema, doc, nil); !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}
+	}
+	if err := h.Limits.Check(&h.Schema, doc, req.OperationName); err != nil {
+		// Located so the error's code is reported in its extensions
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(graphql.NewLocatedError(err, nil))}
+	}
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.Schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+}
@@ -0,0 +1,175 @@
+package graphqlapi
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bound how much work one query can ask for. Zero disables a limit.
+type Limits struct {
+	// MaxDepth is how deeply fields may be nested
+	MaxDepth int
+	// MaxComplexity is the most a query may cost. Every field costs 1, the
+	// fields in FieldCosts more, and fields under a list count once for each
+	// item it is expected to hold (see ListSizes).
+	MaxComplexity int
+}
+
+// LimitsFromEnv reads the limits from GRAPHQL_MAX_DEPTH and
+// GRAPHQL_MAX_COMPLEXITY, falling back to defaults that allow one plan with
+// event and venue details for its activities
+func LimitsFromEnv() Limits {
+	return Limits{
+		MaxDepth:      envInt("GRAPHQL_MAX_DEPTH", 10),
+		MaxComplexity: envInt("GRAPHQL_MAX_COMPLEXITY", 3000),
+	}
+}
+
+// FieldCosts are the costs of fields that run the pipeline or call an
+// upstream, by type and field name
+var FieldCosts = map[string]int{
+	"Query.plan":     1000,
+	"Query.event":    20,
+	"Query.venue":    20,
+	"Activity.event": 20,
+	"Activity.venue": 20,
+}
+
+// ListSizes are how many items list fields are expected to hold, by type
+// and field name. Other lists count as DefaultListSize.
+var ListSizes = map[string]int{
+	"Query.services":    3,
+	"Plan.results":      3,
+	"Event.images":      5,
+	"Event.priceRanges": 2,
+	"Event.venues":      2,
+	"Event.attractions": 3,
+}
+
+// DefaultListSize is the expected length of lists not in ListSizes
+const DefaultListSize = 10
+
+// Check measures the operation doc runs and returns an error if it is over
+// a limit. Introspection fields are not counted. doc must have been
+// validated against schema.
+func (l Limits) Check(schema *graphql.Schema, doc *ast.Document, operationName string) error {
+	a := &analysis{limits: l, schema: schema, fragments: make(map[string]*ast.FragmentDefinition)}
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch d := def.(type) {
+		case *ast.FragmentDefinition:
+			a.fragments[d.Name.Value] = d
+		case *ast.OperationDefinition:
+			if operationName == "" || (d.Name != nil && d.Name.Value == operationName) {
+				op = d
+			}
+		}
+	}
+	if op == nil {
+		// Execution reports the missing operation
+		return nil
+	}
+
+	a.walk(op.SelectionSet, schema.QueryType(), 1, 1)
+	if a.tooDeep {
+		return &queryError{msg: fmt.Sprintf("Query is nested deeper than the limit of %d levels", l.MaxDepth), code: codeTooDeep}
+	}
+	if a.tooComplex {
+		return &queryError{msg: fmt.Sprintf("Query costs more than the limit of %d", l.MaxComplexity), code: codeTooComplex}
+	}
+	return nil
+}
+
+// analysis walks an operation's selections, stopping as soon as a limit is
+// crossed so fragment spreads cannot make it walk forever
+type analysis struct {
+	limits    Limits
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+
+	cost       int
+	tooDeep    bool
+	tooComplex bool
+}
+
+// walk adds the cost of set, whose fields belong to parent and sit at depth,
+// each counted multiplier times
+func (a *analysis) walk(set *ast.SelectionSet, parent graphql.Type, depth, multiplier int) {
+	if set == nil {
+		return
+	}
+	for _, sel := range set.Selections {
+		if a.tooDeep || a.tooComplex {
+			return
+		}
+		switch s := sel.(type) {
+		case *ast.Field:
+			obj, ok := parent.(*graphql.Object)
+			if !ok || strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+			def, ok := obj.Fields()[s.Name.Value]
+			if !ok {
+				continue
+			}
+			if a.limits.MaxDepth > 0 && depth > a.limits.MaxDepth {
+				a.tooDeep = true
+				return
+			}
+
+			key := obj.Name() + "." + s.Name.Value
+			cost, ok := FieldCosts[key]
+			if !ok {
+				cost = 1
+			}
+			a.cost += cost * multiplier
+			if a.limits.MaxComplexity > 0 && a.cost > a.limits.MaxComplexity {
+				a.tooComplex = true
+				return
+			}
+
+			children := multiplier
+			if isList(def.Type) {
+				size, ok := ListSizes[key]
+				if !ok {
+					size = DefaultListSize
+				}
+				children *= size
+			}
+			named, _ := graphql.GetNamed(def.Type).(graphql.Type)
+			a.walk(s.SelectionSet, named, depth+1, children)
+		case *ast.InlineFragment:
+			typ := parent
+			if s.TypeCondition != nil {
+				typ = a.schema.Type(s.TypeCondition.Name.Value)
+			}
+			a.walk(s.SelectionSet, typ, depth, multiplier)
+		case *ast.FragmentSpread:
+			if frag, ok := a.fragments[s.Name.Value]; ok {
+				a.walk(frag.SelectionSet, a.schema.Type(frag.TypeCondition.Name.Value), depth, multiplier)
+			}
+		}
+	}
+}
+
+// isList reports whether typ, under any non-null wrapper, is a list
+func isList(typ graphql.Type) bool {
+	if nonNull, ok := typ.(*graphql.NonNull); ok {
+		typ = nonNull.OfType
+	}
+	_, ok := typ.(*graphql.List)
+	return ok
+}
+
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,236 @@
+package graphqlapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-backend/budget"
+	"go-backend/factories"
+	"go-backend/geo"
+	"go-backend/guard"
+	"go-backend/ranking"
+	"go-backend/ratelimit"
+	"go-backend/usage"
+
+	"github.com/graphql-go/graphql"
+)
+
+// LookupService is the service whose product looks up events and venues
+const LookupService = "Ticketing"
+
+// resolver answers the schema's queries with a ServiceDirector
+type resolver struct {
+	director *factories.ServiceDirector
+}
+
+// plan runs the prompt through the pipeline. The result is decoded from the
+// JSON /promptOpenAI would answer, so every field resolves from the same
+// keys as in REST responses.
+func (r *resolver) plan(p graphql.ResolveParams) (interface{}, error) {
+	req := planRequest(p.Args)
+	ctx, err := req.WithOptions(p.Context)
+	var invalid *factories.InvalidOptionError
+	if errors.As(err, &invalid) {
+		return nil, &queryError{msg: "Invalid " + invalid.Option, code: codeBadInput}
+	}
+	ctx, ledger := usage.NewContext(ctx)
+
+	responses, err := r.director.Run(ctx, req.Prompt)
+	if err != nil {
+		return nil, runError(err)
+	}
+
+	plan := map[string]interface{}{"results": []interface{}{}}
+	for _, response := range responses {
+		decoded, err := decode(response)
+		if err != nil {
+			return nil, err
+		}
+		if response.Service == budget.ServiceName {
+			plan["budget"] = lookup(decoded, "data")
+			continue
+		}
+		plan["results"] = append(plan["results"].([]interface{}), decoded)
+	}
+	if plan["usage"], err = decode(ledger.Summary()); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (r *resolver) services(p graphql.ResolveParams) (interface{}, error) {
+	var services []interface{}
+	for _, name := range guard.ValidServices {
+		_, available := r.director.Factories[name]
+		services = append(services, map[string]interface{}{"name": name, "available": available})
+	}
+	return services, nil
+}
+
+// lookupArg resolves a Discovery resource by the field's id argument
+func (r *resolver) lookupArg(resource string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		id, _ := p.Args["id"].(string)
+		return r.fetch(p.Context, resource, id)
+	}
+}
+
+// lookupField resolves a Discovery resource by an id its source object holds
+func (r *resolver) lookupField(resource, key string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		id, _ := lookup(p.Source, key).(string)
+		if id == "" {
+			return nil, nil
+		}
+		return r.fetch(p.Context, resource, id)
+	}
+}
+
+// fetch looks up a Discovery event or venue with the Ticketing product. The
+// request's dedup group makes repeated lookups of an id share one call.
+// Unknown ids resolve to null.
+func (r *resolver) fetch(ctx context.Context, resource, id string) (interface{}, error) {
+	if !guard.ValidTicketmasterID.MatchString(id) {
+		return nil, &queryError{msg: "Invalid id", code: codeBadInput}
+	}
+	factory, ok := r.director.Factories[LookupService]
+	if !ok {
+		return nil, &queryError{msg: LookupService + " is not available", code: codeUnavailable}
+	}
+	ctx = usage.WithService(ctx, LookupService)
+	raw, err := factory.CreateProduct().PerformAction(ctx, map[string]string{"action": resource + "/" + id})
+	if errors.Is(err, ratelimit.ErrQuotaExceeded) {
+		return nil, runError(err)
+	}
+	if err != nil {
+		r.director.Logger.WarnContext(ctx, "Error looking up Ticketmaster "+resource, "id", id, "error", err)
+		return nil, &queryError{msg: "Failed to look up " + resource + "/" + id, code: codeUnavailable}
+	}
+	if found, _ := raw["id"].(string); found == "" {
+		return nil, nil
+	}
+	return raw, nil
+}
+
+// planRequest converts the plan arguments to the body /promptOpenAI takes
+func planRequest(args map[string]interface{}) factories.PromptRequest {
+	req := factories.PromptRequest{}
+	req.Prompt, _ = args["prompt"].(string)
+	opts, _ := args["options"].(map[string]interface{})
+
+	if loc, ok := opts["location"].(map[string]interface{}); ok {
+		lat, _ := loc["lat"].(float64)
+		lon, _ := loc["lon"].(float64)
+		req.Location = &geo.Coordinates{Lat: lat, Lon: lon}
+	}
+	req.Timezone, _ = opts["timezone"].(string)
+	req.Sort, _ = opts["sort"].(string)
+	if prefs, ok := opts["preferences"].(map[string]interface{}); ok {
+		req.Preferences = &ranking.Preferences{Like: stringList(prefs["like"]), Avoid: stringList(prefs["avoid"])}
+	}
+	if maxPrice, ok := opts["maxPrice"].(float64); ok {
+		req.MaxPrice = &maxPrice
+	}
+	req.OnSaleNow, _ = opts["onSaleNow"].(bool)
+	if b, ok := opts["budget"].(map[string]interface{}); ok {
+		// Decoded like a JSON body, so the currency is normalized the same
+		// way; a budget that does not decode stays zero and is rejected
+		data, _ := json.Marshal(b)
+		var decoded budget.Budget
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			decoded = budget.Budget{}
+		}
+		req.Budget = &decoded
+	}
+	req.Locale, _ = opts["locale"].(string)
+	return req
+}
+
+// Error codes reported in the extensions of query errors
+const (
+	codeBadInput    = "BAD_USER_INPUT"
+	codeNotFound    = "NOT_FOUND"
+	codeRateLimited = "RATE_LIMITED"
+	codeUnavailable = "UNAVAILABLE"
+	codeInternal    = "INTERNAL"
+	codeTooDeep     = "QUERY_TOO_DEEP"
+	codeTooComplex  = "QUERY_TOO_COMPLEX"
+)
+
+// queryError is an error in a query's result with a machine-readable code
+type queryError struct {
+	msg  string
+	code string
+}
+
+func (e *queryError) Error() string {
+	return e.msg
+}
+
+// Extensions implements gqlerrors.ExtendedError
+func (e *queryError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+// runError maps an error from the ServiceDirector or a product to what the
+// client is told, with the same messages as the REST API
+func runError(err error) error {
+	status, msg := factories.RunErrorStatus(err)
+	switch status {
+	case http.StatusBadRequest:
+		return &queryError{msg: msg, code: codeBadInput}
+	case http.StatusNotFound:
+		return &queryError{msg: msg, code: codeNotFound}
+	case http.StatusTooManyRequests:
+		return &queryError{msg: msg, code: codeRateLimited}
+	case http.StatusServiceUnavailable:
+		return &queryError{msg: msg, code: codeUnavailable}
+	default:
+		return &queryError{msg: msg, code: codeInternal}
+	}
+}
+
+// decode converts v to generic JSON values through its JSON encoding
+func decode(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
+
+// lookup walks decoded JSON and returns the value at path, or nil. Numeric
+// path elements index into arrays.
+func lookup(v interface{}, path ...string) interface{} {
+	for _, key := range path {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+func stringList(v interface{}) []string {
+	items, _ := v.([]interface{})
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,351 @@
+// Package graphqlapi serves plans, services and Ticketmaster events and
+// venues as a GraphQL schema, so clients fetch only the fields they need and
+// combine a prompt with detail lookups in one request. Prompts go through the
+// ServiceDirector's pipeline and lookups through the Ticketing factory's
+// product; queries are held to depth and complexity limits (see Limits).
+package graphqlapi
+
+import (
+	"strconv"
+
+	"go-backend/factories"
+
+	"github.com/graphql-go/graphql"
+)
+
+// NewSchema builds the schema, resolved with sd
+func NewSchema(sd *factories.ServiceDirector) (graphql.Schema, error) {
+	r := &resolver{director: sd}
+
+	venueType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Venue",
+		Description: "A Ticketmaster venue",
+		Fields: graphql.Fields{
+			"id":         field(graphql.NewNonNull(graphql.ID), "", "id"),
+			"name":       field(graphql.String, "", "name"),
+			"url":        field(graphql.String, "", "url"),
+			"address":    field(graphql.String, "The street address", "address", "line1"),
+			"city":       field(graphql.String, "", "city", "name"),
+			"state":      field(graphql.String, "The state or province code", "state", "stateCode"),
+			"country":    field(graphql.String, "The ISO 3166 country code", "country", "countryCode"),
+			"postalCode": field(graphql.String, "", "postalCode"),
+			"timezone":   field(graphql.String, "The venue's IANA timezone", "timezone"),
+			"latitude":   coordinate("latitude"),
+			"longitude":  coordinate("longitude"),
+		},
+	})
+
+	imageType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Image",
+		Fields: graphql.Fields{
+			"url":    field(graphql.NewNonNull(graphql.String), "", "url"),
+			"ratio":  field(graphql.String, "The aspect ratio, e.g. 16_9", "ratio"),
+			"width":  field(graphql.Int, "", "width"),
+			"height": field(graphql.Int, "", "height"),
+		},
+	})
+
+	priceRangeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PriceRange",
+		Fields: graphql.Fields{
+			"type":     field(graphql.String, "", "type"),
+			"currency": field(graphql.String, "", "currency"),
+			"min":      field(graphql.Float, "", "min"),
+			"max":      field(graphql.Float, "", "max"),
+		},
+	})
+
+	attractionType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Attraction",
+		Description: "A performer, team or show appearing at an event",
+		Fields: graphql.Fields{
+			"id":   field(graphql.NewNonNull(graphql.ID), "", "id"),
+			"name": field(graphql.String, "", "name"),
+			"url":  field(graphql.String, "", "url"),
+		},
+	})
+
+	eventType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Event",
+		Description: "A Ticketmaster event",
+		Fields: graphql.Fields{
+			"id":          field(graphql.NewNonNull(graphql.ID), "", "id"),
+			"name":        field(graphql.String, "", "name"),
+			"url":         field(graphql.String, "Where to buy tickets", "url"),
+			"info":        field(graphql.String, "", "info"),
+			"date":        field(graphql.String, "The local start date, as YYYY-MM-DD", "dates", "start", "localDate"),
+			"time":        field(graphql.String, "The local start time, as HH:MM:SS", "dates", "start", "localTime"),
+			"dateTime":    field(graphql.String, "The start, in RFC 3339", "dates", "start", "dateTime"),
+			"status":      field(graphql.String, "The Discovery status code, e.g. onsale or cancelled", "dates", "status", "code"),
+			"onsaleStart": field(graphql.String, "When public ticket sales start, in RFC 3339", "sales", "public", "startDateTime"),
+			"onsaleEnd":   field(graphql.String, "When public ticket sales end, in RFC 3339", "sales", "public", "endDateTime"),
+			"segment":     field(graphql.String, "The top-level classification, e.g. Music", "classifications", "0", "segment", "name"),
+			"genre":       field(graphql.String, "", "classifications", "0", "genre", "name"),
+			"images":      list(imageType, "", "images"),
+			"priceRanges": list(priceRangeType, "", "priceRanges"),
+			"venues":      list(venueType, "", "_embedded", "venues"),
+			"attractions": list(attractionType, "", "_embedded", "attractions"),
+		},
+	})
+
+	occurrenceType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Occurrence",
+		Description: "A date of an event that runs more than once",
+		Fields: graphql.Fields{
+			"date": field(graphql.String, "", "date"),
+			"time": field(graphql.String, "", "time"),
+			"link": field(graphql.String, "", "link"),
+		},
+	})
+
+	costType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Cost",
+		Description: "An estimated cost for one person",
+		Fields: graphql.Fields{
+			"low":      field(graphql.NewNonNull(graphql.Float), "", "low"),
+			"high":     field(graphql.NewNonNull(graphql.Float), "", "high"),
+			"currency": field(graphql.NewNonNull(graphql.String), "", "currency"),
+		},
+	})
+
+	activityType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Activity",
+		Description: "A formatted activity. Fields the formatter had no data for are null.",
+		Fields: graphql.Fields{
+			"name":          field(graphql.String, "", "activity_name"),
+			"image":         field(graphql.String, "", "image"),
+			"date":          field(graphql.String, "", "date"),
+			"time":          field(graphql.String, "", "time"),
+			"location":      field(graphql.String, "", "location"),
+			"details":       field(graphql.String, "", "details"),
+			"link":          field(graphql.String, "", "link"),
+			"priceMin":      field(graphql.Float, "", "price_min"),
+			"priceMax":      field(graphql.Float, "", "price_max"),
+			"currency":      field(graphql.String, "", "currency"),
+			"status":        field(graphql.String, "onsale, offsale, cancelled, rescheduled or postponed", "status"),
+			"onsaleStart":   field(graphql.String, "When public ticket sales start, in RFC 3339", "onsale_start"),
+			"onsaleEnd":     field(graphql.String, "When public ticket sales end, in RFC 3339", "onsale_end"),
+			"priceLevel":    field(graphql.Int, "From 1 (cheap) to 4 (expensive), for restaurants", "price_level"),
+			"nightlyRate":   field(graphql.Float, "", "nightly_rate"),
+			"nights":        field(graphql.Int, "", "nights"),
+			"dates":         list(occurrenceType, "Every date of an event that runs more than once", "dates"),
+			"score":         field(graphql.Float, "How well the activity matches the prompt, from 0 to 1", "score"),
+			"distanceKm":    field(graphql.Float, "Distance from the prompt's location", "distance_km"),
+			"estimatedCost": field(costType, "", "estimated_cost"),
+			"eventId":       field(graphql.ID, "The Ticketmaster event the activity was formatted from", "event_id"),
+			"venueId":       field(graphql.ID, "The Ticketmaster venue of that event", "venue_id"),
+			"event": {
+				Type:        eventType,
+				Description: "The Ticketmaster event's details, looked up by eventId",
+				Resolve:     r.lookupField("events", "event_id"),
+			},
+			"venue": {
+				Type:        venueType,
+				Description: "The Ticketmaster venue's details, looked up by venueId",
+				Resolve:     r.lookupField("venues", "venue_id"),
+			},
+		},
+	})
+
+	usageType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Usage",
+		Description: "LLM usage and its estimated cost",
+		Fields: graphql.Fields{
+			"calls":            field(graphql.NewNonNull(graphql.Int), "", "calls"),
+			"promptTokens":     field(graphql.NewNonNull(graphql.Int), "", "prompt_tokens"),
+			"completionTokens": field(graphql.NewNonNull(graphql.Int), "", "completion_tokens"),
+			"totalTokens":      field(graphql.NewNonNull(graphql.Int), "", "total_tokens"),
+			"costUsd":          field(graphql.NewNonNull(graphql.Float), "", "cost_usd"),
+			"sharedCalls":      field(graphql.Int, "Calls answered by an identical call made for another prompt", "shared_calls"),
+		},
+	})
+
+	serviceResultType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "ServiceResult",
+		Description: "A service's answer to a prompt",
+		Fields: graphql.Fields{
+			"service":    field(graphql.NewNonNull(graphql.String), "", "service"),
+			"activities": list(activityType, "Empty if the service was skipped or failed", "data"),
+			"error":      field(graphql.String, "Why the service has no activities; empty on success", "error"),
+			"usage":      field(usageType, "", "usage"),
+			"prompts":    list(graphql.String, "The prompt templates used, as id@version", "prompts"),
+		},
+	})
+
+	budgetType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Budget",
+		Fields: graphql.Fields{
+			"amount":   field(graphql.NewNonNull(graphql.Float), "", "amount"),
+			"currency": field(graphql.NewNonNull(graphql.String), "", "currency"),
+			"expr":     field(graphql.String, "The part of the prompt the budget was read from, if any", "expr"),
+		},
+	})
+
+	bundleItemType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "BundleItem",
+		Fields: graphql.Fields{
+			"service":  field(graphql.NewNonNull(graphql.String), "", "service"),
+			"activity": field(graphql.NewNonNull(activityType), "", "activity"),
+		},
+	})
+
+	bundleType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Bundle",
+		Description: "A set of at most one activity per service whose total low cost is within the budget",
+		Fields: graphql.Fields{
+			"items":     list(bundleItemType, "", "items"),
+			"total":     field(graphql.NewNonNull(costType), "", "total"),
+			"remaining": field(graphql.NewNonNull(graphql.Float), "", "remaining"),
+		},
+	})
+
+	budgetPlanType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "BudgetPlan",
+		Description: "The bundles of activities that fit a budget, best first",
+		Fields: graphql.Fields{
+			"budget":  field(graphql.NewNonNull(budgetType), "", "budget"),
+			"bundles": list(bundleType, "", "bundles"),
+		},
+	})
+
+	planType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Plan",
+		Description: "The answer to a prompt",
+		Fields: graphql.Fields{
+			"results": list(serviceResultType, "One result per ranked service", "results"),
+			"budget":  field(budgetPlanType, "The bundles that fit the budget, if the options or prompt set one", "budget"),
+			"usage":   field(graphql.NewNonNull(usageType), "LLM usage of the whole prompt", "usage"),
+		},
+	})
+
+	serviceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Service",
+		Fields: graphql.Fields{
+			"name":      field(graphql.NewNonNull(graphql.String), "", "name"),
+			"available": field(graphql.NewNonNull(graphql.Boolean), "Whether prompts can be answered by the service on this server", "available"),
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"plan": {
+				Type:        graphql.NewNonNull(planType),
+				Description: "Answer a prompt with every applicable service, like POST /promptOpenAI",
+				Args: graphql.FieldConfigArgument{
+					"prompt":  {Type: graphql.NewNonNull(graphql.String)},
+					"options": {Type: planOptionsType},
+				},
+				Resolve: r.plan,
+			},
+			"services": {
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(serviceType))),
+				Description: "The services prompts can be routed to",
+				Resolve:     r.services,
+			},
+			"event": {
+				Type:        eventType,
+				Description: "A Ticketmaster event, or null if there is none with the id",
+				Args:        graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve:     r.lookupArg("events"),
+			},
+			"venue": {
+				Type:        venueType,
+				Description: "A Ticketmaster venue, or null if there is none with the id",
+				Args:        graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve:     r.lookupArg("venues"),
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// planOptionsType mirrors the options of the /promptOpenAI body
+var planOptionsType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "PlanOptions",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"location": {
+			Type: graphql.NewInputObject(graphql.InputObjectConfig{
+				Name: "CoordinatesInput",
+				Fields: graphql.InputObjectConfigFieldMap{
+					"lat": {Type: graphql.NewNonNull(graphql.Float)},
+					"lon": {Type: graphql.NewNonNull(graphql.Float)},
+				},
+			}),
+			Description: "Where the client is, for prompts like \"concerts near me\"",
+		},
+		"timezone": {Type: graphql.String, Description: "The user's IANA timezone, used to resolve dates such as \"tonight\""},
+		"sort":     {Type: graphql.String, Description: "relevance (the default), date, distance or name"},
+		"preferences": {
+			Type: graphql.NewInputObject(graphql.InputObjectConfig{
+				Name: "PreferencesInput",
+				Fields: graphql.InputObjectConfigFieldMap{
+					"like":  {Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+					"avoid": {Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+				},
+			}),
+			Description: "Terms the user wants more or less of",
+		},
+		"maxPrice":  {Type: graphql.Float, Description: "Drops activities whose cheapest ticket costs more"},
+		"onSaleNow": {Type: graphql.Boolean, Description: "Keeps only activities with tickets on sale right now"},
+		"budget": {
+			Type: graphql.NewInputObject(graphql.InputObjectConfig{
+				Name: "BudgetInput",
+				Fields: graphql.InputObjectConfigFieldMap{
+					"amount":   {Type: graphql.NewNonNull(graphql.Float)},
+					"currency": {Type: graphql.String, Description: "ISO 4217 code; USD if not given"},
+				},
+			}),
+			Description: "The most the user wants to spend in total; wins over a budget in the prompt",
+		},
+		"locale": {Type: graphql.String, Description: "Language, and optionally region, to answer in, e.g. fr-CA"},
+	},
+})
+
+// field resolves to the value at path in a decoded JSON object. Numeric
+// path elements index into arrays.
+func field(typ graphql.Output, description string, path ...string) *graphql.Field {
+	return &graphql.Field{
+		Type:        typ,
+		Description: description,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return lookup(p.Source, path...), nil
+		},
+	}
+}
+
+// list is a field holding a list of typ, empty rather than null when the
+// path has nothing
+func list(typ graphql.Output, description string, path ...string) *graphql.Field {
+	return &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(typ))),
+		Description: description,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			items, _ := lookup(p.Source, path...).([]interface{})
+			if items == nil {
+				items = []interface{}{}
+			}
+			return items, nil
+		},
+	}
+}
+
+// coordinate resolves a venue's latitude or longitude, which Discovery sends
+// as a string
+func coordinate(key string) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.Float,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			v, _ := lookup(p.Source, "location", key).(string)
+			if v == "" {
+				return nil, nil
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, nil
+			}
+			return f, nil
+		},
+	}
+}
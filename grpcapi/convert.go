@@ -0,0 +1,93 @@
+package grpcapi
+
+import (
+	"encoding/json"
+	"strings"
+
+	"go-backend/budget"
+	"go-backend/factories"
+	"go-backend/geo"
+	"go-backend/grpcapi/plannerpb"
+	"go-backend/ranking"
+	"go-backend/usage"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// promptRequest converts a request to the form /promptOpenAI decodes its
+// body into, so both are validated the same way. A nil request has no options.
+func promptRequest(req *plannerpb.PromptRequest) factories.PromptRequest {
+	if req == nil {
+		return factories.PromptRequest{}
+	}
+	out := factories.PromptRequest{
+		Prompt:    req.GetPrompt(),
+		Timezone:  req.GetTimezone(),
+		Sort:      req.GetSort(),
+		MaxPrice:  req.MaxPrice,
+		OnSaleNow: req.GetOnSaleNow(),
+		Locale:    req.GetLocale(),
+	}
+	if loc := req.GetLocation(); loc != nil {
+		out.Location = &geo.Coordinates{Lat: loc.GetLat(), Lon: loc.GetLon()}
+	}
+	if prefs := req.GetPreferences(); prefs != nil {
+		out.Preferences = &ranking.Preferences{Like: prefs.GetLike(), Avoid: prefs.GetAvoid()}
+	}
+	if b := req.GetBudget(); b != nil {
+		out.Budget = &budget.Budget{Amount: b.GetAmount(), Currency: strings.ToUpper(b.GetCurrency())}
+		if out.Budget.Currency == "" {
+			out.Budget.Currency = budget.DefaultCurrency
+		}
+	}
+	return out
+}
+
+// serviceResult converts a service's response. Activities keep the fields
+// the REST API gives them.
+func serviceResult(response factories.ServiceResponse) (*plannerpb.ServiceResult, error) {
+	result := &plannerpb.ServiceResult{
+		Service: response.Service,
+		Error:   response.Error,
+		Usage:   usageSummary(response.Usage),
+		Prompts: response.Prompts,
+	}
+	activities, _ := response.Data.([]interface{})
+	for _, activity := range activities {
+		s, err := toStruct(activity)
+		if err != nil {
+			return nil, err
+		}
+		result.Activities = append(result.Activities, s)
+	}
+	return result, nil
+}
+
+// toStruct converts v to a Struct through its JSON encoding, so it has the
+// same fields and values as in REST responses
+func toStruct(v interface{}) (*structpb.Struct, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	s := &structpb.Struct{}
+	if err := protojson.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func usageSummary(s *usage.Summary) *plannerpb.Usage {
+	if s == nil {
+		return nil
+	}
+	return &plannerpb.Usage{
+		Calls:            int32(s.Calls),
+		PromptTokens:     int32(s.PromptTokens),
+		CompletionTokens: int32(s.CompletionTokens),
+		TotalTokens:      int32(s.TotalTokens),
+		CostUsd:          s.CostUSD,
+		SharedCalls:      int32(s.SharedCalls),
+	}
+}
@@ -0,0 +1,119 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/geo"
+	"go-backend/grpcapi/plannerpb"
+	"go-backend/locale"
+	"go-backend/logging"
+	"go-backend/ratelimit"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// admission does for Planner calls what the HTTP middleware does for REST
+// requests: it tags them with a request id, counts them against the
+// client's rate limit and quotas, and attaches the client's IP address and
+// language preferences. Reflection and health calls are let through as is.
+type admission struct {
+	limiter *ratelimit.Limiter
+	quotas  *ratelimit.Quotas
+}
+
+func (a *admission) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !isPlanner(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	ctx, err := a.admit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *admission) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !isPlanner(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	ctx, err := a.admit(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+func (a *admission) admit(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	id := logging.EnsureRequestID(first(md, "x-request-id"))
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	ctx = logging.WithRequestID(ctx, id)
+
+	var remoteAddr string
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	key := first(md, "x-api-key")
+	if key == "" {
+		key = strings.TrimPrefix(first(md, "authorization"), "Bearer ")
+	}
+
+	ctx, wait, err := ratelimit.Admit(ctx, a.limiter, a.quotas, ratelimit.ClientIDFor(key, remoteAddr))
+	if err != nil {
+		setRetryAfter(ctx, wait)
+		if errors.Is(err, ratelimit.ErrQuotaExceeded) {
+			return ctx, status.Error(codes.ResourceExhausted, "Daily quota exceeded")
+		}
+		return ctx, status.Error(codes.ResourceExhausted, "Rate limit exceeded")
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ctx = geo.WithHint(ctx, geo.Hint{IP: net.ParseIP(host)})
+	if locales := locale.ParseAcceptLanguage(first(md, "accept-language")); len(locales) > 0 {
+		ctx = locale.WithAccepted(ctx, locales)
+	}
+	return ctx, nil
+}
+
+// setRetryAfter tells a client that was turned away when to try again, in
+// whole seconds like the HTTP Retry-After header
+func setRetryAfter(ctx context.Context, wait time.Duration) {
+	seconds := int(math.Max(1, math.Ceil(wait.Seconds())))
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(seconds)))
+}
+
+func isPlanner(method string) bool {
+	return strings.HasPrefix(method, "/"+plannerpb.Planner_ServiceDesc.ServiceName+"/")
+}
+
+// first returns the first value of a metadata key, or "" if it has none
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// serverStream replaces a stream's context with the admitted one
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
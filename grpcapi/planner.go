@@ -0,0 +1,176 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go-backend/budget"
+	"go-backend/factories"
+	"go-backend/grpcapi/plannerpb"
+	"go-backend/guard"
+	"go-backend/ratelimit"
+	"go-backend/usage"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// planner implements plannerpb.PlannerServer with a ServiceDirector
+type planner struct {
+	plannerpb.UnimplementedPlannerServer
+	director *factories.ServiceDirector
+}
+
+func (p *planner) ProcessPrompt(ctx context.Context, req *plannerpb.PromptRequest) (*plannerpb.PromptResponse, error) {
+	if req.GetPrompt() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Prompt is required")
+	}
+	ctx, err := withOptions(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every LLM call made for this request is recorded in the ledger
+	ctx, ledger := usage.NewContext(ctx)
+
+	responses, err := p.director.Run(ctx, req.GetPrompt())
+	if err != nil {
+		return nil, runError(ctx, err)
+	}
+
+	resp := &plannerpb.PromptResponse{}
+	for _, response := range responses {
+		if response.Service == budget.ServiceName {
+			if resp.BudgetPlan, err = toStruct(response.Data); err != nil {
+				return nil, status.Error(codes.Internal, "Failed to encode the budget plan")
+			}
+			continue
+		}
+		result, err := serviceResult(response)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "Failed to encode the activities")
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	summary := ledger.Summary()
+	resp.Usage = usageSummary(&summary)
+	return resp, nil
+}
+
+func (p *planner) StreamPrompt(req *plannerpb.PromptRequest, stream plannerpb.Planner_StreamPromptServer) error {
+	if req.GetPrompt() == "" {
+		return status.Error(codes.InvalidArgument, "Prompt is required")
+	}
+	ctx, err := withOptions(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	// Errors sending to the client are returned as they are; the rest come
+	// from the pipeline
+	var sendErr error
+	err = p.director.Stream(ctx, req.GetPrompt(), func(response factories.ServiceResponse) error {
+		msg := &plannerpb.StreamPromptResponse{}
+		if response.Service == budget.ServiceName {
+			plan, err := toStruct(response.Data)
+			if err != nil {
+				sendErr = status.Error(codes.Internal, "Failed to encode the budget plan")
+				return sendErr
+			}
+			msg.Result = &plannerpb.StreamPromptResponse_BudgetPlan{BudgetPlan: plan}
+		} else {
+			result, err := serviceResult(response)
+			if err != nil {
+				sendErr = status.Error(codes.Internal, "Failed to encode the activities")
+				return sendErr
+			}
+			msg.Result = &plannerpb.StreamPromptResponse_Service{Service: result}
+		}
+		sendErr = stream.Send(msg)
+		return sendErr
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil {
+		return runError(ctx, err)
+	}
+	return nil
+}
+
+func (p *planner) ListServices(ctx context.Context, req *plannerpb.ListServicesRequest) (*plannerpb.ListServicesResponse, error) {
+	resp := &plannerpb.ListServicesResponse{}
+	for _, name := range guard.ValidServices {
+		_, available := p.director.Factories[name]
+		resp.Services = append(resp.Services, &plannerpb.Service{Name: name, Available: available})
+	}
+	return resp, nil
+}
+
+func (p *planner) QueryService(ctx context.Context, req *plannerpb.QueryServiceRequest) (*plannerpb.ServiceResult, error) {
+	if req.GetService() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Service is required")
+	}
+	prompt, action := req.GetRequest().GetPrompt(), req.GetAction()
+	if (prompt == "") == (action == nil) {
+		return nil, status.Error(codes.InvalidArgument, "Exactly one of request.prompt and action is required")
+	}
+	if action != nil && action.GetAction() == "" {
+		return nil, status.Error(codes.InvalidArgument, "action.action is required")
+	}
+	ctx, err := withOptions(ctx, req.GetRequest())
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{"prompt": prompt}
+	if action != nil {
+		data = map[string]string{}
+		for k, v := range action.GetParameters() {
+			data[k] = v
+		}
+		data["action"] = action.GetAction()
+		delete(data, "prompt")
+	}
+
+	response, err := p.director.Query(ctx, req.GetService(), data)
+	if err != nil {
+		return nil, runError(ctx, err)
+	}
+	result, err := serviceResult(response)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to encode the activities")
+	}
+	return result, nil
+}
+
+// withOptions validates the request's options and attaches them to ctx, as
+// /promptOpenAI does for its body
+func withOptions(ctx context.Context, req *plannerpb.PromptRequest) (context.Context, error) {
+	ctx, err := promptRequest(req).WithOptions(ctx)
+	var invalid *factories.InvalidOptionError
+	if errors.As(err, &invalid) {
+		return ctx, status.Error(codes.InvalidArgument, "Invalid "+invalid.Option)
+	}
+	return ctx, err
+}
+
+// runError maps an error from the ServiceDirector to a gRPC status, with
+// the same messages as the REST API
+func runError(ctx context.Context, err error) error {
+	code, msg := factories.RunErrorStatus(err)
+	switch code {
+	case http.StatusBadRequest:
+		return status.Error(codes.InvalidArgument, msg)
+	case http.StatusNotFound:
+		return status.Error(codes.NotFound, msg)
+	case http.StatusTooManyRequests:
+		setRetryAfter(ctx, ratelimit.RetryAfter(ctx))
+		return status.Error(codes.ResourceExhausted, msg)
+	case http.StatusServiceUnavailable:
+		return status.Error(codes.Unavailable, msg)
+	default:
+		return status.Error(codes.Internal, msg)
+	}
+}
@@ -0,0 +1,5 @@
+// Package plannerpb holds the protobuf messages and gRPC stubs generated
+// from planner.proto
+package plannerpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative planner.proto
@@ -0,0 +1,118 @@
+// Package grpcapi serves the ServiceDirector over gRPC as the
+// planner.v1.Planner service (see plannerpb), on its own port next to the
+// REST API. Reflection and the standard health service are registered too.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+
+	"go-backend/factories"
+	"go-backend/grpcapi/plannerpb"
+	"go-backend/ratelimit"
+
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// ErrDisabled is returned by NewServer when GRPC_PORT turns the server off
+var ErrDisabled = errors.New("gRPC server disabled")
+
+// Config holds the gRPC server settings
+type Config struct {
+	// Addr is the address to listen on; the server is disabled when empty
+	Addr string
+}
+
+// ConfigFromEnv reads the port from GRPC_PORT, 9090 by default. Setting it
+// to "off" disables the gRPC server.
+func ConfigFromEnv() Config {
+	port := os.Getenv("GRPC_PORT")
+	switch port {
+	case "off":
+		return Config{}
+	case "":
+		port = "9090"
+	}
+	return Config{Addr: ":" + port}
+}
+
+// Server is the gRPC front end of a ServiceDirector. Planner calls are rate
+// limited and charged to the same quotas as REST requests.
+type Server struct {
+	addr   string
+	grpc   *grpc.Server
+	health *grpchealth.Server
+	logger *slog.Logger
+	errCh  chan error
+}
+
+// NewServer creates a server answering for sd, or returns ErrDisabled if
+// cfg has no address
+func NewServer(cfg Config, sd *factories.ServiceDirector, limiter *ratelimit.Limiter, quotas *ratelimit.Quotas, logger *slog.Logger) (*Server, error) {
+	if cfg.Addr == "" {
+		return nil, ErrDisabled
+	}
+
+	admission := &admission{limiter: limiter, quotas: quotas}
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(admission.unary),
+		grpc.ChainStreamInterceptor(admission.stream),
+	)
+	plannerpb.RegisterPlannerServer(srv, &planner{director: sd})
+
+	health := grpchealth.NewServer()
+	health.SetServingStatus(plannerpb.Planner_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, health)
+	reflection.Register(srv)
+
+	return &Server{
+		addr:   cfg.Addr,
+		grpc:   srv,
+		health: health,
+		logger: logger,
+		errCh:  make(chan error, 1),
+	}, nil
+}
+
+// Start listens on the configured address and serves in the background
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		s.logger.Info("gRPC server listening", "addr", s.addr)
+		s.errCh <- s.grpc.Serve(lis)
+	}()
+	return nil
+}
+
+// Shutdown reports the server as not serving, then waits for in-flight calls
+// to finish. Calls still running when ctx is done are cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpc.Stop()
+		<-stopped
+		return ctx.Err()
+	}
+	if err := <-s.errCh; err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultMaxPromptLength is the longest prompt accepted, in characters
+const DefaultMaxPromptLength = 1000
+
+var (
+	// ErrEmptyPrompt is returned for prompts with no content after normalization
+	ErrEmptyPrompt = errors.New("prompt is empty")
+	// ErrPromptTooLong is returned for prompts over the configured length limit
+	ErrPromptTooLong = errors.New("prompt is too long")
+	// ErrInjection is returned when a prompt looks like an attempt to override instructions
+	ErrInjection = errors.New("prompt rejected: it looks like an attempt to override instructions")
+)
+
+// Policy is what Check does when a prompt matches an injection pattern
+type Policy string
+
+const (
+	// PolicyBlock rejects the prompt
+	PolicyBlock Policy = "block"
+	// PolicyFlag lets the prompt through and only reports the matches
+	PolicyFlag Policy = "flag"
+)
+
+// Config holds the input checks' settings
+type Config struct {
+	MaxLength int
+	Policy    Policy
+}
+
+// ConfigFromEnv reads PROMPT_MAX_LENGTH and PROMPT_INJECTION_POLICY
+func ConfigFromEnv() Config {
+	cfg := Config{MaxLength: DefaultMaxPromptLength, Policy: PolicyBlock}
+	if n, err := strconv.Atoi(os.Getenv("PROMPT_MAX_LENGTH")); err == nil && n > 0 {
+		cfg.MaxLength = n
+	}
+	if Policy(os.Getenv("PROMPT_INJECTION_POLICY")) == PolicyFlag {
+		cfg.Policy = PolicyFlag
+	}
+	return cfg
+}
+
+// Result is the outcome of checking a prompt
+type Result struct {
+	// Prompt is the normalized prompt to send on to the LLM
+	Prompt string
+	// Matches names the injection patterns the prompt matched, if any
+	Matches []string
+}
+
+// Check normalizes a user prompt and screens it for injection attempts. The
+// error is ErrEmptyPrompt, ErrPromptTooLong or ErrInjection (only under the
+// block policy); matches are reported in the result either way. The prompt
+// is screened with its line breaks kept, so role markers are only matched at
+// the start of a line.
+func (c Config) Check(prompt string) (Result, error) {
+	normalized := Normalize(prompt)
+	result := Result{Prompt: normalized, Matches: Detect(normalizeLines(prompt))}
+
+	if normalized == "" {
+		return result, ErrEmptyPrompt
+	}
+	if n := utf8.RuneCountInString(normalized); n > c.MaxLength {
+		return result, fmt.Errorf("%w (%d characters, limit %d)", ErrPromptTooLong, n, c.MaxLength)
+	}
+	if len(result.Matches) > 0 && c.Policy == PolicyBlock {
+		return result, ErrInjection
+	}
+	return result, nil
+}
+
+// delimiterPattern matches the tags prompt templates wrap user content in, so
+// user text cannot close the block early and continue as instructions
+var delimiterPattern = regexp.MustCompile(`(?i)</?\s*(user_request|source_data)\s*>`)
+
+// StripDelimiters removes prompt delimiter tags from data that is spliced
+// into a prompt without the rest of Normalize, such as raw upstream JSON
+func StripDelimiters(s string) string {
+	return delimiterPattern.ReplaceAllString(s, "")
+}
+
+// Normalize folds compatibility characters (e.g. full-width letters) to their
+// plain forms, strips control and invisible formatting characters, removes
+// prompt delimiter tags and collapses runs of whitespace
+func Normalize(s string) string {
+	s = norm.NFKC.String(s)
+	s = delimiterPattern.ReplaceAllString(s, "")
+
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r):
+			// Zero-width and bidi override characters hide text from reviewers
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// normalizeLines normalizes each line of s on its own
+func normalizeLines(s string) string {
+	lines := strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == '\r' })
+	for i, line := range lines {
+		lines[i] = Normalize(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// injectionPatterns are common phrasings used to steer the model away from
+// its instructions or to forge its output. They are anchored to the words
+// such attempts need, like "instructions" after "ignore previous", so that
+// prompts which merely share a word with them ("ignore previous rules of
+// thumb", "restaurants for 20 people") get through.
+var injectionPatterns = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"ignore_instructions", regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override|bypass)\s+((all|any|the|your|my|these|those|of|everything|previous|prior|above|earlier|preceding|system|original|initial)\s+){1,4}(instructions?|prompts?|directives?)\b`)},
+	{"new_instructions", regexp.MustCompile(`(?i)\b(new|updated|real|actual)\s+(instructions?|system\s+prompt)\s*:`)},
+	{"role_override", regexp.MustCompile(`(?i)\b(you\s+are\s+now|from\s+now\s+on\s+you|(act\s+as|pretend\s+(to\s+be|you\s+are))\s+(an?\s+)?(ai|assistant|chatbot|model|system|unrestricted|jailbroken))\b`)},
+	{"role_marker", regexp.MustCompile(`(?im)^\s*["'` + "`" + `]?\s*(system|assistant|developer)\s*:`)},
+	{"prompt_exfiltration", regexp.MustCompile(`(?is)\b(reveal|print|show|repeat|output)\b.{0,30}\b(system\s+prompt|(your|initial|original|hidden)\s+(instructions|prompt)|(prompt|instructions)\s+above)\b`)},
+	{"forced_output", regexp.MustCompile(`(?is)\bapplicability\b\W{0,3}((to|of|is|at|as)\s*)?\d{1,3}\b|\b(return|respond\s+with|output|answer\s+with|set|rank|score|rate)\b.{0,30}\b(ticketing|accommodations|restaurants)\b\s*(:|=|to|at|as)\s*\d{2,3}\b|\b(ticketing|accommodations|restaurants)\b\s*:?\s*\d{2,3}\s*(%|percent)|\b(ignore|disregard|forget)\b.{0,40}\b(return|respond\s+with|output|answer\s+with|rank|score|rate)\b.{0,30}\b(ticketing|accommodations|restaurants)\b\s*\d{2,3}\b`)},
+	{"json_injection", regexp.MustCompile(`(?i)"\s*(service|applicability|action|parameters)\s*"\s*:`)},
+	{"quote_breakout", regexp.MustCompile(`(?i)^\s*["'` + "`" + `](\s*[}\]),]|\s+(ignore|disregard|forget|return|respond|output|system|instead)\b)`)},
+}
+
+// Detect returns the names of the injection patterns s matches
+func Detect(s string) []string {
+	var matches []string
+	for _, p := range injectionPatterns {
+		if p.pattern.MatchString(s) {
+			matches = append(matches, p.name)
+		}
+	}
+	return matches
+}
+
+// IsRejection reports whether err is one of the errors Check rejects a prompt with
+func IsRejection(err error) bool {
+	return errors.Is(err, ErrEmptyPrompt) || errors.Is(err, ErrPromptTooLong) || errors.Is(err, ErrInjection)
+}
@@ -0,0 +1,109 @@
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValidServices are the services the classifier is allowed to rank
+var ValidServices = []string{"Ticketing", "Accommodations", "Restaurants"}
+
+// ValidTicketmasterActions are the Discovery API resources the action
+// extractor may choose
+var ValidTicketmasterActions = []string{"events", "attractions", "classifications", "venues"}
+
+// ValidTicketmasterID matches Discovery ids, which become part of the
+// request path in lookups like "events/{id}"
+var ValidTicketmasterID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ErrInvalidAction is returned for an action that is neither an allowed
+// Discovery API resource nor a lookup of one by id
+var ErrInvalidAction = errors.New("invalid action")
+
+// ValidTicketmasterParams are the Discovery API query parameters the action
+// extractor may set. Anything else is dropped before the request is made.
+var ValidTicketmasterParams = []string{
+	"id", "keyword", "attractionId", "venueId", "postalCode", "latlong", "radius", "unit",
+	"source", "locale", "marketId", "startDateTime", "endDateTime", "includeTBA", "includeTBD",
+	"size", "page", "sort", "onsaleStartDateTime", "onsaleEndDateTime", "city", "countryCode",
+	"stateCode", "classificationName", "classificationId", "includeFamily", "promoterId",
+	"genreId", "subGenreId", "typeId", "subTypeId", "geoPoint", "includeSpellcheck",
+}
+
+// Ranking is one service score from the classifier
+type Ranking struct {
+	Service       string
+	Applicability string
+}
+
+// ValidateRankings keeps only rankings for known services with an integer
+// applicability between 0 and 100, and reports why the others were dropped.
+// Later duplicates of a service are dropped so a forged entry cannot
+// override the real one.
+func ValidateRankings(rankings []Ranking) ([]Ranking, []string) {
+	var valid []Ranking
+	var problems []string
+	seen := make(map[string]bool)
+
+	for _, r := range rankings {
+		service, ok := canonical(r.Service, ValidServices)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown service %q", r.Service))
+			continue
+		}
+		if seen[service] {
+			problems = append(problems, fmt.Sprintf("duplicate service %q", service))
+			continue
+		}
+		score, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(r.Applicability, "%")))
+		if err != nil || score < 0 || score > 100 {
+			problems = append(problems, fmt.Sprintf("invalid applicability %q for %s", r.Applicability, service))
+			continue
+		}
+
+		seen[service] = true
+		valid = append(valid, Ranking{Service: service, Applicability: strconv.Itoa(score)})
+	}
+	return valid, problems
+}
+
+// ValidateTicketmasterAction checks an action against the allowed resources,
+// alone or followed by an id to look up, and returns only the allowed
+// parameters, with the names of any dropped. An action that is not allowed
+// is reported as ErrInvalidAction.
+func ValidateTicketmasterAction(action string, params map[string]string) (string, map[string]string, []string, error) {
+	resource, id, lookup := strings.Cut(strings.TrimSpace(action), "/")
+	canonicalAction, ok := canonical(resource, ValidTicketmasterActions)
+	if !ok || (lookup && !ValidTicketmasterID.MatchString(id)) {
+		return "", nil, nil, fmt.Errorf("%w: %q is not one of %s, alone or followed by /id", ErrInvalidAction, action, strings.Join(ValidTicketmasterActions, ", "))
+	}
+	if lookup {
+		canonicalAction += "/" + id
+	}
+
+	allowed := make(map[string]string)
+	var dropped []string
+	for k, v := range params {
+		name, ok := canonical(k, ValidTicketmasterParams)
+		if !ok {
+			dropped = append(dropped, k)
+			continue
+		}
+		allowed[name] = v
+	}
+	return canonicalAction, allowed, dropped, nil
+}
+
+// canonical matches s case-insensitively against the allowed values
+func canonical(s string, allowed []string) (string, bool) {
+	s = strings.TrimSpace(s)
+	for _, a := range allowed {
+		if strings.EqualFold(s, a) {
+			return a, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,79 @@
+package guard
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestValidateTicketmasterAction(t *testing.T) {
+	tests := []struct {
+		name        string
+		action      string
+		params      map[string]string
+		wantAction  string
+		wantParams  map[string]string
+		wantDropped []string
+		wantErr     bool
+	}{
+		{
+			name:       "resource",
+			action:     "events",
+			params:     map[string]string{"keyword": "jazz"},
+			wantAction: "events",
+			wantParams: map[string]string{"keyword": "jazz"},
+		},
+		{
+			name:       "resource is matched case-insensitively",
+			action:     " Venues ",
+			wantAction: "venues",
+			wantParams: map[string]string{},
+		},
+		{
+			name:       "lookup by id",
+			action:     "events/vvG1IZ9pJk-f_3",
+			wantAction: "events/vvG1IZ9pJk-f_3",
+			wantParams: map[string]string{},
+		},
+		{
+			name:        "parameters that are not allowed are dropped",
+			action:      "events",
+			params:      map[string]string{"KEYWORD": "jazz", "apikey": "other", "callback": "x"},
+			wantAction:  "events",
+			wantParams:  map[string]string{"keyword": "jazz"},
+			wantDropped: []string{"apikey", "callback"},
+		},
+		{name: "unknown resource", action: "secrets", wantErr: true},
+		{name: "empty", action: "", wantErr: true},
+		{name: "path traversal", action: "events/../../admin", wantErr: true},
+		{name: "nested path", action: "events/abc/images", wantErr: true},
+		{name: "empty id", action: "venues/", wantErr: true},
+		{name: "id with query", action: "events/abc?apikey=x", wantErr: true},
+		{name: "id too long", action: "events/" + string(make([]byte, 65)), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, params, dropped, err := ValidateTicketmasterAction(tt.action, tt.params)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAction) {
+					t.Fatalf("err = %v, want ErrInvalidAction", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if action != tt.wantAction {
+				t.Errorf("action = %q, want %q", action, tt.wantAction)
+			}
+			if !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("params = %v, want %v", params, tt.wantParams)
+			}
+			sort.Strings(dropped)
+			if !reflect.DeepEqual(dropped, tt.wantDropped) {
+				t.Errorf("dropped = %v, want %v", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-backend/metrics"
+)
+
+// Check is a named readiness check; it returns nil when healthy
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of a single check in a readiness report
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the body returned by the health endpoints
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// Checker serves the liveness and readiness endpoints
+type Checker struct {
+	checks   []Check
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// NewChecker creates a checker that runs checks with a per-check timeout
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: timeout}
+}
+
+// SetDraining marks the server as shutting down so readiness fails and load
+// balancers stop sending new traffic while in-flight requests finish
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+// Liveness reports that the process is up and serving HTTP
+func (c *Checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: "ok"})
+}
+
+// Readiness runs every check and reports 503 if any of them fails
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	if c.draining.Load() {
+		writeReport(w, http.StatusServiceUnavailable, Report{Status: "draining"})
+		return
+	}
+
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), c.timeout)
+			defer cancel()
+
+			results[i] = CheckResult{Name: check.Name, Status: "ok"}
+			if err := check.Run(ctx); err != nil {
+				results[i].Status = "failed"
+				results[i].Error = err.Error()
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: "ok", Checks: results}
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Status != "ok" {
+			report.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeReport(w, status, report)
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// EnvCheck fails if any of the named environment variables is empty
+func EnvCheck(names ...string) Check {
+	return Check{
+		Name: "config",
+		Run: func(ctx context.Context) error {
+			for _, name := range names {
+				if os.Getenv(name) == "" {
+					return fmt.Errorf("%s is not set", name)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// UpstreamCheck fails if url cannot be reached. Any HTTP response counts as
+// reachable; results are cached for ttl so probes do not hammer the upstream.
+func UpstreamCheck(name, url string, ttl time.Duration) Check {
+	var (
+		mu      sync.Mutex
+		checked time.Time
+		lastErr error
+	)
+
+	return Check{
+		Name: name,
+		Run: func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if time.Since(checked) < ttl {
+				metrics.ObserveCache(metrics.CacheUpstreamCheck, true)
+				return lastErr
+			}
+			metrics.ObserveCache(metrics.CacheUpstreamCheck, false)
+
+			req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+			if err != nil {
+				return fmt.Errorf("error creating request: %v", err)
+			}
+
+			lastErr = nil
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				lastErr = fmt.Errorf("unreachable: %v", err)
+			} else {
+				resp.Body.Close()
+			}
+			checked = time.Now()
+			return lastErr
+		},
+	}
+}
@@ -0,0 +1,36 @@
+// Package httpx holds small helpers shared by the HTTP middleware
+package httpx
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// StatusRecorder captures the status code written by a handler
+type StatusRecorder struct {
+	http.ResponseWriter
+	// Status is the code written, http.StatusOK if the handler wrote none
+	Status int
+}
+
+// NewStatusRecorder wraps w to record the status written through it
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *StatusRecorder) WriteHeader(status int) {
+	r.Status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack hands the connection to the handler, for WebSocket upgrades
+func (r *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.Status = http.StatusSwitchingProtocols
+	return http.NewResponseController(r.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController
+func (r *StatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,29 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatusRecorder(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    int
+	}{
+		{"nothing written", func(w http.ResponseWriter, r *http.Request) {}, http.StatusOK},
+		{"body only", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }, http.StatusOK},
+		{"status written", func(w http.ResponseWriter, r *http.Request) { http.Error(w, "no", http.StatusTeapot) }, http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rec := NewStatusRecorder(w)
+			tt.handler(rec, httptest.NewRequest("GET", "/", nil))
+			if rec.Status != tt.want || w.Code != tt.want {
+				t.Errorf("recorded %d, wrote %d; want %d", rec.Status, w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"go-backend/ratelimit"
+)
+
+// StatusHandler serves a job's status, and its result once it has finished.
+// Jobs are only visible to the client that submitted them.
+func StatusHandler(m *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := m.Get(mux.Vars(r)["id"], ratelimit.ClientID(r))
+		if !ok {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !job.Status.Done() {
+			w.Header().Set("Retry-After", "2")
+		}
+		json.NewEncoder(w).Encode(job.Public())
+	}
+}
+
+// Accepted is the body returned when a job is submitted
+type Accepted struct {
+	JobID     string `json:"job_id"`
+	Status    Status `json:"status"`
+	StatusURL string `json:"status_url"`
+}
+
+// WriteAccepted answers a request that submitted job with 202 and where to poll
+func WriteAccepted(w http.ResponseWriter, job Job) {
+	statusURL := "/jobs/" + job.ID
+	w.Header().Set("Location", statusURL)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(Accepted{JobID: job.ID, Status: job.Status, StatusURL: statusURL})
+}
@@ -0,0 +1,470 @@
+// Package jobs runs long pipeline work in the background. Jobs are queued to
+// a fixed pool of workers, their status is kept in a Store so it can be
+// polled by id (and survive restarts with a FileStore), and their outcome can
+// be POSTed to a callback URL when they finish.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-backend/logging"
+	"go-backend/metrics"
+	"go-backend/ratelimit"
+	"go-backend/webhook"
+)
+
+// Status is where a job is in its lifecycle
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Done reports whether the job has finished, successfully or not
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed
+}
+
+var (
+	// ErrQueueFull is returned by Submit when no more jobs can be queued
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrShuttingDown is returned by Submit once Shutdown has been called
+	ErrShuttingDown = errors.New("job manager is shutting down")
+	// ErrUnknownKind is returned by Submit for a kind with no handler
+	ErrUnknownKind = errors.New("unknown job kind")
+)
+
+// Job is a background job as stored and polled
+type Job struct {
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	Status Status `json:"status"`
+	// Total and Completed report progress for jobs made of several items
+	Total      int             `json:"total,omitempty"`
+	Completed  int             `json:"completed"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Callback   *Callback       `json:"callback,omitempty"`
+
+	// Input is the job's arguments, kept so an interrupted job can be rerun
+	Input json.RawMessage `json:"input,omitempty"`
+	// Client is the rate limit identity that submitted the job; only it may poll
+	Client    string `json:"client,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Public returns the job as shown to the client polling it
+func (j Job) Public() Job {
+	j.Input = nil
+	j.Client = ""
+	return j
+}
+
+// Callback is where a job's outcome is delivered and how that went
+type Callback struct {
+	URL         string     `json:"url"`
+	Attempts    int        `json:"attempts"`
+	Delivered   bool       `json:"delivered"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// Handler does the work of one kind of job. It calls progress with the number
+// of items completed so far and returns the job's result, which must marshal
+// to JSON.
+type Handler func(ctx context.Context, job Job, progress func(completed int)) (interface{}, error)
+
+// Config holds the job manager settings
+type Config struct {
+	Workers   int
+	QueueSize int
+	// Retention is how long finished jobs can still be polled
+	Retention time.Duration
+}
+
+// ConfigFromEnv reads JOB_WORKERS, JOB_QUEUE_SIZE and JOB_RETENTION, falling
+// back to defaults for anything unset or invalid
+func ConfigFromEnv() Config {
+	cfg := Config{Workers: 4, QueueSize: 100, Retention: time.Hour}
+	if n, err := strconv.Atoi(os.Getenv("JOB_WORKERS")); err == nil && n > 0 {
+		cfg.Workers = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("JOB_QUEUE_SIZE")); err == nil && n > 0 {
+		cfg.QueueSize = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("JOB_RETENTION")); err == nil && d > 0 {
+		cfg.Retention = d
+	}
+	return cfg
+}
+
+// Manager queues jobs to a pool of workers and keeps their status
+type Manager struct {
+	cfg       Config
+	store     Store
+	callbacks *webhook.Sender
+	logger    *slog.Logger
+	handlers  map[string]Handler
+
+	queue chan string
+	quit  chan struct{}
+	wg    sync.WaitGroup
+
+	mu       sync.Mutex
+	contexts map[string]context.Context
+	closing  bool
+}
+
+// NewManager creates a manager. Register handlers with Handle, then call
+// Start. callbacks may be nil if callbacks are not configured.
+func NewManager(cfg Config, store Store, callbacks *webhook.Sender, logger *slog.Logger) *Manager {
+	return &Manager{
+		cfg:       cfg,
+		store:     store,
+		callbacks: callbacks,
+		logger:    logger,
+		handlers:  make(map[string]Handler),
+		queue:     make(chan string, cfg.QueueSize),
+		quit:      make(chan struct{}),
+		contexts:  make(map[string]context.Context),
+	}
+}
+
+// Handle registers the handler for a kind of job
+func (m *Manager) Handle(kind string, h Handler) {
+	m.handlers[kind] = h
+}
+
+// Callbacks returns the callback sender, or nil if callbacks are disabled
+func (m *Manager) Callbacks() *webhook.Sender {
+	return m.callbacks
+}
+
+// Start requeues jobs left unfinished by a previous run and starts the
+// workers. Resumed jobs run without the submitting request's context, so
+// their LLM usage is not charged to the client's quota.
+func (m *Manager) Start() error {
+	stored, err := m.store.List()
+	if err != nil {
+		return fmt.Errorf("error listing stored jobs: %v", err)
+	}
+
+	var resume []string
+	for _, job := range stored {
+		if job.Status.Done() {
+			continue
+		}
+		job.Status = StatusQueued
+		job.StartedAt = nil
+		job.Completed = 0
+		if err := m.store.Save(job); err != nil {
+			return err
+		}
+		resume = append(resume, job.ID)
+	}
+	if len(resume) > 0 {
+		m.logger.Info("Resuming unfinished jobs", "jobs", len(resume))
+		// The queue may be smaller than the backlog, so feed it as workers free up
+		go func() {
+			for _, id := range resume {
+				select {
+				case m.queue <- id:
+				case <-m.quit:
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < m.cfg.Workers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+	go m.janitor()
+	return nil
+}
+
+// Submit stores and queues a job. input is kept as the job's arguments and
+// callbackURL, if set, receives the outcome. The job runs with ctx's values
+// (client, request id, logger) but not its cancellation, so it outlives the
+// request that submitted it.
+func (m *Manager) Submit(ctx context.Context, kind string, input interface{}, total int, callbackURL string) (Job, error) {
+	if _, ok := m.handlers[kind]; !ok {
+		return Job{}, fmt.Errorf("%w %q", ErrUnknownKind, kind)
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return Job{}, fmt.Errorf("error encoding job input: %v", err)
+	}
+
+	client, _ := ratelimit.ClientFromContext(ctx)
+	job := Job{
+		ID:        newID(),
+		Kind:      kind,
+		Status:    StatusQueued,
+		Total:     total,
+		CreatedAt: time.Now().UTC(),
+		Input:     data,
+		Client:    client,
+		RequestID: logging.RequestID(ctx),
+	}
+	if callbackURL != "" {
+		job.Callback = &Callback{URL: callbackURL}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closing {
+		return Job{}, ErrShuttingDown
+	}
+	if err := m.store.Save(job); err != nil {
+		return Job{}, fmt.Errorf("error saving job: %v", err)
+	}
+	m.contexts[job.ID] = context.WithoutCancel(ctx)
+
+	select {
+	case m.queue <- job.ID:
+		return job, nil
+	default:
+		delete(m.contexts, job.ID)
+		m.store.Delete(job.ID)
+		return Job{}, ErrQueueFull
+	}
+}
+
+// Get returns the job with the given id, if it exists and was submitted by client
+func (m *Manager) Get(id, client string) (Job, bool) {
+	job, ok, err := m.store.Load(id)
+	if err != nil {
+		m.logger.Error("Error loading job", "job_id", id, "error", err)
+		return Job{}, false
+	}
+	if !ok || job.Client != client {
+		return Job{}, false
+	}
+	return job, true
+}
+
+// Shutdown stops accepting jobs and waits for the queued and running ones to
+// finish, or for ctx to be done. Jobs still unfinished after that are resumed
+// by the next Start if the store is persistent.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.closing {
+		m.closing = true
+		close(m.quit)
+	}
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Manager) work() {
+	defer m.wg.Done()
+	for {
+		select {
+		case id := <-m.queue:
+			m.run(id)
+		case <-m.quit:
+			// Finish what was already accepted before exiting
+			for {
+				select {
+				case id := <-m.queue:
+					m.run(id)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (m *Manager) run(id string) {
+	m.mu.Lock()
+	ctx, ok := m.contexts[id]
+	delete(m.contexts, id)
+	m.mu.Unlock()
+
+	job, found, err := m.store.Load(id)
+	if err != nil || !found {
+		m.logger.Error("Queued job not found", "job_id", id, "error", err)
+		return
+	}
+	if !ok {
+		ctx = logging.WithRequestID(context.Background(), job.RequestID)
+	}
+	logger := m.logger.With("job_id", id, "kind", job.Kind)
+
+	job = m.update(id, func(j *Job) {
+		now := time.Now().UTC()
+		j.Status = StatusRunning
+		j.StartedAt = &now
+	})
+	logger.InfoContext(ctx, "Job started")
+
+	result, err := m.call(ctx, job, func(completed int) {
+		m.update(id, func(j *Job) { j.Completed = completed })
+	})
+
+	var data []byte
+	if err == nil {
+		data, err = json.Marshal(result)
+	}
+
+	job = m.update(id, func(j *Job) {
+		now := time.Now().UTC()
+		j.FinishedAt = &now
+		if err != nil {
+			j.Status = StatusFailed
+			j.Error = err.Error()
+			return
+		}
+		j.Status = StatusSucceeded
+		j.Result = data
+	})
+
+	if err != nil {
+		logger.WarnContext(ctx, "Job failed", "error", err)
+	} else {
+		logger.InfoContext(ctx, "Job finished")
+	}
+
+	if job.Callback != nil {
+		m.deliver(ctx, logger, job)
+	}
+}
+
+// call runs the job's handler, turning a panic into an error so one bad job
+// cannot take the worker down with it
+func (m *Manager) call(ctx context.Context, job Job, progress func(int)) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	h, ok := m.handlers[job.Kind]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKind, job.Kind)
+	}
+	return h(ctx, job, progress)
+}
+
+// deliver POSTs a finished job's result (or {"error": ...} if it failed) to
+// its callback URL and records the outcome on the job
+func (m *Manager) deliver(ctx context.Context, logger *slog.Logger, job Job) {
+	body := []byte(job.Result)
+	if job.Status == StatusFailed {
+		body, _ = json.Marshal(map[string]string{"error": job.Error})
+	}
+	headers := map[string]string{
+		"X-Job-ID":     job.ID,
+		"X-Job-Status": string(job.Status),
+	}
+
+	attempts, err := m.callbacks.Send(ctx, job.Callback.URL, headers, body)
+	metrics.ObserveCallback(err == nil)
+
+	m.update(job.ID, func(j *Job) {
+		j.Callback.Attempts += attempts
+		if err != nil {
+			j.Callback.LastError = err.Error()
+			return
+		}
+		now := time.Now().UTC()
+		j.Callback.Delivered = true
+		j.Callback.DeliveredAt = &now
+		j.Callback.LastError = ""
+	})
+
+	if err != nil {
+		logger.WarnContext(ctx, "Callback delivery failed", "attempts", attempts, "error", err)
+	} else {
+		logger.InfoContext(ctx, "Callback delivered", "attempts", attempts)
+	}
+}
+
+// update applies fn to the stored job and saves it, returning the result
+func (m *Manager) update(id string, fn func(j *Job)) Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok, err := m.store.Load(id)
+	if err != nil || !ok {
+		m.logger.Error("Error loading job for update", "job_id", id, "error", err)
+		return job
+	}
+	fn(&job)
+	if err := m.store.Save(job); err != nil {
+		m.logger.Error("Error saving job", "job_id", id, "error", err)
+	}
+	return job
+}
+
+// janitor periodically drops finished jobs older than the retention period
+func (m *Manager) janitor() {
+	interval := m.cfg.Retention / 10
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.prune()
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+func (m *Manager) prune() {
+	stored, err := m.store.List()
+	if err != nil {
+		m.logger.Error("Error listing jobs", "error", err)
+		return
+	}
+	cutoff := time.Now().Add(-m.cfg.Retention)
+	for _, job := range stored {
+		if job.Status.Done() && job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			if err := m.store.Delete(job.ID); err != nil {
+				m.logger.Error("Error deleting job", "job_id", job.ID, "error", err)
+			}
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,179 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// Store persists jobs. Implementations must be safe for concurrent use.
+type Store interface {
+	// Save creates or replaces a job
+	Save(job Job) error
+	// Load returns the job with the given id; ok is false if there is none
+	Load(id string) (job Job, ok bool, err error)
+	// Delete removes a job, if it exists
+	Delete(id string) error
+	// List returns every stored job
+	List() ([]Job, error)
+}
+
+// MemoryStore keeps jobs in memory; they are lost on restart
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]Job)}
+}
+
+func (s *MemoryStore) Save(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryStore) Load(id string) (Job, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	return job, ok, nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+	return nil
+}
+
+func (s *MemoryStore) List() ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		out = append(out, job)
+	}
+	return out, nil
+}
+
+// validID matches the ids generated by the manager, so a polled id can never
+// name a path outside the store directory
+var validID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// FileStore keeps one JSON file per job in a directory, so job status
+// survives restarts and unfinished jobs can be resumed
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore creates a store in dir, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// DefaultDir is where job status is kept unless JOBS_DIR says otherwise
+const DefaultDir = "data/jobs"
+
+// StoreFromEnv returns a FileStore in JOBS_DIR (DefaultDir if it is unset),
+// or a MemoryStore if JOBS_DIR is "none"
+func StoreFromEnv() (Store, error) {
+	switch dir := os.Getenv("JOBS_DIR"); dir {
+	case "none":
+		return NewMemoryStore(), nil
+	case "":
+		return NewFileStore(DefaultDir)
+	default:
+		return NewFileStore(dir)
+	}
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *FileStore) Save(job Job) error {
+	if !validID.MatchString(job.ID) {
+		return fmt.Errorf("invalid job id %q", job.ID)
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Write then rename so a crash never leaves a half-written job behind
+	tmp := s.path(job.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(job.ID))
+}
+
+func (s *FileStore) Load(id string) (Job, bool, error) {
+	if !validID.MatchString(id) {
+		return Job{}, false, nil
+	}
+
+	s.mu.Lock()
+	data, err := os.ReadFile(s.path(id))
+	s.mu.Unlock()
+
+	if errors.Is(err, os.ErrNotExist) {
+		return Job{}, false, nil
+	}
+	if err != nil {
+		return Job{}, false, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return Job{}, false, fmt.Errorf("job %s: %v", id, err)
+	}
+	return job, true, nil
+}
+
+func (s *FileStore) Delete(id string) error {
+	if !validID.MatchString(id) {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) List() ([]Job, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Job
+	for _, path := range paths {
+		id := filepath.Base(path[:len(path)-len(".json")])
+		job, ok, err := s.Load(id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, job)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreFromEnv(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "jobs")
+	tests := []struct {
+		env      string
+		wantFile bool
+		wantDir  string
+	}{
+		{env: "", wantFile: true, wantDir: DefaultDir},
+		{env: dir, wantFile: true, wantDir: dir},
+		{env: "none", wantFile: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			// The default directory is relative, so run where it can be created
+			wd, err := os.Getwd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chdir(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.Chdir(wd) })
+			t.Setenv("JOBS_DIR", tt.env)
+
+			store, err := StoreFromEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			fs, isFile := store.(*FileStore)
+			if isFile != tt.wantFile {
+				t.Fatalf("store = %T, want a FileStore: %v", store, tt.wantFile)
+			}
+			if isFile && fs.dir != tt.wantDir {
+				t.Errorf("dir = %q, want %q", fs.dir, tt.wantDir)
+			}
+		})
+	}
+}
+
+func TestFileStoreSurvivesReopening(t *testing.T) {
+	dir := t.TempDir()
+	first, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := Job{ID: "0123456789abcdef0123456789abcdef", Kind: "prompt", Status: StatusRunning}
+	if err := first.Save(job); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := second.Load(job.ID)
+	if err != nil || !ok || got.Status != StatusRunning {
+		t.Errorf("Load after reopening = %+v, %v, %v; want the running job", got, ok, err)
+	}
+}
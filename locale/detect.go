@@ -0,0 +1,99 @@
+package locale
+
+import (
+	"strings"
+	"unicode"
+)
+
+var languageNames = map[string]string{
+	"en": "English", "es": "Spanish", "fr": "French", "de": "German", "it": "Italian",
+	"pt": "Portuguese", "nl": "Dutch", "ru": "Russian", "ar": "Arabic", "ja": "Japanese",
+	"ko": "Korean", "zh": "Chinese", "el": "Greek", "he": "Hebrew",
+}
+
+// stopWords are common words that mostly belong to one language. Words
+// shared by several of them, like "a" or "de", are left out.
+var stopWords = map[string][]string{
+	"en": {"the", "and", "in", "this", "for", "me", "near", "tonight", "with", "what", "show", "find", "some", "weekend", "tickets", "concerts", "next", "of", "to", "is", "are", "at"},
+	"es": {"el", "los", "las", "del", "y", "en", "para", "conciertos", "este", "esta", "fin", "semana", "cerca", "entradas", "boletos", "quiero", "qué", "hay", "mañana", "noche", "con", "por", "una"},
+	"fr": {"le", "les", "des", "du", "et", "pour", "ce", "cette", "week-end", "près", "billets", "concerts", "je", "cherche", "soir", "demain", "avec", "sur", "dans", "une", "au", "aux"},
+	"de": {"der", "die", "das", "und", "für", "dieses", "diese", "wochenende", "nähe", "karten", "konzerte", "ich", "suche", "heute", "abend", "morgen", "mit", "im", "ein", "eine", "am"},
+	"it": {"il", "gli", "della", "e", "per", "questo", "questa", "fine", "settimana", "vicino", "biglietti", "concerti", "cerco", "stasera", "domani", "sera", "con", "nel", "una", "alla"},
+	"pt": {"o", "os", "da", "do", "e", "para", "este", "esta", "fim", "semana", "perto", "ingressos", "bilhetes", "shows", "quero", "hoje", "noite", "amanhã", "com", "em", "uma", "na", "no"},
+	"nl": {"het", "een", "en", "voor", "dit", "deze", "weekend", "bij", "buurt", "kaartjes", "concerten", "ik", "zoek", "vanavond", "morgen", "met", "op", "van"},
+}
+
+// scripts detect languages written in their own script by the first
+// letter in it
+var scripts = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+}
+
+// Detect guesses the language text is written in. It reports false if the
+// text is too short or too mixed to tell.
+func Detect(text string) (string, bool) {
+	counts := make(map[string]int)
+	for _, r := range text {
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				counts[s.lang]++
+				break
+			}
+		}
+	}
+	// Kana mark Japanese even when it is mostly Han characters
+	if counts["ja"] > 0 {
+		return "ja", true
+	}
+	if lang, n := best(counts); n >= 2 {
+		return lang, true
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '-'
+	})
+	scores := make(map[string]int)
+	for lang, list := range stopWords {
+		for _, w := range words {
+			for _, s := range list {
+				if w == s {
+					scores[lang]++
+				}
+			}
+		}
+	}
+	lang, top := best(scores)
+	second := 0
+	for l, n := range scores {
+		if l != lang && n > second {
+			second = n
+		}
+	}
+	// Two hits and a clear lead over the runner-up
+	if top >= 2 && top > second {
+		return lang, true
+	}
+	return "", false
+}
+
+// best returns the key with the highest count, ties broken alphabetically
+// so detection is deterministic
+func best(counts map[string]int) (string, int) {
+	lang, top := "", 0
+	for l, n := range counts {
+		if n > top || (n == top && n > 0 && l < lang) {
+			lang, top = l, n
+		}
+	}
+	return lang, top
+}
@@ -0,0 +1,39 @@
+package locale
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+		ok   bool
+	}{
+		{"find me some concerts in Chicago this weekend", "en", true},
+		{"quiero boletos para conciertos este fin de semana", "es", true},
+		{"je cherche des billets pour ce soir", "fr", true},
+		{"ich suche Karten für dieses Wochenende", "de", true},
+		{"cerco biglietti per stasera", "it", true},
+		{"quero ingressos para hoje à noite", "pt", true},
+		{"ik zoek kaartjes voor vanavond", "nl", true},
+		{"東京のコンサート", "ja", true},
+		{"서울 콘서트", "ko", true},
+		{"北京音乐会", "zh", true},
+		{"концерты в Москве", "ru", true},
+		{"حفلات في دبي", "ar", true},
+		{"συναυλίες στην Αθήνα", "el", true},
+		{"הופעות בתל אביב", "he", true},
+		// Too short or too mixed to tell
+		{"jazz", "", false},
+		{"Taylor Swift", "", false},
+		{"", "", false},
+		{"concerts conciertos", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, ok := Detect(tt.text)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Detect(%q) = %q, %v; want %q, %v", tt.text, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Package locale works out the language and region a prompt should be
+// answered in: the locale the request asks for, the language the prompt is
+// written in, or the client's Accept-Language header. The resolved locale
+// travels in the request context so every factory and the formatter use it.
+package locale
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidLocale is returned for a tag that is not a language code,
+// optionally followed by a region code, such as "fr" or "fr-CA"
+var ErrInvalidLocale = errors.New("invalid locale")
+
+// Locale is a language and optional region, e.g. fr-CA
+type Locale struct {
+	// Language is the lowercase ISO 639-1 code
+	Language string `json:"language"`
+	// Region is the uppercase ISO 3166-1 alpha-2 code, if known
+	Region string `json:"region,omitempty"`
+}
+
+// Parse parses a BCP 47 style tag. Only the language and region are kept:
+// "en-us", "en_US" and "en-Latn-US" are all en-US.
+func Parse(tag string) (Locale, error) {
+	parts := strings.FieldsFunc(strings.TrimSpace(tag), func(r rune) bool { return r == '-' || r == '_' })
+	if len(parts) == 0 || len(parts[0]) != 2 || !isLetters(parts[0]) {
+		return Locale{}, ErrInvalidLocale
+	}
+	l := Locale{Language: strings.ToLower(parts[0])}
+	for _, p := range parts[1:] {
+		if len(p) == 2 && isLetters(p) {
+			l.Region = strings.ToUpper(p)
+			break
+		}
+	}
+	return l, nil
+}
+
+// String returns the tag, e.g. "fr-CA" or "fr"
+func (l Locale) String() string {
+	if l.Region == "" {
+		return l.Language
+	}
+	return l.Language + "-" + l.Region
+}
+
+// Name is the language's English name, for prompts, or its code if it is
+// not one Detect knows
+func (l Locale) Name() string {
+	if name, ok := languageNames[l.Language]; ok {
+		return name
+	}
+	return l.Language
+}
+
+// Default is DEFAULT_LOCALE, or English with no region
+func Default() Locale {
+	if l, err := Parse(os.Getenv("DEFAULT_LOCALE")); err == nil {
+		return l
+	}
+	return Locale{Language: "en"}
+}
+
+// ParseAcceptLanguage returns the client's preferred locales from an
+// Accept-Language header, most preferred first. Wildcards and malformed
+// entries are skipped.
+func ParseAcceptLanguage(header string) []Locale {
+	type weighted struct {
+		locale Locale
+		q      float64
+	}
+	var prefs []weighted
+	for _, entry := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		l, err := Parse(tag)
+		if err != nil || q <= 0 {
+			continue
+		}
+		prefs = append(prefs, weighted{l, q})
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+
+	locales := make([]Locale, len(prefs))
+	for i, p := range prefs {
+		locales[i] = p.locale
+	}
+	return locales
+}
+
+type requestedKey struct{}
+type acceptedKey struct{}
+type localeKey struct{}
+
+// WithRequested returns a context carrying the locale the request body asked for
+func WithRequested(ctx context.Context, l Locale) context.Context {
+	return context.WithValue(ctx, requestedKey{}, l)
+}
+
+// WithAccepted returns a context carrying the client's Accept-Language preferences
+func WithAccepted(ctx context.Context, locales []Locale) context.Context {
+	return context.WithValue(ctx, acceptedKey{}, locales)
+}
+
+// NewContext returns a context carrying the locale resolved for the prompt
+func NewContext(ctx context.Context, l *Locale) context.Context {
+	return context.WithValue(ctx, localeKey{}, l)
+}
+
+// FromContext returns the locale resolved for the prompt, or nil if none was
+func FromContext(ctx context.Context) *Locale {
+	l, _ := ctx.Value(localeKey{}).(*Locale)
+	return l
+}
+
+// Resolve picks the locale for prompt: the one the request asked for, else
+// the language the prompt is written in, else the client's first
+// Accept-Language choice, else Default. A detected language takes its
+// region from an Accept-Language entry of the same language, if any.
+func Resolve(ctx context.Context, prompt string) Locale {
+	if l, ok := ctx.Value(requestedKey{}).(Locale); ok {
+		return l
+	}
+	accepted, _ := ctx.Value(acceptedKey{}).([]Locale)
+
+	if lang, ok := Detect(prompt); ok {
+		l := Locale{Language: lang}
+		for _, a := range accepted {
+			if a.Language == lang && a.Region != "" {
+				l.Region = a.Region
+				break
+			}
+		}
+		return l
+	}
+	if len(accepted) > 0 {
+		return accepted[0]
+	}
+	return Default()
+}
+
+// Middleware attaches the preferences in the Accept-Language header to each
+// request
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if locales := ParseAcceptLanguage(r.Header.Get("Accept-Language")); len(locales) > 0 {
+			r = r.WithContext(WithAccepted(r.Context(), locales))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
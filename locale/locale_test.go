@@ -0,0 +1,116 @@
+package locale
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		tag     string
+		want    Locale
+		wantErr bool
+	}{
+		{tag: "fr", want: Locale{Language: "fr"}},
+		{tag: "fr-CA", want: Locale{Language: "fr", Region: "CA"}},
+		{tag: "en_us", want: Locale{Language: "en", Region: "US"}},
+		{tag: " EN-gb ", want: Locale{Language: "en", Region: "GB"}},
+		{tag: "en-Latn-US", want: Locale{Language: "en", Region: "US"}},
+		{tag: "es-419", want: Locale{Language: "es"}},
+		{tag: "", wantErr: true},
+		{tag: "eng", wantErr: true},
+		{tag: "*", wantErr: true},
+		{tag: "1a-US", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.tag)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidLocale) {
+				t.Errorf("Parse(%q) err = %v, want ErrInvalidLocale", tt.tag, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q) = %+v, %v; want %+v", tt.tag, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", []string{}},
+		{"fr-CA", []string{"fr-CA"}},
+		{"fr-CA,fr;q=0.9,en;q=0.8", []string{"fr-CA", "fr", "en"}},
+		{"en;q=0.5, de-DE", []string{"de-DE", "en"}},
+		// Equal weights keep the header's order
+		{"es;q=0.7,pt;q=0.7", []string{"es", "pt"}},
+		{"*, de;q=0.5", []string{"de"}},
+		{"en;q=0, fr", []string{"fr"}},
+		{"en;q=high, fr", []string{"fr"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got := []string{}
+			for _, l := range ParseAcceptLanguage(tt.header) {
+				got = append(got, l.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAcceptLanguage(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	fr := Locale{Language: "fr", Region: "FR"}
+	accepted := []Locale{{Language: "en", Region: "GB"}, {Language: "es", Region: "MX"}}
+	tests := []struct {
+		name      string
+		requested *Locale
+		accepted  []Locale
+		prompt    string
+		want      string
+	}{
+		{name: "requested wins", requested: &fr, accepted: accepted, prompt: "quiero boletos para el fin de semana", want: "fr-FR"},
+		{name: "detected takes the accepted region", accepted: accepted, prompt: "quiero boletos para el fin de semana", want: "es-MX"},
+		{name: "detected without a region", accepted: accepted, prompt: "je cherche des billets pour ce soir", want: "fr"},
+		{name: "accepted when undetected", accepted: accepted, prompt: "jazz", want: "en-GB"},
+		{name: "default", prompt: "jazz", want: "en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.requested != nil {
+				ctx = WithRequested(ctx, *tt.requested)
+			}
+			if tt.accepted != nil {
+				ctx = WithAccepted(ctx, tt.accepted)
+			}
+			if got := Resolve(ctx, tt.prompt).String(); got != tt.want {
+				t.Errorf("Resolve = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefault(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{"", "en"},
+		{"de-AT", "de-AT"},
+		{"not a locale", "en"},
+	}
+	for _, tt := range tests {
+		t.Setenv("DEFAULT_LOCALE", tt.env)
+		if got := Default().String(); got != tt.want {
+			t.Errorf("Default() with DEFAULT_LOCALE=%q = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
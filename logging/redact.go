@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	// apikey=..., api_key=..., token=... in query strings and free text
+	secretParamPattern = regexp.MustCompile(`(?i)\b(api_?key|access_?token|token|secret|password)=([^&\s"']+)`)
+	// Authorization: Bearer ...
+	bearerPattern = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`)
+	// OpenAI style secret keys
+	openAIKeyPattern = regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{8,}`)
+)
+
+// sensitiveKeys are attribute key fragments whose values are never logged
+var sensitiveKeys = []string{"apikey", "api_key", "authorization", "password", "secret", "token"}
+
+// Redact masks API keys, bearer tokens and secret query parameters in s
+func Redact(s string) string {
+	s = secretParamPattern.ReplaceAllString(s, "$1="+redacted)
+	s = bearerPattern.ReplaceAllString(s, "Bearer "+redacted)
+	s = openAIKeyPattern.ReplaceAllString(s, redacted)
+	return s
+}
+
+// isSensitiveKey reports whether an attribute with this key holds a secret
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, fragment := range sensitiveKeys {
+		if strings.Contains(key, fragment) {
+			return true
+		}
+	}
+	return false
+}
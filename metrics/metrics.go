@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Pipeline stages timed by ObserveStage
+const (
+	StageClassification   = "classification"
+	StageActionExtraction = "action_extraction"
+	StageUpstreamCall     = "upstream_call"
+	StageFormatting       = "formatting"
+)
+
+// Upstream APIs counted by ObserveUpstream
+const (
+	UpstreamOpenAI       = "openai"
+	UpstreamTicketmaster = "ticketmaster"
+)
+
+// Caches counted by ObserveCache
+const (
+	CacheDedup         = "dedup"
+	CacheUpstreamCheck = "upstream_check"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by route and method.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60},
+	}, []string{"route", "method"})
+
+	stageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pipeline_stage_duration_seconds",
+		Help:    "Time spent in each prompt pipeline stage, by stage and service.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2, 4, 8, 16, 32},
+	}, []string{"stage", "service"})
+
+	applicability = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "service_applicability_score",
+		Help:    "Applicability scores returned by the classifier, by service.",
+		Buckets: prometheus.LinearBuckets(10, 10, 10),
+	}, []string{"service"})
+
+	upstreamRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_requests_total",
+		Help: "Calls to upstream APIs, by upstream and HTTP status (or \"error\" for transport failures).",
+	}, []string{"upstream", "status"})
+
+	injectionMatches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prompt_injection_matches_total",
+		Help: "Prompts matching an injection pattern, by pattern and whether the prompt was blocked.",
+	}, []string{"pattern", "blocked"})
+
+	rejectedOutputs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "llm_output_rejections_total",
+		Help: "LLM outputs (or parts of them) rejected by validation, by stage.",
+	}, []string{"stage"})
+
+	callbackDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "job_callback_deliveries_total",
+		Help: "Job callback deliveries, by outcome after retries (delivered or failed).",
+	}, []string{"outcome"})
+
+	savedSearchRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "saved_search_runs_total",
+		Help: "Scheduled saved search runs, by outcome (ok or error).",
+	}, []string{"outcome"})
+
+	alertNotifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "alert_notifications_total",
+		Help: "New-event alerts sent, by outcome (delivered or failed).",
+	}, []string{"outcome"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_requests_total",
+		Help: "Lookups in the server's caches, by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	breakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "circuit_breaker_state",
+		Help: "Circuit breaker state by upstream: 0 closed, 1 half-open, 2 open.",
+	}, []string{"upstream"})
+)
+
+func init() {
+	prometheus.MustRegister(httpRequests, httpDuration, stageDuration, applicability, upstreamRequests,
+		injectionMatches, rejectedOutputs, callbackDeliveries, savedSearchRuns, alertNotifications,
+		cacheRequests, breakerState)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveStage records how long a pipeline stage took since start
+func ObserveStage(stage, service string, start time.Time) {
+	stageDuration.WithLabelValues(stage, service).Observe(time.Since(start).Seconds())
+}
+
+// ObserveApplicability records a classifier score for a service
+func ObserveApplicability(service string, score int) {
+	applicability.WithLabelValues(service).Observe(float64(score))
+}
+
+// ObserveInjection counts a prompt matching an injection pattern
+func ObserveInjection(pattern string, blocked bool) {
+	injectionMatches.WithLabelValues(pattern, strconv.FormatBool(blocked)).Inc()
+}
+
+// ObserveRejectedOutput counts an LLM output that failed validation
+func ObserveRejectedOutput(stage string) {
+	rejectedOutputs.WithLabelValues(stage).Inc()
+}
+
+// ObserveCallback counts a job callback delivery by whether it succeeded
+func ObserveCallback(delivered bool) {
+	outcome := "failed"
+	if delivered {
+		outcome = "delivered"
+	}
+	callbackDeliveries.WithLabelValues(outcome).Inc()
+}
+
+// ObserveSearchRun counts a scheduled saved search run by whether it succeeded
+func ObserveSearchRun(err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	savedSearchRuns.WithLabelValues(outcome).Inc()
+}
+
+// ObserveAlert counts a new-event alert by whether every notifier took it
+func ObserveAlert(err error) {
+	outcome := "delivered"
+	if err != nil {
+		outcome = "failed"
+	}
+	alertNotifications.WithLabelValues(outcome).Inc()
+}
+
+// ObserveUpstream counts an upstream call by its outcome
+func ObserveUpstream(upstream string, status int, err error) {
+	label := strconv.Itoa(status)
+	if err != nil {
+		label = "error"
+	}
+	upstreamRequests.WithLabelValues(upstream, label).Inc()
+}
+
+// ObserveCache counts a cache lookup by whether it was answered from the cache
+func ObserveCache(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// ObserveBreaker records the state an upstream's circuit breaker is in
+func ObserveBreaker(upstream string, state int) {
+	breakerState.WithLabelValues(upstream).Set(float64(state))
+}
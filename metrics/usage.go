@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"go-backend/usage"
+)
+
+// usageCollector exports the LLM usage totals kept by the usage package
+type usageCollector struct {
+	tokens *prometheus.Desc
+	cost   *prometheus.Desc
+	calls  *prometheus.Desc
+}
+
+func newUsageCollector() *usageCollector {
+	return &usageCollector{
+		tokens: prometheus.NewDesc("llm_tokens_total",
+			"LLM tokens consumed, by service and kind (prompt or completion).",
+			[]string{"service", "kind"}, nil),
+		cost: prometheus.NewDesc("llm_cost_usd_total",
+			"Estimated LLM spend in USD, by service.",
+			[]string{"service"}, nil),
+		calls: prometheus.NewDesc("llm_calls_total",
+			"LLM calls made, by model.",
+			[]string{"model"}, nil),
+	}
+}
+
+func init() {
+	prometheus.MustRegister(newUsageCollector())
+}
+
+func (c *usageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.tokens
+	ch <- c.cost
+	ch <- c.calls
+}
+
+func (c *usageCollector) Collect(ch chan<- prometheus.Metric) {
+	report := usage.Totals()
+
+	for service, s := range report.ByService {
+		ch <- prometheus.MustNewConstMetric(c.tokens, prometheus.CounterValue, float64(s.PromptTokens), service, "prompt")
+		ch <- prometheus.MustNewConstMetric(c.tokens, prometheus.CounterValue, float64(s.CompletionTokens), service, "completion")
+		ch <- prometheus.MustNewConstMetric(c.cost, prometheus.CounterValue, s.CostUSD, service)
+	}
+	for model, s := range report.ByModel {
+		ch <- prometheus.MustNewConstMetric(c.calls, prometheus.CounterValue, float64(s.Calls), model)
+	}
+}
@@ -0,0 +1,137 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// MaxBodyBytes is the largest request body the validator reads
+const MaxBodyBytes = 4 << 20
+
+// Validator checks requests against the document before they reach their
+// handlers
+type Validator struct {
+	Doc *Document
+}
+
+// NewValidator returns a validator for doc
+func NewValidator(doc *Document) *Validator {
+	return &Validator{Doc: doc}
+}
+
+// Middleware answers 400 to requests whose query, headers or JSON body do
+// not match the operation the route serves. Routes the document does not
+// describe are passed through untouched. It must be installed on a mux
+// router, whose matched route names the operation.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		op, ok := v.Doc.Operation(r.Method, template)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		problems := v.checkParameters(op, r)
+
+		if op.RequestBody != nil {
+			if media, ok := op.RequestBody.Content[JSONContent]; ok {
+				body, err := io.ReadAll(io.LimitReader(r.Body, MaxBodyBytes+1))
+				r.Body.Close()
+				if err != nil {
+					http.Error(w, "Invalid request body", http.StatusBadRequest)
+					return
+				}
+				if len(body) > MaxBodyBytes {
+					http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				// The handler reads the body again
+				r.Body = io.NopCloser(bytes.NewReader(body))
+
+				var value interface{}
+				if len(bytes.TrimSpace(body)) == 0 {
+					if op.RequestBody.Required {
+						problems = append(problems, "body is required")
+					}
+				} else if err := json.Unmarshal(body, &value); err != nil {
+					http.Error(w, "Invalid request body", http.StatusBadRequest)
+					return
+				} else {
+					problems = append(problems, v.Doc.Validate(media.Schema, value, "")...)
+				}
+			}
+		}
+
+		if len(problems) > 0 {
+			http.Error(w, "Invalid request: "+strings.Join(problems, "; "), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkParameters validates the query and header parameters. Path
+// parameters were already matched by the router.
+func (v *Validator) checkParameters(op *Operation, r *http.Request) []string {
+	var problems []string
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var raw string
+		var present bool
+		switch p.In {
+		case "query":
+			raw, present = query.Get(p.Name), query.Has(p.Name)
+		case "header":
+			raw = r.Header.Get(p.Name)
+			present = raw != ""
+		default:
+			continue
+		}
+		if !present {
+			if p.Required {
+				problems = append(problems, p.Name+" is required")
+			}
+			continue
+		}
+		value, ok := parseParameter(v.Doc.Resolve(p.Schema), raw)
+		if !ok {
+			problems = append(problems, p.Name+" must be a "+v.Doc.Resolve(p.Schema).Type)
+			continue
+		}
+		problems = append(problems, v.Doc.Validate(p.Schema, value, p.Name)...)
+	}
+	return problems
+}
+
+// parseParameter converts a query or header value to the JSON type its
+// schema expects
+func parseParameter(s *Schema, raw string) (interface{}, bool) {
+	if s == nil {
+		return raw, true
+	}
+	switch s.Type {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		return n, err == nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		return b, err == nil
+	}
+	return raw, true
+}
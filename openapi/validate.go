@@ -0,0 +1,208 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Validate checks a decoded JSON value against s and returns a problem for
+// each way it does not match, prefixed with where in the value it is.
+// Properties that are not required may be null, as the server's decoder
+// accepts that too; read-only properties are ignored.
+func (d *Document) Validate(s *Schema, v interface{}, path string) []string {
+	s = d.Resolve(s)
+	if s == nil {
+		return nil
+	}
+	if v == nil {
+		if s.Nullable || s.Type == "" && len(s.OneOf) == 0 {
+			return nil
+		}
+		return []string{problem(path, "must not be null")}
+	}
+
+	if len(s.OneOf) > 0 {
+		matched := 0
+		for _, alt := range s.OneOf {
+			if len(d.Validate(alt, v, path)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return []string{problem(path, "must match exactly one of the allowed forms")}
+		}
+		return nil
+	}
+
+	var problems []string
+	switch s.Type {
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return []string{problem(path, "must be a string")}
+		}
+		problems = append(problems, d.validateString(s, str, path)...)
+	case "integer", "number":
+		n, ok := v.(float64)
+		if !ok {
+			return []string{problem(path, "must be a "+s.Type)}
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			return []string{problem(path, "must be an integer")}
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			problems = append(problems, problem(path, fmt.Sprintf("must be at least %v", *s.Minimum)))
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			problems = append(problems, problem(path, fmt.Sprintf("must be at most %v", *s.Maximum)))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []string{problem(path, "must be a boolean")}
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return []string{problem(path, "must be an array")}
+		}
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			problems = append(problems, problem(path, fmt.Sprintf("must have at least %d items", *s.MinItems)))
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			problems = append(problems, problem(path, fmt.Sprintf("must have at most %d items", *s.MaxItems)))
+		}
+		for i, item := range items {
+			problems = append(problems, d.Validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return []string{problem(path, "must be an object")}
+		}
+		problems = append(problems, d.validateObject(s, obj, path)...)
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		problems = append(problems, problem(path, fmt.Sprintf("must be one of %v", s.Enum)))
+	}
+	return problems
+}
+
+func (d *Document) validateString(s *Schema, str, path string) []string {
+	var problems []string
+	n := utf8.RuneCountInString(str)
+	if s.MinLength != nil && n < *s.MinLength {
+		if *s.MinLength == 1 {
+			problems = append(problems, problem(path, "must not be empty"))
+		} else {
+			problems = append(problems, problem(path, fmt.Sprintf("must be at least %d characters", *s.MinLength)))
+		}
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		problems = append(problems, problem(path, fmt.Sprintf("must be at most %d characters", *s.MaxLength)))
+	}
+	if s.Pattern != "" {
+		re, err := compile(s.Pattern)
+		if err != nil || !re.MatchString(str) {
+			problems = append(problems, problem(path, "is not in the expected format"))
+		}
+	}
+	switch s.Format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			problems = append(problems, problem(path, "must be an RFC 3339 time"))
+		}
+	case "uri":
+		if u, err := url.Parse(str); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, problem(path, "must be an absolute URL"))
+		}
+	}
+	return problems
+}
+
+func (d *Document) validateObject(s *Schema, obj map[string]interface{}, path string) []string {
+	var problems []string
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			problems = append(problems, problem(join(path, name), "is required"))
+		}
+	}
+
+	// Sorted so the problems come out in the same order every time
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := obj[name]
+		prop, known := s.Properties[name]
+		if !known {
+			problems = append(problems, d.Validate(s.AdditionalProperties, value, join(path, name))...)
+			continue
+		}
+		if resolved := d.Resolve(prop); resolved == nil || resolved.ReadOnly || prop.ReadOnly {
+			continue
+		}
+		if value == nil && !contains(s.Required, name) {
+			continue
+		}
+		problems = append(problems, d.Validate(prop, value, join(path, name))...)
+	}
+	return problems
+}
+
+var patterns sync.Map
+
+// compile caches the schema's patterns, which are checked on every request
+func compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func problem(path, msg string) string {
+	if path == "" {
+		return "body " + msg
+	}
+	return path + " " + msg
+}
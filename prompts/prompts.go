@@ -0,0 +1,264 @@
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Template ids used by the pipeline
+const (
+	Classifier         = "classifier"
+	TicketmasterAction = "ticketmaster_action"
+	Formatter          = "formatter"
+)
+
+// DefaultEnvironment is used when PROMPT_ENV is unset or not in the manifest
+const DefaultEnvironment = "default"
+
+//go:embed templates
+var embedded embed.FS
+
+// Message is one chat message produced by rendering a template
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Rendered is a template rendered for one call, with the id and version it came from
+type Rendered struct {
+	ID       string
+	Version  string
+	Messages []Message
+}
+
+// Ref returns the "id@version" reference recorded alongside responses
+func (r Rendered) Ref() string {
+	return r.ID + "@" + r.Version
+}
+
+// messageTemplate is one parsed message file of a template version
+type messageTemplate struct {
+	role string
+	tmpl *template.Template
+}
+
+// Store holds every template version found in a template tree and the
+// versions selected for one environment.
+//
+// The tree has one directory per template id and one sub-directory per
+// version. Each version directory holds one file per chat message, named
+// NN_role.tmpl and sent in file name order. environments.json at the root
+// maps environment names to the version of each template they use.
+type Store struct {
+	env string
+
+	mu        sync.RWMutex
+	templates map[string]map[string][]messageTemplate
+	selected  map[string]string
+}
+
+// Load parses the template tree in fsys and selects versions for env
+func Load(fsys fs.FS, env string) (*Store, error) {
+	s := &Store{env: env}
+	if err := s.load(fsys); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadEmbedded loads the templates compiled into the binary
+func LoadEmbedded(env string) (*Store, error) {
+	sub, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		return nil, err
+	}
+	return Load(sub, env)
+}
+
+// EnvironmentFromEnv returns the prompt environment named by PROMPT_ENV
+func EnvironmentFromEnv() string {
+	if env := os.Getenv("PROMPT_ENV"); env != "" {
+		return env
+	}
+	return DefaultEnvironment
+}
+
+var (
+	defaultMu    sync.RWMutex
+	defaultStore *Store
+)
+
+// SetDefault replaces the store used by Render
+func SetDefault(s *Store) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultStore = s
+}
+
+// Default returns the store used by Render, loading the embedded templates
+// for PROMPT_ENV on first use
+func Default() *Store {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultStore == nil {
+		s, err := LoadEmbedded(EnvironmentFromEnv())
+		if err != nil {
+			// The embedded tree is part of the binary, so this is a build problem
+			panic(fmt.Sprintf("error loading embedded prompt templates: %v", err))
+		}
+		defaultStore = s
+	}
+	return defaultStore
+}
+
+// Render renders template id from the default store
+func Render(id string, data interface{}) (Rendered, error) {
+	return Default().Render(id, data)
+}
+
+// Render renders the version of template id selected for the store's environment
+func (s *Store) Render(id string, data interface{}) (Rendered, error) {
+	s.mu.RLock()
+	version, ok := s.selected[id]
+	messages := s.templates[id][version]
+	s.mu.RUnlock()
+
+	if !ok {
+		return Rendered{}, fmt.Errorf("no version of prompt template %q selected for environment %q", id, s.env)
+	}
+
+	rendered := Rendered{ID: id, Version: version}
+	for _, m := range messages {
+		var buf bytes.Buffer
+		if err := m.tmpl.Execute(&buf, data); err != nil {
+			return Rendered{}, fmt.Errorf("error rendering prompt template %s@%s: %v", id, version, err)
+		}
+		rendered.Messages = append(rendered.Messages, Message{
+			Role:    m.role,
+			Content: strings.TrimSpace(buf.String()),
+		})
+	}
+	return rendered, nil
+}
+
+// Selected returns the template versions in use, keyed by template id
+func (s *Store) Selected() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(map[string]string, len(s.selected))
+	for id, version := range s.selected {
+		out[id] = version
+	}
+	return out
+}
+
+// load parses the whole tree and swaps it in only if everything is valid
+func (s *Store) load(fsys fs.FS) error {
+	manifestData, err := fs.ReadFile(fsys, "environments.json")
+	if err != nil {
+		return fmt.Errorf("error reading prompt manifest: %v", err)
+	}
+	var manifest map[string]map[string]string
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return fmt.Errorf("error parsing prompt manifest: %v", err)
+	}
+
+	templates := make(map[string]map[string][]messageTemplate)
+	ids, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("error listing prompt templates: %v", err)
+	}
+	for _, id := range ids {
+		if !id.IsDir() {
+			continue
+		}
+		versions, err := fs.ReadDir(fsys, id.Name())
+		if err != nil {
+			return fmt.Errorf("error listing versions of %s: %v", id.Name(), err)
+		}
+		templates[id.Name()] = make(map[string][]messageTemplate)
+		for _, version := range versions {
+			if !version.IsDir() {
+				continue
+			}
+			messages, err := parseVersion(fsys, path.Join(id.Name(), version.Name()))
+			if err != nil {
+				return err
+			}
+			templates[id.Name()][version.Name()] = messages
+		}
+	}
+
+	// Templates the environment does not pin use the default environment's version
+	selected := make(map[string]string)
+	for id, version := range manifest[DefaultEnvironment] {
+		selected[id] = version
+	}
+	for id, version := range manifest[s.env] {
+		selected[id] = version
+	}
+	for id, version := range selected {
+		if _, ok := templates[id][version]; !ok {
+			return fmt.Errorf("prompt template %s@%s is selected but does not exist", id, version)
+		}
+	}
+
+	s.mu.Lock()
+	s.templates = templates
+	s.selected = selected
+	s.mu.Unlock()
+	return nil
+}
+
+// parseVersion parses the message files of one template version
+func parseVersion(fsys fs.FS, dir string) ([]messageTemplate, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %v", dir, err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".tmpl") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var messages []messageTemplate
+	for _, name := range names {
+		role := strings.TrimSuffix(name, ".tmpl")
+		if i := strings.Index(role, "_"); i >= 0 {
+			role = role[i+1:]
+		}
+		if role != "system" && role != "user" && role != "assistant" {
+			return nil, fmt.Errorf("prompt file %s/%s has unknown role %q", dir, name, role)
+		}
+
+		text, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s/%s: %v", dir, name, err)
+		}
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s/%s: %v", dir, name, err)
+		}
+		messages = append(messages, messageTemplate{role: role, tmpl: tmpl})
+	}
+
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("prompt template %s has no messages", dir)
+	}
+	return messages, nil
+}
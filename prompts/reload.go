@@ -0,0 +1,60 @@
+package prompts
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LoadDir loads templates from a directory on disk
+func LoadDir(dir, env string) (*Store, error) {
+	return Load(os.DirFS(dir), env)
+}
+
+// Watch reloads the store from dir whenever a file under it changes, until
+// ctx is cancelled. A tree that fails to parse is logged and the previous
+// templates stay in use.
+func (s *Store) Watch(ctx context.Context, dir string, interval time.Duration, logger *slog.Logger) {
+	last := latestModTime(dir)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := latestModTime(dir)
+		if !current.After(last) {
+			continue
+		}
+		last = current
+
+		if err := s.load(os.DirFS(dir)); err != nil {
+			logger.Error("Error reloading prompt templates, keeping previous versions", "dir", dir, "error", err)
+			continue
+		}
+		logger.Info("Reloaded prompt templates", "dir", dir, "selected", s.Selected())
+	}
+}
+
+// latestModTime returns the newest modification time of any file under dir
+func latestModTime(dir string) time.Time {
+	var latest time.Time
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}
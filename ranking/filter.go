@@ -0,0 +1,73 @@
+package ranking
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go-backend/dates"
+)
+
+// Sale statuses of an activity's "status" field
+const (
+	StatusOnSale      = "onsale"
+	StatusOffSale     = "offsale"
+	StatusCancelled   = "cancelled"
+	StatusRescheduled = "rescheduled"
+	StatusPostponed   = "postponed"
+)
+
+// Filter drops the activities that do not meet the price and availability
+// options in ctx. An activity without a known price is kept under MaxPrice,
+// as it may well be cheap enough; OnSaleNow needs the activity to be on sale
+// and, when its public sale window is known, to be inside it. Anything that
+// is not a formatted activity object is kept.
+func Filter(ctx context.Context, activities []interface{}) []interface{} {
+	opts := OptionsFromContext(ctx)
+	if opts.MaxPrice == nil && !opts.OnSaleNow {
+		return activities
+	}
+	now := dates.Now()
+
+	out := make([]interface{}, 0, len(activities))
+	for _, a := range activities {
+		fields, ok := a.(map[string]interface{})
+		if ok && !matches(fields, opts, now) {
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+func matches(fields map[string]interface{}, opts Options, now time.Time) bool {
+	if opts.MaxPrice != nil {
+		if min, ok := number(fields["price_min"]); ok && min > *opts.MaxPrice {
+			return false
+		}
+	}
+	if opts.OnSaleNow {
+		if str(fields, "status") != StatusOnSale {
+			return false
+		}
+		if start, err := time.Parse(time.RFC3339, str(fields, "onsale_start")); err == nil && now.Before(start) {
+			return false
+		}
+		if end, err := time.Parse(time.RFC3339, str(fields, "onsale_end")); err == nil && !now.Before(end) {
+			return false
+		}
+	}
+	return true
+}
+
+// number reads a price the formatter may have written as a number or a string
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,476 @@
+// Package ranking orders the activities a service returns. It merges
+// duplicates of the same show, groups the dates of events that run more than
+// once, and scores each result by how well it matches the prompt, how soon it
+// is, how far away it is and the user's preferences.
+package ranking
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"go-backend/dates"
+	"go-backend/geo"
+)
+
+// Sort keys a request may ask for
+const (
+	SortRelevance = "relevance"
+	SortDate      = "date"
+	SortDistance  = "distance"
+	SortName      = "name"
+)
+
+// ValidSort reports whether s is a sort key Rank understands. The empty
+// string means SortRelevance.
+func ValidSort(s string) bool {
+	switch s {
+	case "", SortRelevance, SortDate, SortDistance, SortName:
+		return true
+	}
+	return false
+}
+
+// Preferences are terms the user wants more or less of
+type Preferences struct {
+	Like  []string `json:"like,omitempty"`
+	Avoid []string `json:"avoid,omitempty"`
+}
+
+// Options are the per-request ranking choices
+type Options struct {
+	Sort        string
+	Preferences Preferences
+	// MaxPrice drops activities whose cheapest ticket costs more; nil keeps all
+	MaxPrice *float64
+	// OnSaleNow keeps only activities tickets can be bought for right now
+	OnSaleNow bool
+}
+
+type optionsKey struct{}
+
+// WithOptions returns a context carrying the request's ranking options
+func WithOptions(ctx context.Context, opts Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, opts)
+}
+
+// OptionsFromContext returns the request's ranking options, or the defaults
+func OptionsFromContext(ctx context.Context) Options {
+	opts, _ := ctx.Value(optionsKey{}).(Options)
+	return opts
+}
+
+// Weights say how much each signal counts towards an activity's score
+type Weights struct {
+	Relevance  float64
+	Date       float64
+	Distance   float64
+	Preference float64
+}
+
+// DefaultWeights favour matching the prompt, then how soon the event is
+var DefaultWeights = Weights{Relevance: 0.4, Date: 0.3, Distance: 0.2, Preference: 0.1}
+
+// Ranker orders formatted activities
+type Ranker struct {
+	// Geocoder places activities to score distance; nil leaves distance neutral
+	Geocoder geo.Geocoder
+	Weights  Weights
+}
+
+// Occurrence is one date of an event that runs more than once
+type Occurrence struct {
+	Date string `json:"date,omitempty"`
+	Time string `json:"time,omitempty"`
+	Link string `json:"link,omitempty"`
+}
+
+// item is an activity being ranked
+type item struct {
+	fields map[string]interface{}
+	index  int
+
+	name, venue string
+	when        time.Time
+	hasDate     bool
+	occurrences []Occurrence
+
+	km          float64
+	hasDistance bool
+	score       float64
+}
+
+// Rank deduplicates, groups and orders activities for the prompt, using the
+// options, location and date range in ctx. Each activity gets a "score"; grouped
+// events list their "dates", and located ones their "distance_km". Anything
+// that is not a formatted activity object is kept, after the rest.
+func (rk *Ranker) Rank(ctx context.Context, prompt string, activities []interface{}) []interface{} {
+	if rk == nil || len(activities) == 0 {
+		return activities
+	}
+	opts := OptionsFromContext(ctx)
+	now := dates.Now()
+
+	var (
+		items []*item
+		other []interface{}
+	)
+	for i, a := range activities {
+		fields, ok := a.(map[string]interface{})
+		if !ok {
+			other = append(other, a)
+			continue
+		}
+		it := &item{fields: fields, index: i, name: normalize(str(fields, "activity_name")), venue: normalize(str(fields, "location"))}
+		it.when, it.hasDate = parseWhen(str(fields, "date"), str(fields, "time"), dates.TimezoneFromContext(ctx))
+		items = append(items, it)
+	}
+
+	items = group(items, now)
+
+	terms := promptTerms(prompt)
+	origin := geo.FromContext(ctx)
+	dateRange := dates.FromContext(ctx)
+	for _, it := range items {
+		if origin != nil && rk.Geocoder != nil {
+			if loc, ok, err := rk.Geocoder.Geocode(ctx, str(it.fields, "location")); err == nil && ok {
+				it.km = distanceKM(origin.Lat, origin.Lon, loc.Lat, loc.Lon)
+				it.hasDistance = true
+			}
+		}
+
+		w := rk.Weights
+		it.score = w.Relevance*relevance(terms, it) +
+			w.Date*dateScore(it, now, dateRange) +
+			w.Distance*distanceScore(it) +
+			w.Preference*preferenceScore(opts.Preferences, it)
+	}
+
+	sortItems(items, opts.Sort)
+
+	out := make([]interface{}, 0, len(items)+len(other))
+	for _, it := range items {
+		out = append(out, it.output())
+	}
+	return append(out, other...)
+}
+
+// group merges activities with the same name and venue. Exact duplicates
+// collapse into one; different dates become the occurrences of one event,
+// shown at its next upcoming date.
+func group(items []*item, now time.Time) []*item {
+	var out []*item
+	byKey := make(map[string]*item)
+
+	for _, it := range items {
+		key := it.name + "|" + it.venue
+		if it.name == "" {
+			// Nothing to match on; never merge
+			key = fmt.Sprintf("#%d", it.index)
+		}
+		occ := Occurrence{Date: str(it.fields, "date"), Time: str(it.fields, "time"), Link: str(it.fields, "link")}
+
+		first, ok := byKey[key]
+		if !ok {
+			it.occurrences = []Occurrence{occ}
+			byKey[key] = it
+			out = append(out, it)
+			continue
+		}
+
+		if !hasOccurrence(first.occurrences, occ) {
+			first.occurrences = append(first.occurrences, occ)
+		}
+		// Show the group at its next upcoming date, and fill in any fields
+		// the shown entry is missing from the others
+		if it.hasDate && !it.when.Before(now) && (!first.hasDate || first.when.Before(now) || it.when.Before(first.when)) {
+			merged := copyFields(it.fields)
+			fillMissing(merged, first.fields)
+			first.fields, first.when, first.hasDate = merged, it.when, true
+		} else {
+			fillMissing(first.fields, it.fields)
+		}
+	}
+
+	// List each event's dates in order, undated ones last
+	for _, it := range out {
+		sort.SliceStable(it.occurrences, func(i, j int) bool {
+			a, aOK := parseWhen(it.occurrences[i].Date, it.occurrences[i].Time, time.UTC)
+			b, bOK := parseWhen(it.occurrences[j].Date, it.occurrences[j].Time, time.UTC)
+			if aOK != bOK {
+				return aOK
+			}
+			return a.Before(b)
+		})
+	}
+	return out
+}
+
+func hasOccurrence(list []Occurrence, occ Occurrence) bool {
+	for _, o := range list {
+		if normalize(o.Date) == normalize(occ.Date) && normalize(o.Time) == normalize(occ.Time) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortItems(items []*item, key string) {
+	less := func(a, b *item) bool {
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return a.index < b.index
+	}
+	switch key {
+	case SortDate:
+		less = func(a, b *item) bool {
+			if a.hasDate != b.hasDate {
+				return a.hasDate
+			}
+			if !a.when.Equal(b.when) {
+				return a.when.Before(b.when)
+			}
+			return a.score > b.score
+		}
+	case SortDistance:
+		less = func(a, b *item) bool {
+			if a.hasDistance != b.hasDistance {
+				return a.hasDistance
+			}
+			if a.km != b.km {
+				return a.km < b.km
+			}
+			return a.score > b.score
+		}
+	case SortName:
+		less = func(a, b *item) bool {
+			if a.name != b.name {
+				return a.name < b.name
+			}
+			return a.index < b.index
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return less(items[i], items[j]) })
+}
+
+// output returns the activity as sent to the client
+func (it *item) output() map[string]interface{} {
+	out := copyFields(it.fields)
+	out["score"] = math.Round(it.score*1000) / 1000
+	if len(it.occurrences) > 1 {
+		out["dates"] = it.occurrences
+	}
+	if it.hasDistance {
+		out["distance_km"] = math.Round(it.km*10) / 10
+	}
+	return out
+}
+
+// relevance is the share of the prompt's terms found among the activity's words
+func relevance(terms []string, it *item) float64 {
+	if len(terms) == 0 {
+		return 0.5
+	}
+	text := words(str(it.fields, "activity_name") + " " + str(it.fields, "details") + " " + str(it.fields, "location"))
+	matched := 0
+	for _, t := range terms {
+		if hasPhrase(text, []string{stem(t)}) {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(terms))
+}
+
+// dateScore favours events inside the requested range, then sooner ones.
+// Past and undated events score low and neutral.
+func dateScore(it *item, now time.Time, r *dates.Range) float64 {
+	if !it.hasDate {
+		return 0.5
+	}
+	if it.when.Before(now.Add(-12 * time.Hour)) {
+		return 0
+	}
+	if r != nil {
+		if !it.when.Before(r.Start) && it.when.Before(r.End) {
+			return 1
+		}
+		return 0.25
+	}
+	days := math.Max(it.when.Sub(now).Hours()/24, 0)
+	return 1 / (1 + days/7)
+}
+
+// distanceScore halves every 50 km
+func distanceScore(it *item) float64 {
+	if !it.hasDistance {
+		return 0.5
+	}
+	return 1 / (1 + it.km/50)
+}
+
+func preferenceScore(p Preferences, it *item) float64 {
+	if len(p.Like) == 0 && len(p.Avoid) == 0 {
+		return 0.5
+	}
+	text := words(str(it.fields, "activity_name") + " " + str(it.fields, "details"))
+	score := 0.5
+	if len(p.Like) > 0 {
+		score += 0.5 * float64(countIn(text, p.Like)) / float64(len(p.Like))
+	}
+	if countIn(text, p.Avoid) > 0 {
+		score -= 0.5
+	}
+	return math.Max(0, math.Min(1, score))
+}
+
+// countIn counts the terms found as whole words, or runs of words, in text
+func countIn(text []string, terms []string) int {
+	n := 0
+	for _, t := range terms {
+		if hasPhrase(text, words(t)) {
+			n++
+		}
+	}
+	return n
+}
+
+// hasPhrase reports whether phrase occurs in text as consecutive words
+func hasPhrase(text, phrase []string) bool {
+	if len(phrase) == 0 {
+		return false
+	}
+	for i := 0; i+len(phrase) <= len(text); i++ {
+		if equalWords(text[i:i+len(phrase)], phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalWords(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// distanceKM is the great-circle distance between two points
+func distanceKM(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKM = 6371
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKM * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// dateLayouts are the date formats the formatter has been seen to produce
+var dateLayouts = []string{
+	"2006-01-02", "January 2, 2006", "Jan 2, 2006", "2 January 2006",
+	"01/02/2006", "Monday, January 2, 2006",
+}
+
+var timeLayouts = []string{"15:04", "15:04:05", "3:04PM", "3:04 PM", "3PM", "3 PM"}
+
+// parseWhen reads an activity's date and, if it can, its time
+func parseWhen(date, clock string, loc *time.Location) (time.Time, bool) {
+	date = strings.TrimSpace(date)
+	for _, layout := range dateLayouts {
+		d, err := time.ParseInLocation(layout, date, loc)
+		if err != nil {
+			continue
+		}
+		clock = strings.ToUpper(strings.TrimSpace(clock))
+		for _, tl := range timeLayouts {
+			if t, err := time.Parse(tl, clock); err == nil {
+				return d.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute), true
+			}
+		}
+		return d, true
+	}
+	return time.Time{}, false
+}
+
+// stopWords are left out of the prompt's terms: they say nothing about which
+// activity is wanted, or are about dates, which are scored separately
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "any": true, "are": true, "at": true, "can": true, "find": true,
+	"for": true, "from": true, "get": true, "i": true, "in": true, "is": true, "me": true, "my": true,
+	"near": true, "of": true, "on": true, "or": true, "some": true, "the": true, "there": true, "to": true,
+	"want": true, "what": true, "with": true, "around": true, "show": true,
+	"today": true, "tonight": true, "tomorrow": true, "this": true, "next": true, "weekend": true,
+	"week": true, "month": true, "night": true,
+}
+
+// promptTerms returns the prompt's words worth matching against activities
+func promptTerms(prompt string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, w := range strings.Fields(normalize(prompt)) {
+		if len(w) < 3 || stopWords[w] || seen[w] {
+			continue
+		}
+		seen[w] = true
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+// words splits s into normalized, stemmed words for matching
+func words(s string) []string {
+	ws := strings.Fields(normalize(s))
+	for i, w := range ws {
+		ws[i] = stem(w)
+	}
+	return ws
+}
+
+// stem drops a plural "s" so "concerts" matches "concert"
+func stem(w string) string {
+	if len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") {
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+// normalize lowercases s and reduces it to words of letters and digits
+func normalize(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func str(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func copyFields(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m)+3)
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// fillMissing copies into dst the fields src has and dst lacks
+func fillMissing(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if str(dst, k) == "" && str(src, k) != "" {
+			dst[k] = v
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package ranking
+
+import (
+	"context"
+	"testing"
+
+	"go-backend/geo"
+)
+
+func TestRelevance(t *testing.T) {
+	tests := []struct {
+		name   string
+		prompt string
+		fields map[string]interface{}
+		want   float64
+	}{
+		{"whole word", "art exhibits", map[string]interface{}{"activity_name": "Modern Art Exhibit"}, 1},
+		{"plural matches singular", "jazz concerts", map[string]interface{}{"activity_name": "Jazz Concert"}, 1},
+		{"no match inside a word", "art", map[string]interface{}{"activity_name": "Halloween Party"}, 0},
+		{"half the terms", "jazz brunch", map[string]interface{}{"details": "Live jazz all night"}, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := relevance(promptTerms(tt.prompt), &item{fields: tt.fields}); got != tt.want {
+				t.Errorf("relevance = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreferenceScore(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefs  Preferences
+		fields map[string]interface{}
+		want   float64
+	}{
+		{"no preferences", Preferences{}, map[string]interface{}{"activity_name": "Rock Night"}, 0.5},
+		{"liked word", Preferences{Like: []string{"rock"}}, map[string]interface{}{"activity_name": "Rock Night"}, 1},
+		{"liked phrase", Preferences{Like: []string{"Hip Hop"}}, map[string]interface{}{"details": "an evening of hip-hop"}, 1},
+		{"no match inside a word", Preferences{Like: []string{"rock"}}, map[string]interface{}{"activity_name": "Brockton Fair"}, 0.5},
+		{"avoided word", Preferences{Avoid: []string{"comedy"}}, map[string]interface{}{"activity_name": "Comedy Hour"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := preferenceScore(tt.prefs, &item{fields: tt.fields}); got != tt.want {
+				t.Errorf("preferenceScore = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankDistance(t *testing.T) {
+	origin := &geo.Location{Lat: 40.7128, Lon: -74.0060, City: "New York"}
+	ctx := WithOptions(geo.NewContext(context.Background(), origin), Options{Sort: SortDistance})
+
+	rk := &Ranker{Geocoder: geo.DefaultGazetteer(), Weights: DefaultWeights}
+	activities := []interface{}{
+		map[string]interface{}{"activity_name": "Giants Game", "location": "Oracle Park, San Francisco"},
+		map[string]interface{}{"activity_name": "Knicks Game", "location": "Madison Square Garden, New York"},
+		map[string]interface{}{"activity_name": "Mystery Show", "location": "Somewhere"},
+	}
+
+	got := rk.Rank(ctx, "games", activities)
+	var names []string
+	for _, a := range got {
+		names = append(names, a.(map[string]interface{})["activity_name"].(string))
+	}
+	want := []string{"Knicks Game", "Giants Game", "Mystery Show"}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("order = %v, want %v", names, want)
+		}
+	}
+	if km, ok := got[0].(map[string]interface{})["distance_km"].(float64); !ok || km != 0 {
+		t.Errorf("New York distance = %v, want 0", got[0].(map[string]interface{})["distance_km"])
+	}
+	if _, ok := got[1].(map[string]interface{})["distance_km"]; !ok {
+		t.Error("San Francisco was not geocoded")
+	}
+}
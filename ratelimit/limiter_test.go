@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name  string
+		rps   float64
+		burst int
+		// calls are made back to back by one client
+		calls int
+		// idle is how long the bucket is left alone before call idleAt
+		idle      time.Duration
+		idleAt    int
+		wantAllow bool
+		wantWait  time.Duration
+	}{
+		{name: "within burst", rps: 1, burst: 5, calls: 5, wantAllow: true},
+		{name: "over burst", rps: 1, burst: 5, calls: 6, wantWait: time.Second},
+		{name: "wait follows the rate", rps: 4, burst: 2, calls: 3, wantWait: 250 * time.Millisecond},
+		{name: "burst below one is one", rps: 1, burst: 0, calls: 2, wantWait: time.Second},
+		{name: "refills while idle", rps: 1, burst: 2, calls: 3, idle: time.Second, idleAt: 2, wantAllow: true},
+		{name: "refills no more than the burst", rps: 10, burst: 1, calls: 3, idle: time.Hour, idleAt: 1, wantWait: 100 * time.Millisecond},
+		{name: "disabled", rps: 0, burst: 1, calls: 100, wantAllow: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.rps, tt.burst)
+			var allowed bool
+			var wait time.Duration
+			for i := 0; i < tt.calls; i++ {
+				if i == tt.idleAt && tt.idle > 0 {
+					if b, ok := l.buckets["c"]; ok {
+						b.last = b.last.Add(-tt.idle)
+					}
+				}
+				allowed, wait = l.Allow("c")
+			}
+			if allowed != tt.wantAllow {
+				t.Fatalf("allowed = %v, want %v", allowed, tt.wantAllow)
+			}
+			// Time passes between calls, so the wait can be a little shorter
+			if wait > tt.wantWait || wait < tt.wantWait-50*time.Millisecond {
+				t.Errorf("wait = %v, want about %v", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestLimiterClientsAreIndependent(t *testing.T) {
+	l := NewLimiter(1, 1)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first call from a refused")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatal("second call from a allowed")
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("first call from b refused after a emptied its bucket")
+	}
+}
+
+func TestLimiterNil(t *testing.T) {
+	var l *Limiter
+	if ok, _ := l.Allow("c"); !ok {
+		t.Error("nil limiter refused a call")
+	}
+}
+
+func TestLimiterPrune(t *testing.T) {
+	l := NewLimiter(1, 2)
+	l.Allow("idle")
+	l.Allow("busy")
+	l.buckets["idle"].last = time.Now().Add(-time.Hour)
+	l.lastPrune = time.Now().Add(-2 * time.Minute)
+
+	l.Allow("busy")
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("idle bucket kept after a prune")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("busy bucket dropped by a prune")
+	}
+}
@@ -0,0 +1,242 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type contextKey struct{}
+
+// client is the identity and quota tracker attached to a request context
+type client struct {
+	id     string
+	quotas *Quotas
+}
+
+// Config holds the rate limit and quota settings
+type Config struct {
+	RequestsPerSecond float64
+	Burst             int
+	Limits            QuotaLimits
+	// APIKeys are the keys that identify clients; see SetAPIKeys
+	APIKeys []string
+}
+
+// ConfigFromEnv reads the rate limit settings from the environment, falling
+// back to defaults for anything unset or invalid
+func ConfigFromEnv() Config {
+	return Config{
+		RequestsPerSecond: envFloat("RATE_LIMIT_RPS", 1),
+		Burst:             envInt("RATE_LIMIT_BURST", 5),
+		Limits: QuotaLimits{
+			LLMTokens:     envInt("QUOTA_LLM_TOKENS_PER_DAY", 200000),
+			UpstreamCalls: envInt("QUOTA_UPSTREAM_CALLS_PER_DAY", 1000),
+		},
+		APIKeys: envList("API_KEYS"),
+	}
+}
+
+// apiKeys holds the ids of the configured API keys, as a map[string]bool
+var apiKeys atomic.Value
+
+// SetAPIKeys sets the API keys that identify clients. A request with any
+// other key is identified by its IP address, as if it sent none, so a
+// made-up key buys neither a fresh rate limit and quota nor a view of
+// another client's jobs, history or searches.
+func SetAPIKeys(keys []string) {
+	ids := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		ids[keyID(key)] = true
+	}
+	apiKeys.Store(ids)
+}
+
+// ErrRateLimited is returned by Admit when a client is over its request rate
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// Admit counts a request from client id against its request rate and daily
+// quotas. An accepted request's context carries the client identity so the
+// pipeline can charge usage; a rejected one gets ErrRateLimited or
+// ErrQuotaExceeded and how long the client should wait before retrying.
+func Admit(ctx context.Context, limiter *Limiter, quotas *Quotas, id string) (context.Context, time.Duration, error) {
+	if ok, wait := limiter.Allow(id); !ok {
+		return ctx, wait, ErrRateLimited
+	}
+	if quotas.Exhausted(id) {
+		return ctx, time.Until(quotas.ResetAt()), ErrQuotaExceeded
+	}
+	quotas.AddRequest(id)
+	return context.WithValue(ctx, contextKey{}, &client{id: id, quotas: quotas}), 0, nil
+}
+
+// Middleware rejects requests from clients that are over their request rate
+// or daily quota with 429 and a Retry-After header. Accepted requests carry
+// the client identity in their context so the pipeline can charge usage.
+func Middleware(limiter *Limiter, quotas *Quotas) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, wait, err := Admit(r.Context(), limiter, quotas, ClientID(r))
+			switch {
+			case errors.Is(err, ErrRateLimited):
+				TooManyRequests(w, wait, "Rate limit exceeded")
+				return
+			case errors.Is(err, ErrQuotaExceeded):
+				TooManyRequests(w, wait, "Daily quota exceeded")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// TooManyRequests writes a 429 response telling the client when to retry
+func TooManyRequests(w http.ResponseWriter, wait time.Duration, msg string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, msg, http.StatusTooManyRequests)
+}
+
+// RetryAfter returns how long a client that hit ErrQuotaExceeded should wait
+func RetryAfter(ctx context.Context) time.Duration {
+	c, ok := ctx.Value(contextKey{}).(*client)
+	if !ok {
+		return 0
+	}
+	return time.Until(c.quotas.ResetAt())
+}
+
+// ClientID identifies the caller by API key when it sends a configured one,
+// otherwise by remote IP. Keys are hashed so they are never kept or reported
+// in clear text.
+func ClientID(r *http.Request) string {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	return ClientIDFor(key, r.RemoteAddr)
+}
+
+// ClientIDFor identifies a caller by API key, if it is one of those set with
+// SetAPIKeys, otherwise by the host of its remote address
+func ClientIDFor(key, remoteAddr string) string {
+	if key != "" {
+		id := keyID(key)
+		if known, _ := apiKeys.Load().(map[string]bool); known[id] {
+			return id
+		}
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return "ip:" + host
+}
+
+func keyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:8])
+}
+
+// ClientFromContext returns the client id attached by Middleware, if any
+func ClientFromContext(ctx context.Context) (string, bool) {
+	c, ok := ctx.Value(contextKey{}).(*client)
+	if !ok {
+		return "", false
+	}
+	return c.id, true
+}
+
+// CheckLLM returns ErrQuotaExceeded if the request's client is out of LLM tokens.
+// Requests without a client (e.g. internal callers) are never limited.
+func CheckLLM(ctx context.Context) error {
+	c, ok := ctx.Value(contextKey{}).(*client)
+	if !ok {
+		return nil
+	}
+	return c.quotas.CheckLLM(c.id)
+}
+
+// AddLLMTokens charges tokens used by an LLM call to the request's client
+func AddLLMTokens(ctx context.Context, tokens int) {
+	c, ok := ctx.Value(contextKey{}).(*client)
+	if !ok {
+		return
+	}
+	c.quotas.AddLLMTokens(c.id, tokens)
+}
+
+// AddUpstreamCall charges an upstream API call to the request's client, or
+// returns ErrQuotaExceeded if the client has none left
+func AddUpstreamCall(ctx context.Context) error {
+	c, ok := ctx.Value(contextKey{}).(*client)
+	if !ok {
+		return nil
+	}
+	return c.quotas.AddUpstreamCall(c.id)
+}
+
+// UsageReport is the body returned by the usage endpoint
+type UsageReport struct {
+	Client  string      `json:"client"`
+	Usage   Usage       `json:"usage"`
+	Limits  QuotaLimits `json:"limits"`
+	ResetAt time.Time   `json:"reset_at"`
+}
+
+// UsageHandler reports the calling client's usage for the current day
+func UsageHandler(quotas *Quotas) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := ClientID(r)
+		report := UsageReport{
+			Client:  id,
+			Usage:   quotas.Usage(id),
+			Limits:  quotas.Limits(),
+			ResetAt: quotas.ResetAt(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// envList reads a comma separated list, skipping empty entries
+func envList(name string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func envFloat(name string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientID(t *testing.T) {
+	SetAPIKeys([]string{"known-key", "other-key"})
+	t.Cleanup(func() { SetAPIKeys(nil) })
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		remote  string
+		want    string
+	}{
+		{name: "no key", remote: "203.0.113.7:5555", want: "ip:203.0.113.7"},
+		{name: "configured key", headers: map[string]string{"X-API-Key": "known-key"}, remote: "203.0.113.7:5555", want: keyID("known-key")},
+		{name: "configured bearer token", headers: map[string]string{"Authorization": "Bearer other-key"}, remote: "203.0.113.7:5555", want: keyID("other-key")},
+		{name: "X-API-Key wins over the bearer token", headers: map[string]string{"X-API-Key": "known-key", "Authorization": "Bearer other-key"}, remote: "203.0.113.7:5555", want: keyID("known-key")},
+		{name: "unknown key", headers: map[string]string{"X-API-Key": "made-up"}, remote: "203.0.113.7:5555", want: "ip:203.0.113.7"},
+		{name: "unknown bearer token", headers: map[string]string{"Authorization": "Bearer made-up"}, remote: "[2001:db8::1]:443", want: "ip:2001:db8::1"},
+		{name: "remote address without a port", remote: "203.0.113.7", want: "ip:203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/usage", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			r.RemoteAddr = tt.remote
+			got := ClientID(r)
+			if got != tt.want {
+				t.Errorf("ClientID = %q, want %q", got, tt.want)
+			}
+			if strings.Contains(got, "known-key") || strings.Contains(got, "other-key") {
+				t.Errorf("ClientID = %q reveals the key", got)
+			}
+		})
+	}
+}
+
+func TestClientIDWithoutKeys(t *testing.T) {
+	SetAPIKeys(nil)
+	if got := ClientIDFor("any-key", "198.51.100.2:80"); got != "ip:198.51.100.2" {
+		t.Errorf("ClientIDFor with no configured keys = %q, want the IP", got)
+	}
+}
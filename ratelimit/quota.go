@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded is returned when a client has used up one of its daily quotas
+var ErrQuotaExceeded = errors.New("daily quota exceeded")
+
+// QuotaLimits are the per-client daily limits. Zero means unlimited.
+type QuotaLimits struct {
+	LLMTokens     int `json:"llm_tokens"`
+	UpstreamCalls int `json:"upstream_calls"`
+}
+
+// Usage is what a single client has consumed during the current day
+type Usage struct {
+	Requests      int `json:"requests"`
+	LLMTokens     int `json:"llm_tokens"`
+	UpstreamCalls int `json:"upstream_calls"`
+}
+
+// Quotas tracks daily usage per client. Counters reset at midnight UTC.
+type Quotas struct {
+	limits QuotaLimits
+
+	mu    sync.Mutex
+	day   string
+	usage map[string]*Usage
+}
+
+// NewQuotas creates a quota tracker enforcing the given limits
+func NewQuotas(limits QuotaLimits) *Quotas {
+	return &Quotas{
+		limits: limits,
+		usage:  make(map[string]*Usage),
+	}
+}
+
+// Limits returns the configured daily limits
+func (q *Quotas) Limits() QuotaLimits {
+	return q.limits
+}
+
+// ResetAt returns when the current quota window ends
+func (q *Quotas) ResetAt() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+// Usage returns a copy of the client's usage for today
+func (q *Quotas) Usage(client string) Usage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return *q.entry(client)
+}
+
+// Exhausted reports whether any of the client's quotas is used up
+func (q *Quotas) Exhausted(client string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.entry(client)
+	return (q.limits.LLMTokens > 0 && u.LLMTokens >= q.limits.LLMTokens) ||
+		(q.limits.UpstreamCalls > 0 && u.UpstreamCalls >= q.limits.UpstreamCalls)
+}
+
+// AddRequest counts an inbound request for the client
+func (q *Quotas) AddRequest(client string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.entry(client).Requests++
+}
+
+// CheckLLM returns ErrQuotaExceeded if the client has no LLM tokens left
+func (q *Quotas) CheckLLM(client string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.limits.LLMTokens > 0 && q.entry(client).LLMTokens >= q.limits.LLMTokens {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// AddLLMTokens charges tokens consumed by an LLM call to the client
+func (q *Quotas) AddLLMTokens(client string, tokens int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.entry(client).LLMTokens += tokens
+}
+
+// AddUpstreamCall charges one upstream API call to the client, or returns
+// ErrQuotaExceeded without charging if the quota is already used up
+func (q *Quotas) AddUpstreamCall(client string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.entry(client)
+	if q.limits.UpstreamCalls > 0 && u.UpstreamCalls >= q.limits.UpstreamCalls {
+		return ErrQuotaExceeded
+	}
+	u.UpstreamCalls++
+	return nil
+}
+
+// entry returns the client's usage, rolling the window over first if the day
+// has changed. Caller holds q.mu.
+func (q *Quotas) entry(client string) *Usage {
+	today := time.Now().UTC().Format("2006-01-02")
+	if q.day != today {
+		q.day = today
+		q.usage = make(map[string]*Usage)
+	}
+
+	u, ok := q.usage[client]
+	if !ok {
+		u = &Usage{}
+		q.usage[client] = u
+	}
+	return u
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuotas(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits QuotaLimits
+		tokens int
+		calls  int
+		// wantCalls is how many of the calls were charged
+		wantCalls     int
+		wantLLMErr    error
+		wantExhausted bool
+	}{
+		{name: "unlimited", tokens: 1e6, calls: 1000, wantCalls: 1000},
+		{name: "under both limits", limits: QuotaLimits{LLMTokens: 100, UpstreamCalls: 5}, tokens: 99, calls: 4, wantCalls: 4},
+		{name: "tokens used up", limits: QuotaLimits{LLMTokens: 100}, tokens: 100, calls: 3, wantCalls: 3, wantLLMErr: ErrQuotaExceeded, wantExhausted: true},
+		{name: "tokens overshoot", limits: QuotaLimits{LLMTokens: 100}, tokens: 250, wantLLMErr: ErrQuotaExceeded, wantExhausted: true},
+		{name: "calls stop at the limit", limits: QuotaLimits{UpstreamCalls: 3}, calls: 5, wantCalls: 3, wantExhausted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQuotas(tt.limits)
+			q.AddRequest("c")
+			q.AddLLMTokens("c", tt.tokens)
+			var callErrs int
+			for i := 0; i < tt.calls; i++ {
+				if err := q.AddUpstreamCall("c"); err != nil {
+					if !errors.Is(err, ErrQuotaExceeded) {
+						t.Fatalf("AddUpstreamCall err = %v", err)
+					}
+					callErrs++
+				}
+			}
+			if callErrs != tt.calls-tt.wantCalls {
+				t.Errorf("%d calls refused, want %d", callErrs, tt.calls-tt.wantCalls)
+			}
+
+			want := Usage{Requests: 1, LLMTokens: tt.tokens, UpstreamCalls: tt.wantCalls}
+			if got := q.Usage("c"); got != want {
+				t.Errorf("usage = %+v, want %+v", got, want)
+			}
+			if err := q.CheckLLM("c"); !errors.Is(err, tt.wantLLMErr) || (tt.wantLLMErr == nil && err != nil) {
+				t.Errorf("CheckLLM err = %v, want %v", err, tt.wantLLMErr)
+			}
+			if got := q.Exhausted("c"); got != tt.wantExhausted {
+				t.Errorf("exhausted = %v, want %v", got, tt.wantExhausted)
+			}
+			if q.Exhausted("other") || q.Usage("other") != (Usage{}) {
+				t.Error("another client was charged")
+			}
+		})
+	}
+}
+
+func TestQuotasRollOver(t *testing.T) {
+	q := NewQuotas(QuotaLimits{LLMTokens: 10})
+	q.AddLLMTokens("c", 10)
+	q.day = "2000-01-01"
+	if q.Exhausted("c") {
+		t.Error("yesterday's usage counted today")
+	}
+}
+
+func TestQuotasResetAt(t *testing.T) {
+	reset := NewQuotas(QuotaLimits{}).ResetAt()
+	if reset.Hour() != 0 || reset.Minute() != 0 || reset.Location() != time.UTC {
+		t.Errorf("reset at %v, want midnight UTC", reset)
+	}
+	if until := time.Until(reset); until <= 0 || until > 24*time.Hour {
+		t.Errorf("reset in %v, want within a day", until)
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter *Limiter
+		limits  QuotaLimits
+		tokens  int
+		wantErr error
+	}{
+		{name: "admitted", limiter: NewLimiter(1, 1)},
+		{name: "rate limited", limiter: NewLimiter(1, 0), wantErr: ErrRateLimited},
+		{name: "quota exhausted", limiter: NewLimiter(0, 1), limits: QuotaLimits{LLMTokens: 5}, tokens: 5, wantErr: ErrQuotaExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQuotas(tt.limits)
+			q.AddLLMTokens("c", tt.tokens)
+			if tt.wantErr == ErrRateLimited {
+				tt.limiter.Allow("c")
+			}
+			ctx, wait, err := Admit(context.Background(), tt.limiter, q, "c")
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if wait <= 0 {
+					t.Errorf("wait = %v, want a positive wait", wait)
+				}
+				return
+			}
+			if id, ok := ClientFromContext(ctx); !ok || id != "c" {
+				t.Errorf("client = %q, %v; want c", id, ok)
+			}
+			if q.Usage("c").Requests != 1 {
+				t.Error("admitted request not counted")
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Mode selects how upstream HTTP traffic is handled
+type Mode string
+
+const (
+	// ModeLive sends requests upstream without touching fixtures
+	ModeLive Mode = "live"
+	// ModeRecord sends requests upstream and saves each exchange as a fixture
+	ModeRecord Mode = "record"
+	// ModeReplay serves responses from fixtures and never touches the network
+	ModeReplay Mode = "replay"
+)
+
+// DefaultDir is where fixtures live unless UPSTREAM_FIXTURES_DIR says otherwise
+const DefaultDir = "testdata/fixtures"
+
+// secretParams are query parameters left out of fixture keys and files
+var secretParams = []string{"apikey", "api_key", "key", "token"}
+
+// ModeFromEnv returns the mode named by UPSTREAM_MODE, defaulting to live
+func ModeFromEnv() Mode {
+	switch Mode(strings.ToLower(os.Getenv("UPSTREAM_MODE"))) {
+	case ModeRecord:
+		return ModeRecord
+	case ModeReplay:
+		return ModeReplay
+	default:
+		return ModeLive
+	}
+}
+
+// DirFromEnv returns the fixture directory named by UPSTREAM_FIXTURES_DIR
+func DirFromEnv() string {
+	if dir := os.Getenv("UPSTREAM_FIXTURES_DIR"); dir != "" {
+		return dir
+	}
+	return DefaultDir
+}
+
+// Fixture is a recorded request/response pair as stored on disk
+type Fixture struct {
+	Request  FixtureRequest  `json:"request"`
+	Response FixtureResponse `json:"response"`
+}
+
+// FixtureRequest is the recorded request, with secrets stripped
+type FixtureRequest struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// FixtureResponse is the recorded response. JSON bodies are stored inline in
+// Body so fixtures stay readable; anything else is kept verbatim in Text.
+type FixtureResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	Text    string            `json:"text,omitempty"`
+}
+
+// Transport is an http.RoundTripper that records upstream exchanges to
+// fixture files or replays them, depending on its mode
+type Transport struct {
+	Mode Mode
+	Dir  string
+	Next http.RoundTripper
+}
+
+// NewTransport returns a transport in mode reading and writing fixtures in dir
+func NewTransport(mode Mode, dir string) *Transport {
+	return &Transport{Mode: mode, Dir: dir, Next: http.DefaultTransport}
+}
+
+// NewClient returns an HTTP client using a transport in mode
+func NewClient(mode Mode, dir string) *http.Client {
+	return &http.Client{Transport: NewTransport(mode, dir)}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Mode == ModeLive || t.Mode == "" {
+		return t.Next.RoundTrip(req)
+	}
+
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	fixtureReq := FixtureRequest{
+		Method: req.Method,
+		URL:    stripSecrets(req.URL),
+		Body:   canonicalJSON(body),
+	}
+	path := filepath.Join(t.Dir, req.URL.Host, key(fixtureReq)+".json")
+
+	if t.Mode == ModeReplay {
+		return t.replay(req, path)
+	}
+	return t.record(req, fixtureReq, path)
+}
+
+func (t *Transport) replay(req *http.Request, path string) (*http.Response, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no fixture for %s %s (expected %s): %v", req.Method, stripSecrets(req.URL), path, err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("error parsing fixture %s: %v", path, err)
+	}
+
+	header := make(http.Header)
+	for k, v := range fixture.Response.Headers {
+		header.Set(k, v)
+	}
+
+	body := []byte(fixture.Response.Text)
+	if len(fixture.Response.Body) > 0 {
+		body = fixture.Response.Body
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Response.Status, http.StatusText(fixture.Response.Status)),
+		StatusCode:    fixture.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *Transport) record(req *http.Request, fixtureReq FixtureRequest, path string) (*http.Response, error) {
+	resp, err := t.Next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading response to record: %v", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	fixture := Fixture{
+		Request: fixtureReq,
+		Response: FixtureResponse{
+			Status:  resp.StatusCode,
+			Headers: map[string]string{"Content-Type": resp.Header.Get("Content-Type")},
+		},
+	}
+	if json.Valid(respBody) {
+		fixture.Response.Body = respBody
+	} else {
+		fixture.Response.Text = string(respBody)
+	}
+
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding fixture: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating fixture directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return nil, fmt.Errorf("error writing fixture: %v", err)
+	}
+
+	return resp, nil
+}
+
+// readBody drains the request body and puts a fresh reader back in its place
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading request body: %v", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// stripSecrets returns the URL without API key style query parameters
+func stripSecrets(u *url.URL) string {
+	clean := *u
+	q := clean.Query()
+	for _, param := range secretParams {
+		q.Del(param)
+	}
+	clean.RawQuery = q.Encode()
+	return clean.String()
+}
+
+// canonicalJSON re-encodes a JSON body with sorted keys so logically equal
+// requests map to the same fixture
+func canonicalJSON(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return rawBody(body)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return rawBody(body)
+	}
+	return out
+}
+
+// rawBody quotes a non-JSON request body so it can sit in the fixture's body field
+func rawBody(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return body
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+// key derives the fixture file name from the request
+func key(r FixtureRequest) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL + "\n"))
+	h.Write(r.Body)
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
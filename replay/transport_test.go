@@ -0,0 +1,88 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecordThenReplay(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"path":"`+r.URL.Path+`"}`)
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	recorder := NewClient(ModeRecord, dir)
+	replayer := NewClient(ModeReplay, dir)
+
+	tests := []struct {
+		name         string
+		method, path string
+		body         string
+		// replayPath and replayBody default to path and body
+		replayPath, replayBody string
+		want                   string
+		wantMiss               bool
+	}{
+		{name: "get", method: "GET", path: "/events.json?keyword=jazz", want: `{"path":"/events.json"}`},
+		{name: "secrets are not part of the key", method: "GET", path: "/events.json?keyword=rock&apikey=one", replayPath: "/events.json?keyword=rock&apikey=two", want: `{"path":"/events.json"}`},
+		{name: "json key order is not part of the key", method: "POST", path: "/chat", body: `{"a":1,"b":2}`, replayBody: `{"b":2,"a":1}`, want: `{"path":"/chat"}`},
+		{name: "other query", method: "GET", path: "/events.json?keyword=blues", replayPath: "/events.json?keyword=folk", wantMiss: true},
+		{name: "other body", method: "POST", path: "/chat", body: `{"a":1}`, replayBody: `{"a":2}`, wantMiss: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := do(recorder, tt.method, upstream.URL+tt.path, tt.body); err != nil {
+				t.Fatalf("record: %v", err)
+			}
+			path, body := tt.path, tt.body
+			if tt.replayPath != "" {
+				path = tt.replayPath
+			}
+			if tt.replayBody != "" {
+				body = tt.replayBody
+			}
+			got, err := do(replayer, tt.method, upstream.URL+path, body)
+			if tt.wantMiss {
+				if err == nil {
+					t.Fatalf("replay = %s, want a missing fixture", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("replay: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("replay = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func do(client *http.Client, method, url, body string) (string, error) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	// Recorded bodies are stored indented
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return "", err
+	}
+	return compact.String(), nil
+}
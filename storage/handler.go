@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"go-backend/admin"
+	"go-backend/logging"
+	"go-backend/ratelimit"
+)
+
+// Handler serves the prompt history
+type Handler struct {
+	Repo Repository
+	// AdminKey, sent in the admin.KeyHeader, lets the caller read every
+	// client's history rather than only their own
+	AdminKey string
+}
+
+// NewHandler returns a Handler for repo, reading the admin key from HISTORY_ADMIN_KEY
+func NewHandler(repo Repository) *Handler {
+	return &Handler{Repo: repo, AdminKey: os.Getenv("HISTORY_ADMIN_KEY")}
+}
+
+// HistoryResponse is the body returned by List
+type HistoryResponse struct {
+	Records []PromptRecord `json:"records"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+}
+
+// List serves GET /history. Query parameters: service, from and to (RFC 3339
+// times or YYYY-MM-DD dates, to is exclusive), limit and offset. Admins may
+// also pass client to see another client's history, or client=* for everyone's.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := Query{Client: ratelimit.ClientID(r), Service: params.Get("service")}
+
+	if client := params.Get("client"); client != "" {
+		if !h.isAdmin(r) {
+			http.Error(w, "Only admins may query other clients", http.StatusForbidden)
+			return
+		}
+		q.Client = client
+		if client == "*" {
+			q.Client = ""
+		}
+	}
+
+	var err error
+	if q.From, err = parseTime(params.Get("from")); err != nil {
+		http.Error(w, "Invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.To, err = parseTime(params.Get("to")); err != nil {
+		http.Error(w, "Invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Limit, err = parseInt(params.Get("limit")); err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	if q.Offset, err = parseInt(params.Get("offset")); err != nil {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	records, err := h.Repo.ListPrompts(r.Context(), q)
+	if err != nil {
+		logging.FromContext(r.Context()).ErrorContext(r.Context(), "Error querying history", "error", err)
+		http.Error(w, "Failed to query history", http.StatusInternalServerError)
+		return
+	}
+	if records == nil {
+		records = []PromptRecord{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HistoryResponse{Records: records, Limit: clampLimit(q.Limit), Offset: q.Offset})
+}
+
+// Get serves GET /history/{id}. Records are only visible to the client that
+// sent the prompt, and to admins.
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	rec, ok, err := h.Repo.GetPrompt(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		logging.FromContext(r.Context()).ErrorContext(r.Context(), "Error reading history", "error", err)
+		http.Error(w, "Failed to read history", http.StatusInternalServerError)
+		return
+	}
+	if !ok || (rec.Client != ratelimit.ClientID(r) && !h.isAdmin(r)) {
+		http.Error(w, "Record not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
+
+func (h *Handler) isAdmin(r *http.Request) bool {
+	return admin.Authorized(r, h.AdminKey)
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func parseInt(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err == nil && n < 0 {
+		err = strconv.ErrRange
+	}
+	return n, err
+}
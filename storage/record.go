@@ -0,0 +1,86 @@
+// Package storage keeps a history of the prompts the server has handled: the
+// classifier's rankings, the action each service resolved, upstream status,
+// the formatted activities and how long each step took. Records are written
+// through a Repository, SQLite by default.
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// PromptRecord is everything recorded about one prompt
+type PromptRecord struct {
+	ID        string    `json:"id"`
+	RequestID string    `json:"request_id,omitempty"`
+	Client    string    `json:"client"`
+	Prompt    string    `json:"prompt"`
+	CreatedAt time.Time `json:"created_at"`
+	// Status is the HTTP status the prompt was (or would have been) answered with
+	Status           int              `json:"status"`
+	Error            string           `json:"error,omitempty"`
+	DurationMS       int64            `json:"duration_ms"`
+	ClassificationMS int64            `json:"classification_ms"`
+	Rankings         []Ranking        `json:"rankings,omitempty"`
+	Services         []*ServiceRecord `json:"services,omitempty"`
+	LLMTokens        int              `json:"llm_tokens"`
+	CostUSD          float64          `json:"cost_usd"`
+}
+
+// Ranking is one of the classifier's applicability scores
+type Ranking struct {
+	Service       string `json:"service"`
+	Applicability int    `json:"applicability"`
+}
+
+// ServiceRecord is what happened for one ranked service
+type ServiceRecord struct {
+	Service       string `json:"service"`
+	Applicability int    `json:"applicability"`
+	// Routed is false for services skipped as below the threshold
+	Routed bool    `json:"routed"`
+	Action *Action `json:"action,omitempty"`
+	// UpstreamStatus is the upstream API's HTTP status, 0 if it was not called
+	UpstreamStatus int   `json:"upstream_status,omitempty"`
+	UpstreamShared bool  `json:"upstream_shared,omitempty"`
+	UpstreamMS     int64 `json:"upstream_ms,omitempty"`
+	ActivityCount  int   `json:"activity_count"`
+	// Activities are the formatted results as returned to the client
+	Activities json.RawMessage `json:"activities,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	DurationMS int64           `json:"duration_ms"`
+	LLMTokens  int             `json:"llm_tokens"`
+	CostUSD    float64         `json:"cost_usd"`
+}
+
+// Action is the upstream action a service resolved the prompt to
+type Action struct {
+	Action     string            `json:"action"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// Query selects prompt records. Zero fields are not filtered on.
+type Query struct {
+	Client string
+	// Service matches prompts routed to the service
+	Service string
+	From    time.Time
+	To      time.Time
+	Limit   int
+	Offset  int
+}
+
+// DefaultLimit and MaxLimit bound the records returned by one query
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// NewID returns a random id for a prompt record
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
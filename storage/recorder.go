@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go-backend/usage"
+)
+
+// Recorder collects a PromptRecord as the prompt moves through the pipeline.
+// Pipeline stages deep in the call stack report into it through the context.
+type Recorder struct {
+	mu    sync.Mutex
+	rec   PromptRecord
+	start time.Time
+}
+
+type recorderKey struct{}
+
+// NewContext returns a context carrying a fresh recorder
+func NewContext(ctx context.Context) (context.Context, *Recorder) {
+	r := &Recorder{start: time.Now()}
+	r.rec.CreatedAt = r.start.UTC()
+	return context.WithValue(ctx, recorderKey{}, r), r
+}
+
+// FromContext returns the recorder attached to ctx, or nil if there is none
+func FromContext(ctx context.Context) *Recorder {
+	r, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return r
+}
+
+// SetPrompt records the prompt and who sent it
+func (r *Recorder) SetPrompt(prompt, client, requestID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rec.Prompt = prompt
+	r.rec.Client = client
+	r.rec.RequestID = requestID
+}
+
+// SetRankings records the classifier's scores and how long classification took
+func (r *Recorder) SetRankings(rankings []Ranking, took time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rec.Rankings = rankings
+	r.rec.ClassificationMS = took.Milliseconds()
+}
+
+// Service updates the record for a service, creating it on first use
+func (r *Recorder) Service(name string, fn func(s *ServiceRecord)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(r.service(name))
+}
+
+// service returns the record for name. Caller holds r.mu.
+func (r *Recorder) service(name string) *ServiceRecord {
+	for _, s := range r.rec.Services {
+		if s.Service == name {
+			return s
+		}
+	}
+	s := &ServiceRecord{Service: name}
+	r.rec.Services = append(r.rec.Services, s)
+	return s
+}
+
+// Finish completes the record with the outcome and LLM usage and returns it
+func (r *Recorder) Finish(status int, errMsg string, ledger *usage.Ledger) PromptRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rec.Status = status
+	r.rec.Error = errMsg
+	r.rec.DurationMS = time.Since(r.start).Milliseconds()
+	if ledger != nil {
+		summary := ledger.Summary()
+		r.rec.LLMTokens = summary.TotalTokens
+		r.rec.CostUSD = summary.CostUSD
+		for _, s := range r.rec.Services {
+			if sum := ledger.ServiceSummary(s.Service); sum != nil {
+				s.LLMTokens = sum.TotalTokens
+				s.CostUSD = sum.CostUSD
+			}
+		}
+	}
+
+	// Hand back a copy so later changes cannot race with the write
+	rec := r.rec
+	rec.Services = make([]*ServiceRecord, len(r.rec.Services))
+	for i, s := range r.rec.Services {
+		copied := *s
+		rec.Services[i] = &copied
+	}
+	return rec
+}
+
+// RecordAction records the upstream action resolved for the service ctx is tagged with
+func RecordAction(ctx context.Context, action string, params map[string]string) {
+	if r := FromContext(ctx); r != nil {
+		copied := make(map[string]string, len(params))
+		for k, v := range params {
+			copied[k] = v
+		}
+		r.Service(usage.ServiceFromContext(ctx), func(s *ServiceRecord) {
+			s.Action = &Action{Action: action, Parameters: copied}
+		})
+	}
+}
+
+// RecordUpstream records an upstream call's status and latency for the
+// service ctx is tagged with
+func RecordUpstream(ctx context.Context, status int, took time.Duration) {
+	if r := FromContext(ctx); r != nil {
+		r.Service(usage.ServiceFromContext(ctx), func(s *ServiceRecord) {
+			s.UpstreamStatus = status
+			s.UpstreamMS = took.Milliseconds()
+		})
+	}
+}
+
+// RecordSharedUpstream records that the service's upstream response was
+// shared from an identical call made for another prompt in the batch
+func RecordSharedUpstream(ctx context.Context) {
+	if r := FromContext(ctx); r != nil {
+		r.Service(usage.ServiceFromContext(ctx), func(s *ServiceRecord) {
+			s.UpstreamShared = true
+		})
+	}
+}
+
+// RecordActivities records the formatted activities returned for a service
+func RecordActivities(ctx context.Context, activities []interface{}) {
+	if r := FromContext(ctx); r != nil {
+		data, _ := json.Marshal(activities)
+		r.Service(usage.ServiceFromContext(ctx), func(s *ServiceRecord) {
+			s.ActivityCount = len(activities)
+			s.Activities = data
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrDisabled is returned by FromEnv when STORAGE_DRIVER is "none"
+var ErrDisabled = errors.New("storage is disabled")
+
+// Repository stores and queries prompt records and saved searches
+type Repository interface {
+	// SavePrompt stores a record, replacing any with the same id
+	SavePrompt(ctx context.Context, rec PromptRecord) error
+	// GetPrompt returns the record with the given id; ok is false if there is none
+	GetPrompt(ctx context.Context, id string) (rec PromptRecord, ok bool, err error)
+	// ListPrompts returns the records matching q, newest first
+	ListPrompts(ctx context.Context, q Query) ([]PromptRecord, error)
+
+	// SaveSearch creates or replaces a saved search
+	SaveSearch(ctx context.Context, search SavedSearch) error
+	// GetSearch returns the saved search with the given id; ok is false if there is none
+	GetSearch(ctx context.Context, id string) (search SavedSearch, ok bool, err error)
+	// ListSearches returns a client's saved searches, oldest first
+	ListSearches(ctx context.Context, client string) ([]SavedSearch, error)
+	// DueSearches returns the saved searches due to run at now
+	DueSearches(ctx context.Context, now time.Time) ([]SavedSearch, error)
+	// DeleteSearch removes a saved search, if it exists
+	DeleteSearch(ctx context.Context, id string) error
+
+	Close() error
+}
+
+// DefaultSQLitePath is where the history database lives unless STORAGE_DSN says otherwise
+const DefaultSQLitePath = "data/history.db"
+
+// FromEnv opens the repository named by STORAGE_DRIVER ("sqlite", the
+// default, or "none") at STORAGE_DSN. It returns ErrDisabled for "none".
+func FromEnv() (Repository, error) {
+	driver := os.Getenv("STORAGE_DRIVER")
+	dsn := os.Getenv("STORAGE_DSN")
+
+	switch driver {
+	case "", "sqlite":
+		if dsn == "" {
+			dsn = DefaultSQLitePath
+		}
+		return OpenSQLite(dsn)
+	case "none":
+		return nil, ErrDisabled
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SavedSearch is a resolved Ticketmaster search a client wants re-run
+// periodically and be told about new events from
+type SavedSearch struct {
+	ID     string `json:"id"`
+	Client string `json:"-"`
+	Name   string `json:"name"`
+	// Prompt is what the search was resolved from, if it was created from one
+	Prompt string `json:"prompt,omitempty"`
+	// Timezone is the IANA timezone the prompt's dates, like "this weekend",
+	// are worked out in each time the search runs
+	Timezone string        `json:"timezone,omitempty"`
+	Action   Action        `json:"action"`
+	Interval time.Duration `json:"-"`
+	// NotifyURL, if set, receives a signed POST for every run that finds new events
+	NotifyURL string    `json:"notify_url,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// LastRunAt is when the search last ran successfully
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt time.Time  `json:"next_run_at"`
+	LastError string     `json:"last_error,omitempty"`
+	// SeenIDs are the event ids already reported, newest first
+	SeenIDs []string `json:"-"`
+}
+
+// MaxSeenIDs bounds the event ids remembered per saved search
+const MaxSeenIDs = 1000
+
+func (s *SQLite) SaveSearch(ctx context.Context, search SavedSearch) error {
+	params, err := json.Marshal(search.Action.Parameters)
+	if err != nil {
+		return err
+	}
+	seen, err := json.Marshal(search.SeenIDs)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO saved_searches
+			(id, client, name, prompt, timezone, action, parameters, interval_s, notify_url, created_at, last_run_at, next_run_at, last_error, seen_ids)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		search.ID, search.Client, search.Name, search.Prompt, search.Timezone, search.Action.Action, string(params),
+		int64(search.Interval/time.Second), search.NotifyURL, search.CreatedAt.UnixMilli(), unixMilli(search.LastRunAt),
+		search.NextRunAt.UnixMilli(), search.LastError, string(seen))
+	if err != nil {
+		return fmt.Errorf("error saving search: %v", err)
+	}
+	return nil
+}
+
+const searchColumns = `id, client, name, prompt, timezone, action, parameters, interval_s, notify_url, created_at, last_run_at, next_run_at, last_error, seen_ids`
+
+func (s *SQLite) GetSearch(ctx context.Context, id string) (SavedSearch, bool, error) {
+	searches, err := s.querySearches(ctx, `SELECT `+searchColumns+` FROM saved_searches WHERE id = ?`, id)
+	if err != nil || len(searches) == 0 {
+		return SavedSearch{}, false, err
+	}
+	return searches[0], true, nil
+}
+
+func (s *SQLite) ListSearches(ctx context.Context, client string) ([]SavedSearch, error) {
+	return s.querySearches(ctx, `SELECT `+searchColumns+` FROM saved_searches WHERE client = ? ORDER BY created_at, id`, client)
+}
+
+func (s *SQLite) DueSearches(ctx context.Context, now time.Time) ([]SavedSearch, error) {
+	return s.querySearches(ctx, `SELECT `+searchColumns+` FROM saved_searches WHERE next_run_at <= ? ORDER BY next_run_at`, now.UnixMilli())
+}
+
+func (s *SQLite) DeleteSearch(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM saved_searches WHERE id = ?`, id)
+	return err
+}
+
+func (s *SQLite) querySearches(ctx context.Context, query string, args ...interface{}) ([]SavedSearch, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SavedSearch
+	for rows.Next() {
+		var (
+			search                          SavedSearch
+			params, seen                    string
+			interval                        int64
+			createdAt, lastRunAt, nextRunAt int64
+		)
+		if err := rows.Scan(&search.ID, &search.Client, &search.Name, &search.Prompt, &search.Timezone, &search.Action.Action, &params,
+			&interval, &search.NotifyURL, &createdAt, &lastRunAt, &nextRunAt, &search.LastError, &seen); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(params), &search.Action.Parameters); err != nil {
+			return nil, fmt.Errorf("search %s: %v", search.ID, err)
+		}
+		if err := json.Unmarshal([]byte(seen), &search.SeenIDs); err != nil {
+			return nil, fmt.Errorf("search %s: %v", search.ID, err)
+		}
+		search.Interval = time.Duration(interval) * time.Second
+		search.CreatedAt = time.UnixMilli(createdAt).UTC()
+		if lastRunAt != 0 {
+			t := time.UnixMilli(lastRunAt).UTC()
+			search.LastRunAt = &t
+		}
+		search.NextRunAt = time.UnixMilli(nextRunAt).UTC()
+		out = append(out, search)
+	}
+	return out, rows.Err()
+}
+
+// unixMilli stores a missing time as 0
+func unixMilli(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.UnixMilli()
+}
@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS prompts (
+	id                TEXT PRIMARY KEY,
+	request_id        TEXT NOT NULL DEFAULT '',
+	client            TEXT NOT NULL,
+	prompt            TEXT NOT NULL,
+	created_at        INTEGER NOT NULL,
+	status            INTEGER NOT NULL,
+	error             TEXT NOT NULL DEFAULT '',
+	duration_ms       INTEGER NOT NULL,
+	classification_ms INTEGER NOT NULL,
+	rankings          TEXT NOT NULL DEFAULT '[]',
+	llm_tokens        INTEGER NOT NULL DEFAULT 0,
+	cost_usd          REAL NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS prompts_client_created ON prompts (client, created_at);
+CREATE INDEX IF NOT EXISTS prompts_created ON prompts (created_at);
+
+CREATE TABLE IF NOT EXISTS prompt_services (
+	prompt_id       TEXT NOT NULL REFERENCES prompts (id) ON DELETE CASCADE,
+	position        INTEGER NOT NULL,
+	service         TEXT NOT NULL,
+	applicability   INTEGER NOT NULL,
+	routed          INTEGER NOT NULL,
+	action          TEXT NOT NULL DEFAULT '',
+	parameters      TEXT NOT NULL DEFAULT '{}',
+	upstream_status INTEGER NOT NULL DEFAULT 0,
+	upstream_shared INTEGER NOT NULL DEFAULT 0,
+	upstream_ms     INTEGER NOT NULL DEFAULT 0,
+	activity_count  INTEGER NOT NULL DEFAULT 0,
+	activities      TEXT NOT NULL DEFAULT '',
+	error           TEXT NOT NULL DEFAULT '',
+	duration_ms     INTEGER NOT NULL DEFAULT 0,
+	llm_tokens      INTEGER NOT NULL DEFAULT 0,
+	cost_usd        REAL NOT NULL DEFAULT 0,
+	PRIMARY KEY (prompt_id, position)
+);
+CREATE INDEX IF NOT EXISTS prompt_services_service ON prompt_services (service, routed);
+
+CREATE TABLE IF NOT EXISTS saved_searches (
+	id          TEXT PRIMARY KEY,
+	client      TEXT NOT NULL,
+	name        TEXT NOT NULL,
+	prompt      TEXT NOT NULL DEFAULT '',
+	timezone    TEXT NOT NULL DEFAULT '',
+	action      TEXT NOT NULL,
+	parameters  TEXT NOT NULL DEFAULT '{}',
+	interval_s  INTEGER NOT NULL,
+	notify_url  TEXT NOT NULL DEFAULT '',
+	created_at  INTEGER NOT NULL,
+	last_run_at INTEGER NOT NULL DEFAULT 0,
+	next_run_at INTEGER NOT NULL,
+	last_error  TEXT NOT NULL DEFAULT '',
+	seen_ids    TEXT NOT NULL DEFAULT '[]'
+);
+CREATE INDEX IF NOT EXISTS saved_searches_client ON saved_searches (client);
+CREATE INDEX IF NOT EXISTS saved_searches_next_run ON saved_searches (next_run_at);
+`
+
+// migrations add the columns that tables created by earlier versions lack.
+// On newer tables they fail with a duplicate column, which is ignored.
+var migrations = []string{
+	`ALTER TABLE saved_searches ADD COLUMN timezone TEXT NOT NULL DEFAULT ''`,
+}
+
+// SQLite is a Repository backed by a SQLite database file
+type SQLite struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens (creating if needed) the database at path and applies the schema
+func OpenSQLite(path string) (*SQLite, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time; a single connection avoids busy errors
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error applying schema: %v", err)
+	}
+	for _, m := range migrations {
+		if _, err := db.Exec(m); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			db.Close()
+			return nil, fmt.Errorf("error migrating schema: %v", err)
+		}
+	}
+	return &SQLite{db: db}, nil
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLite) SavePrompt(ctx context.Context, rec PromptRecord) error {
+	rankings, err := json.Marshal(rec.Rankings)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT OR REPLACE INTO prompts
+			(id, request_id, client, prompt, created_at, status, error, duration_ms, classification_ms, rankings, llm_tokens, cost_usd)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.ID, rec.RequestID, rec.Client, rec.Prompt, rec.CreatedAt.UnixMilli(), rec.Status, rec.Error,
+		rec.DurationMS, rec.ClassificationMS, string(rankings), rec.LLMTokens, rec.CostUSD)
+	if err != nil {
+		return fmt.Errorf("error saving prompt: %v", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM prompt_services WHERE prompt_id = ?`, rec.ID); err != nil {
+		return err
+	}
+	for i, svc := range rec.Services {
+		var action string
+		params := []byte("{}")
+		if svc.Action != nil {
+			action = svc.Action.Action
+			if params, err = json.Marshal(svc.Action.Parameters); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO prompt_services
+				(prompt_id, position, service, applicability, routed, action, parameters, upstream_status, upstream_shared,
+				 upstream_ms, activity_count, activities, error, duration_ms, llm_tokens, cost_usd)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			rec.ID, i, svc.Service, svc.Applicability, svc.Routed, action, string(params), svc.UpstreamStatus, svc.UpstreamShared,
+			svc.UpstreamMS, svc.ActivityCount, string(svc.Activities), svc.Error, svc.DurationMS, svc.LLMTokens, svc.CostUSD)
+		if err != nil {
+			return fmt.Errorf("error saving service %s: %v", svc.Service, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+const promptColumns = `id, request_id, client, prompt, created_at, status, error, duration_ms, classification_ms, rankings, llm_tokens, cost_usd`
+
+func (s *SQLite) GetPrompt(ctx context.Context, id string) (PromptRecord, bool, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+promptColumns+` FROM prompts WHERE id = ?`, id)
+	if err != nil {
+		return PromptRecord{}, false, err
+	}
+	recs, err := s.scanPrompts(ctx, rows)
+	if err != nil || len(recs) == 0 {
+		return PromptRecord{}, false, err
+	}
+	return recs[0], true, nil
+}
+
+func (s *SQLite) ListPrompts(ctx context.Context, q Query) ([]PromptRecord, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if q.Client != "" {
+		where = append(where, "client = ?")
+		args = append(args, q.Client)
+	}
+	if q.Service != "" {
+		where = append(where, "id IN (SELECT prompt_id FROM prompt_services WHERE service = ? AND routed)")
+		args = append(args, q.Service)
+	}
+	if !q.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, q.From.UnixMilli())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, q.To.UnixMilli())
+	}
+
+	query := `SELECT ` + promptColumns + ` FROM prompts`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id LIMIT ? OFFSET ?"
+	args = append(args, clampLimit(q.Limit), max(q.Offset, 0))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return s.scanPrompts(ctx, rows)
+}
+
+// scanPrompts reads prompt rows and loads their services
+func (s *SQLite) scanPrompts(ctx context.Context, rows *sql.Rows) ([]PromptRecord, error) {
+	var recs []PromptRecord
+	for rows.Next() {
+		var (
+			rec       PromptRecord
+			createdAt int64
+			rankings  string
+		)
+		if err := rows.Scan(&rec.ID, &rec.RequestID, &rec.Client, &rec.Prompt, &createdAt, &rec.Status, &rec.Error,
+			&rec.DurationMS, &rec.ClassificationMS, &rankings, &rec.LLMTokens, &rec.CostUSD); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rec.CreatedAt = time.UnixMilli(createdAt).UTC()
+		if err := json.Unmarshal([]byte(rankings), &rec.Rankings); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("prompt %s: %v", rec.ID, err)
+		}
+		recs = append(recs, rec)
+	}
+	// Close before loading services: the database has a single connection
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range recs {
+		services, err := s.services(ctx, recs[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		recs[i].Services = services
+	}
+	return recs, nil
+}
+
+func (s *SQLite) services(ctx context.Context, promptID string) ([]*ServiceRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT service, applicability, routed, action, parameters, upstream_status, upstream_shared, upstream_ms,
+		       activity_count, activities, error, duration_ms, llm_tokens, cost_usd
+		FROM prompt_services WHERE prompt_id = ? ORDER BY position`, promptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*ServiceRecord
+	for rows.Next() {
+		var (
+			svc        ServiceRecord
+			action     string
+			params     string
+			activities string
+		)
+		if err := rows.Scan(&svc.Service, &svc.Applicability, &svc.Routed, &action, &params, &svc.UpstreamStatus,
+			&svc.UpstreamShared, &svc.UpstreamMS, &svc.ActivityCount, &activities, &svc.Error, &svc.DurationMS,
+			&svc.LLMTokens, &svc.CostUSD); err != nil {
+			return nil, err
+		}
+		if action != "" {
+			svc.Action = &Action{Action: action}
+			if err := json.Unmarshal([]byte(params), &svc.Action.Parameters); err != nil {
+				return nil, fmt.Errorf("prompt %s service %s: %v", promptID, svc.Service, err)
+			}
+		}
+		if activities != "" {
+			svc.Activities = json.RawMessage(activities)
+		}
+		out = append(out, &svc)
+	}
+	return out, rows.Err()
+}
+
+func clampLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return DefaultLimit
+	case limit > MaxLimit:
+		return MaxLimit
+	default:
+		return limit
+	}
+}
@@ -0,0 +1,144 @@
+package usage
+
+import (
+	"context"
+	"sync"
+
+	"go-backend/ratelimit"
+)
+
+// Record is the token usage of a single LLM call
+type Record struct {
+	Stage            string  `json:"stage"`
+	Service          string  `json:"service"`
+	Template         string  `json:"template,omitempty"`
+	Model            string  `json:"model"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+	// Shared marks a call answered from an identical call made for another
+	// prompt in the same batch. It used no tokens of its own.
+	Shared bool `json:"shared,omitempty"`
+}
+
+// Summary aggregates a set of LLM calls
+type Summary struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+	SharedCalls      int     `json:"shared_calls,omitempty"`
+}
+
+func (s *Summary) add(r Record) {
+	if r.Shared {
+		s.SharedCalls++
+		return
+	}
+	s.Calls++
+	s.PromptTokens += r.PromptTokens
+	s.CompletionTokens += r.CompletionTokens
+	s.TotalTokens += r.TotalTokens
+	s.CostUSD += r.CostUSD
+}
+
+// Ledger collects the LLM calls made while serving one request
+type Ledger struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+type ledgerKey struct{}
+type serviceKey struct{}
+
+// NewContext returns a context carrying a fresh ledger for a request
+func NewContext(ctx context.Context) (context.Context, *Ledger) {
+	l := &Ledger{}
+	return context.WithValue(ctx, ledgerKey{}, l), l
+}
+
+// FromContext returns the request's ledger, or nil if there is none
+func FromContext(ctx context.Context) *Ledger {
+	l, _ := ctx.Value(ledgerKey{}).(*Ledger)
+	return l
+}
+
+// WithService tags LLM calls made with ctx as belonging to service
+func WithService(ctx context.Context, service string) context.Context {
+	return context.WithValue(ctx, serviceKey{}, service)
+}
+
+// Add records an LLM call against the request ledger and the global totals.
+// The service, total and estimated cost are filled in from ctx and the price
+// table. Shared calls cost nothing and only go in the ledger.
+func Add(ctx context.Context, r Record) Record {
+	r.Service = ServiceFromContext(ctx)
+	if r.Shared {
+		r.PromptTokens, r.CompletionTokens = 0, 0
+	}
+	r.TotalTokens = r.PromptTokens + r.CompletionTokens
+	r.CostUSD = EstimateCost(r.Model, r.PromptTokens, r.CompletionTokens)
+
+	if l := FromContext(ctx); l != nil {
+		l.mu.Lock()
+		l.records = append(l.records, r)
+		l.mu.Unlock()
+	}
+
+	if !r.Shared {
+		client, _ := ratelimit.ClientFromContext(ctx)
+		totals.add(client, r)
+	}
+
+	return r
+}
+
+// Records returns a copy of every call recorded so far
+func (l *Ledger) Records() []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Record(nil), l.records...)
+}
+
+// Summary totals every call in the ledger
+func (l *Ledger) Summary() Summary {
+	var s Summary
+	for _, r := range l.Records() {
+		s.add(r)
+	}
+	return s
+}
+
+// Templates returns the prompt templates ("id@version") used for service, in call order
+func (l *Ledger) Templates(service string) []string {
+	var refs []string
+	for _, r := range l.Records() {
+		if r.Service == service && r.Template != "" {
+			refs = append(refs, r.Template)
+		}
+	}
+	return refs
+}
+
+// ServiceSummary totals the calls tagged with service, or nil if there were none
+func (l *Ledger) ServiceSummary(service string) *Summary {
+	var s *Summary
+	for _, r := range l.Records() {
+		if r.Service != service {
+			continue
+		}
+		if s == nil {
+			s = &Summary{}
+		}
+		s.add(r)
+	}
+	return s
+}
+
+// ServiceFromContext returns the service ctx was tagged with by WithService
+func ServiceFromContext(ctx context.Context) string {
+	service, _ := ctx.Value(serviceKey{}).(string)
+	return service
+}
@@ -0,0 +1,75 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Price is the cost in USD per 1K tokens for a model
+type Price struct {
+	PromptPer1K     float64 `json:"prompt_per_1k"`
+	CompletionPer1K float64 `json:"completion_per_1k"`
+}
+
+// PriceTable maps model names (or model name prefixes) to prices
+type PriceTable map[string]Price
+
+// DefaultPrices are used when no price table is configured
+var DefaultPrices = PriceTable{
+	"gpt-3.5-turbo": {PromptPer1K: 0.0005, CompletionPer1K: 0.0015},
+	"gpt-4o-mini":   {PromptPer1K: 0.00015, CompletionPer1K: 0.0006},
+	"gpt-4o":        {PromptPer1K: 0.0025, CompletionPer1K: 0.01},
+	"gpt-4-turbo":   {PromptPer1K: 0.01, CompletionPer1K: 0.03},
+}
+
+var (
+	pricesMu sync.RWMutex
+	prices   = DefaultPrices
+)
+
+// LoadPriceTable reads a JSON price table from path
+func LoadPriceTable(path string) (PriceTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading price table: %v", err)
+	}
+
+	var table PriceTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("error parsing price table: %v", err)
+	}
+	return table, nil
+}
+
+// SetPrices replaces the price table used for cost estimates
+func SetPrices(table PriceTable) {
+	pricesMu.Lock()
+	defer pricesMu.Unlock()
+	prices = table
+}
+
+// EstimateCost returns the USD cost of a call. Dated model names returned by
+// the API (e.g. gpt-3.5-turbo-0125) match the longest configured prefix.
+func EstimateCost(model string, promptTokens, completionTokens int) float64 {
+	pricesMu.RLock()
+	defer pricesMu.RUnlock()
+
+	price, ok := prices[model]
+	if !ok {
+		best := ""
+		for name, p := range prices {
+			if strings.HasPrefix(model, name) && len(name) > len(best) {
+				best, price = name, p
+			}
+		}
+		if best == "" {
+			return 0
+		}
+	}
+
+	return float64(promptTokens)/1000*price.PromptPer1K +
+		float64(completionTokens)/1000*price.CompletionPer1K
+}
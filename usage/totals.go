@@ -0,0 +1,100 @@
+package usage
+
+import (
+	"expvar"
+	"sync"
+)
+
+// Report is a breakdown of process-wide LLM usage
+type Report struct {
+	All       Summary             `json:"all"`
+	ByModel   map[string]*Summary `json:"by_model"`
+	ByService map[string]*Summary `json:"by_service"`
+	// ByClient tracks at most MaxClients clients; later ones are added up
+	// under OtherClients
+	ByClient map[string]*Summary `json:"by_client,omitempty"`
+}
+
+// MaxClients bounds the clients usage is broken down by, so a stream of
+// new IP addresses cannot grow the report without limit
+const MaxClients = 1000
+
+// OtherClients is the ByClient entry for clients beyond MaxClients
+const OtherClients = "other"
+
+// aggregator accumulates usage across all requests since start-up
+type aggregator struct {
+	mu     sync.Mutex
+	report Report
+}
+
+var totals = &aggregator{
+	report: Report{
+		ByModel:   make(map[string]*Summary),
+		ByService: make(map[string]*Summary),
+		ByClient:  make(map[string]*Summary),
+	},
+}
+
+// The published report leaves out the per-client breakdown, which admins
+// read from /admin/usage
+func init() {
+	expvar.Publish("llm_usage", expvar.Func(func() interface{} {
+		report := Totals()
+		report.ByClient = nil
+		return report
+	}))
+}
+
+func (a *aggregator) add(client string, r Record) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Classifier calls happen before any service is chosen
+	service := r.Service
+	if service == "" {
+		service = "director"
+	}
+	if client == "" {
+		client = "internal"
+	}
+	if _, ok := a.report.ByClient[client]; !ok && len(a.report.ByClient) >= MaxClients {
+		client = OtherClients
+	}
+
+	a.report.All.add(r)
+	bucket(a.report.ByModel, r.Model).add(r)
+	bucket(a.report.ByService, service).add(r)
+	bucket(a.report.ByClient, client).add(r)
+}
+
+func bucket(m map[string]*Summary, key string) *Summary {
+	s, ok := m[key]
+	if !ok {
+		s = &Summary{}
+		m[key] = s
+	}
+	return s
+}
+
+// Totals returns a copy of the process-wide usage since start-up
+func Totals() Report {
+	totals.mu.Lock()
+	defer totals.mu.Unlock()
+
+	return Report{
+		All:       totals.report.All,
+		ByModel:   copySummaries(totals.report.ByModel),
+		ByService: copySummaries(totals.report.ByService),
+		ByClient:  copySummaries(totals.report.ByClient),
+	}
+}
+
+func copySummaries(m map[string]*Summary) map[string]*Summary {
+	out := make(map[string]*Summary, len(m))
+	for k, v := range m {
+		s := *v
+		out[k] = &s
+	}
+	return out
+}
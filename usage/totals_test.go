@@ -0,0 +1,63 @@
+package usage
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAggregatorByClient(t *testing.T) {
+	a := &aggregator{report: Report{
+		ByModel:   make(map[string]*Summary),
+		ByService: make(map[string]*Summary),
+		ByClient:  make(map[string]*Summary),
+	}}
+	for i := 0; i < MaxClients; i++ {
+		a.add(fmt.Sprintf("ip:10.0.%d.%d", i/256, i%256), Record{Model: "m", TotalTokens: 1})
+	}
+	a.add("ip:10.0.0.0", Record{Model: "m", TotalTokens: 1})
+	a.add("ip:192.0.2.1", Record{Model: "m", TotalTokens: 5})
+	a.add("ip:192.0.2.2", Record{Model: "m", TotalTokens: 7})
+	a.add("", Record{Model: "m", TotalTokens: 1})
+
+	tests := []struct {
+		client string
+		tokens int
+	}{
+		// A client already tracked keeps its own entry
+		{"ip:10.0.0.0", 2},
+		{"ip:10.0.0.1", 1},
+		// Clients beyond the bound are added up together
+		{OtherClients, 13},
+		{"ip:192.0.2.1", 0},
+	}
+	for _, tt := range tests {
+		got := 0
+		if s, ok := a.report.ByClient[tt.client]; ok {
+			got = s.TotalTokens
+		}
+		if got != tt.tokens {
+			t.Errorf("ByClient[%q] tokens = %d, want %d", tt.client, got, tt.tokens)
+		}
+	}
+	if n := len(a.report.ByClient); n != MaxClients+1 {
+		t.Errorf("%d clients tracked, want %d and %q", n, MaxClients, OtherClients)
+	}
+	if a.report.All.TotalTokens != MaxClients+14 {
+		t.Errorf("all tokens = %d, want %d", a.report.All.TotalTokens, MaxClients+14)
+	}
+}
+
+func TestPublishedTotalsLeaveOutClients(t *testing.T) {
+	totals.add("key:secret-client", Record{Model: "m", TotalTokens: 1})
+	published := expvar.Get("llm_usage").String()
+	if strings.Contains(published, "secret-client") || strings.Contains(published, "by_client") {
+		t.Errorf("llm_usage publishes clients: %s", published)
+	}
+	var report Report
+	if err := json.Unmarshal([]byte(published), &report); err != nil || report.All.Calls == 0 {
+		t.Errorf("llm_usage = %s, %v; want the aggregate totals", published, err)
+	}
+}
@@ -0,0 +1,242 @@
+// Package webhook delivers signed JSON callbacks. Each payload is signed with
+// HMAC-SHA256 so receivers can check it came from us, and transient failures
+// are retried with exponential backoff.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrDisabled is returned when callbacks are requested but no signing
+	// secret is configured
+	ErrDisabled = errors.New("callbacks are not enabled on this server")
+	// ErrInvalidURL is returned for callback URLs we refuse to call
+	ErrInvalidURL = errors.New("invalid callback URL")
+	// ErrBlockedAddress is returned when a callback host resolves to a
+	// loopback, private or link-local address
+	ErrBlockedAddress = errors.New("callback address is not allowed")
+)
+
+// Config holds the callback delivery settings
+type Config struct {
+	// Secret signs every payload; callbacks are disabled without one
+	Secret      string
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for each one after
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each delivery attempt
+	Timeout time.Duration
+	// AllowedHosts, if set, is the only hosts callbacks may go to
+	AllowedHosts []string
+	// AllowPrivate permits callbacks to loopback and private networks, for
+	// local development
+	AllowPrivate bool
+}
+
+// ConfigFromEnv reads the CALLBACK_* settings, falling back to defaults for
+// anything unset or invalid
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Secret:       os.Getenv("CALLBACK_SIGNING_SECRET"),
+		MaxAttempts:  5,
+		Backoff:      time.Second,
+		MaxBackoff:   time.Minute,
+		Timeout:      10 * time.Second,
+		AllowPrivate: os.Getenv("CALLBACK_ALLOW_PRIVATE") == "true",
+	}
+	if n, err := strconv.Atoi(os.Getenv("CALLBACK_MAX_ATTEMPTS")); err == nil && n > 0 {
+		cfg.MaxAttempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("CALLBACK_BACKOFF")); err == nil && d > 0 {
+		cfg.Backoff = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("CALLBACK_TIMEOUT")); err == nil && d > 0 {
+		cfg.Timeout = d
+	}
+	for _, host := range strings.Split(os.Getenv("CALLBACK_ALLOWED_HOSTS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			cfg.AllowedHosts = append(cfg.AllowedHosts, host)
+		}
+	}
+	return cfg
+}
+
+// Sender delivers callbacks
+type Sender struct {
+	cfg    Config
+	client *http.Client
+}
+
+// NewSender creates a sender, or returns nil if cfg has no secret
+func NewSender(cfg Config) *Sender {
+	if cfg.Secret == "" {
+		return nil
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		// Checked on the resolved address at connect time so a DNS answer
+		// cannot point a public-looking host at an internal service
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return ErrBlockedAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &Sender{
+		cfg: cfg,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+			// A redirect could lead anywhere; receivers must give the final URL
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// ValidateURL checks a callback URL before a job is accepted with it. The
+// resolved address is checked again on every delivery.
+func (s *Sender) ValidateURL(raw string) error {
+	if s == nil {
+		return ErrDisabled
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return ErrInvalidURL
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && s.cfg.AllowPrivate) {
+		return fmt.Errorf("%w: scheme must be https", ErrInvalidURL)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials are not allowed in the URL", ErrInvalidURL)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if len(s.cfg.AllowedHosts) > 0 && !contains(s.cfg.AllowedHosts, host) {
+		return fmt.Errorf("%w: host %q is not allowed", ErrInvalidURL, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && !s.cfg.AllowPrivate && blockedIP(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+// Send POSTs body to rawURL with a signature header and any extra headers,
+// retrying network errors, 408, 429 and 5xx responses. It returns how many
+// attempts were made.
+func (s *Sender) Send(ctx context.Context, rawURL string, headers map[string]string, body []byte) (attempts int, err error) {
+	if s == nil {
+		return 0, ErrDisabled
+	}
+
+	for attempts = 1; ; attempts++ {
+		var retryAfter time.Duration
+		retryAfter, err = s.attempt(ctx, rawURL, headers, body)
+		if err == nil {
+			return attempts, nil
+		}
+		if retryAfter < 0 || attempts >= s.cfg.MaxAttempts {
+			return attempts, err
+		}
+
+		delay := s.backoff(attempts)
+		if retryAfter > delay {
+			delay = min(retryAfter, s.cfg.MaxBackoff)
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return attempts, ctx.Err()
+		}
+	}
+}
+
+// attempt makes one delivery. A negative retryAfter means the failure is
+// permanent; otherwise it is the receiver's requested delay, if any.
+func (s *Sender) attempt(ctx context.Context, rawURL string, headers map[string]string, body []byte) (retryAfter time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", rawURL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-backend-webhook/1")
+	req.Header.Set(SignatureHeader, Sign([]byte(s.cfg.Secret), time.Now(), body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrBlockedAddress) {
+			return -1, err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return 0, nil
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return time.Duration(seconds) * time.Second, fmt.Errorf("callback returned status %d", resp.StatusCode)
+	default:
+		return -1, fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+}
+
+// backoff returns the delay after the given attempt: Backoff doubled per
+// attempt, capped at MaxBackoff, with up to 20% jitter
+func (s *Sender) backoff(attempt int) time.Duration {
+	delay := s.cfg.Backoff << (attempt - 1)
+	if delay <= 0 || delay > s.cfg.MaxBackoff {
+		delay = s.cfg.MaxBackoff
+	}
+	return delay - time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// blockedIP reports whether ip is on a network callbacks must not reach
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}